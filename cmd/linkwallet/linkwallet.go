@@ -1,11 +1,17 @@
 package main
 
 import (
+	"bufio"
 	"flag"
+	"fmt"
 	"log"
+	"os"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/tardisx/linkwallet/db"
+	"github.com/tardisx/linkwallet/entity"
 	v "github.com/tardisx/linkwallet/version"
 	"github.com/tardisx/linkwallet/web"
 )
@@ -13,13 +19,59 @@ import (
 func main() {
 
 	var dbPath string
+	var setPassword string
+	var reset2FA string
+	var linkOIDC, oidcSubject string
+	var exportDir, exportUser, exportTag, exportSearch string
+	var exportPrivate bool
+	var authHeader string
+	var trustedProxies string
+	oidcOpts := web.OIDCOptions{}
 	flag.StringVar(&dbPath, "db-path", "", "path to the database file")
+	flag.StringVar(&setPassword, "set-password", "", "set the password (read from stdin) for the named user, creating them if necessary, and exit")
+	flag.StringVar(&reset2FA, "reset-2fa", "", "disable two factor authentication for the named user, and exit")
+	flag.StringVar(&linkOIDC, "link-oidc", "", "let the named user log in with the -oidc-issuer user given by -oidc-subject (or none if empty), and exit")
+	flag.StringVar(&oidcSubject, "oidc-subject", "", "OpenID Connect subject (the sub claim) to link with -link-oidc")
+	flag.StringVar(&exportDir, "export-static", "", "export bookmarks as a static site into this directory, and exit")
+	flag.StringVar(&exportUser, "export-user", "", "user whose bookmarks are exported with -export-static (not needed if there is only one user)")
+	flag.StringVar(&exportTag, "export-tag", "", "only export bookmarks with this tag")
+	flag.StringVar(&exportSearch, "export-search", "", "only export bookmarks found by the user's saved search with this name")
+	flag.BoolVar(&exportPrivate, "export-private", false, "export all bookmarks, not just the public ones")
+	flag.StringVar(&authHeader, "auth-header", "", "trust this header (eg Remote-User) from a reverse proxy to identify the user")
+	flag.StringVar(&trustedProxies, "trusted-proxies", "", "comma separated networks (CIDR) of reverse proxies trusted to set -auth-header")
+	flag.StringVar(&oidcOpts.Issuer, "oidc-issuer", "", "OpenID Connect issuer URL, enables single sign-on")
+	flag.StringVar(&oidcOpts.ClientID, "oidc-client-id", "", "OpenID Connect client ID")
+	flag.StringVar(&oidcOpts.RedirectURL, "oidc-redirect-url", "", "OpenID Connect redirect URL (https://your.linkwallet/login/oidc/callback)")
+	flag.StringVar(&oidcOpts.UsernameClaim, "oidc-username-claim", "preferred_username", "OpenID Connect claim to use as the username")
+	flag.StringVar(&oidcOpts.GroupsClaim, "oidc-groups-claim", "groups", "OpenID Connect claim containing the user's groups")
+	flag.StringVar(&oidcOpts.AdminGroup, "oidc-admin-group", "", "OpenID Connect group whose members are admins")
 	flag.Parse()
 
+	// the client secret is not a flag, to keep it out of the process list
+	oidcOpts.ClientSecret = os.Getenv("OIDC_CLIENT_SECRET")
+
 	if dbPath == "" {
 		log.Fatal("You need to specify the path to the database file with -db-path")
 	}
 
+	webOpts := web.Options{AuthHeader: authHeader}
+	if authHeader != "" {
+		nets, err := web.ParseTrustedProxies(trustedProxies)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if len(nets) == 0 {
+			log.Fatal("You need to specify the trusted proxy networks with -trusted-proxies when using -auth-header")
+		}
+		webOpts.TrustedProxies = nets
+	}
+	if oidcOpts.Issuer != "" {
+		if oidcOpts.ClientID == "" || oidcOpts.RedirectURL == "" {
+			log.Fatal("You need to specify -oidc-client-id and -oidc-redirect-url when using -oidc-issuer")
+		}
+		webOpts.OIDC = &oidcOpts
+	}
+
 	dbh := db.DB{}
 	rescrape, err := dbh.Open(dbPath)
 	if err != nil {
@@ -28,6 +80,76 @@ func main() {
 
 	bmm := db.NewBookmarkManager(&dbh)
 	cmm := db.NewConfigManager(&dbh)
+	um := db.NewUserManager(&dbh)
+	sm := db.NewShareManager(&dbh)
+	ssm := db.NewSavedSearchManager(&dbh)
+
+	if setPassword != "" {
+		fmt.Printf("New password for %s: ", setPassword)
+		password, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil {
+			log.Fatalf("could not read password: %s", err)
+		}
+		password = strings.TrimRight(password, "\r\n")
+
+		user, err := um.LoadUserByUsername(setPassword)
+		if err == db.ErrUserNotFound {
+			user = entity.User{Username: setPassword}
+			err = um.AddUser(&user, password)
+		} else if err == nil {
+			err = um.SetPassword(user.ID, password)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		dbh.Close()
+		log.Printf("password set for %s", user.Username)
+		return
+	}
+
+	if reset2FA != "" {
+		user, err := um.LoadUserByUsername(reset2FA)
+		if err != nil {
+			log.Fatalf("could not load %s: %s", reset2FA, err)
+		}
+		err = um.ResetTOTP(user.ID)
+		if err != nil {
+			log.Fatal(err)
+		}
+		dbh.Close()
+		log.Printf("two factor authentication disabled for %s", user.Username)
+		return
+	}
+
+	if linkOIDC != "" {
+		if oidcSubject != "" && oidcOpts.Issuer == "" {
+			log.Fatal("You need to specify the provider with -oidc-issuer when using -link-oidc")
+		}
+		user, err := um.LoadUserByUsername(linkOIDC)
+		if err != nil {
+			log.Fatalf("could not load %s: %s", linkOIDC, err)
+		}
+		err = um.LinkOIDC(user.ID, oidcOpts.Issuer, oidcSubject)
+		if err != nil {
+			log.Fatal(err)
+		}
+		dbh.Close()
+		if oidcSubject == "" {
+			log.Printf("single sign-on unlinked from %s", user.Username)
+		} else {
+			log.Printf("%s linked to %s at %s", user.Username, oidcSubject, oidcOpts.Issuer)
+		}
+		return
+	}
+
+	if exportDir != "" {
+		err := exportStatic(bmm, cmm, um, ssm, exportDir, exportUser, exportTag, exportSearch, exportPrivate)
+		if err != nil {
+			log.Fatal(err)
+		}
+		dbh.Close()
+		return
+	}
 
 	go func() {
 		for {
@@ -49,7 +171,7 @@ func main() {
 
 	log.Printf("linkwallet version %s starting", v.VersionInfo.Local.Version)
 
-	server := web.Create(bmm, cmm)
+	server := web.Create(bmm, cmm, um, sm, ssm, webOpts)
 	go bmm.RunQueue()
 	go bmm.UpdateContent()
 
@@ -68,3 +190,70 @@ func main() {
 
 	server.Start()
 }
+
+// exportStatic exports a user's bookmarks as a static site.
+func exportStatic(bmm *db.BookmarkManager, cmm *db.ConfigManager, um *db.UserManager, ssm *db.SavedSearchManager, dir, username, tag, search string, private bool) error {
+	var user entity.User
+	if username == "" {
+		users, err := um.AllUsers()
+		if err != nil {
+			return err
+		}
+		if len(users) != 1 {
+			return fmt.Errorf("you need to specify which user's bookmarks to export with -export-user")
+		}
+		user = users[0]
+	} else {
+		var err error
+		user, err = um.LoadUserByUsername(username)
+		if err != nil {
+			return fmt.Errorf("could not load %s: %w", username, err)
+		}
+	}
+
+	config, err := cmm.LoadConfig(user.ID)
+	if err != nil {
+		return err
+	}
+	title := "Bookmarks"
+	var all []entity.Bookmark
+	if search != "" {
+		searches, err := ssm.SavedSearches(user.ID)
+		if err != nil {
+			return err
+		}
+		i := slices.IndexFunc(searches, func(ss entity.SavedSearch) bool { return strings.EqualFold(ss.Name, search) })
+		if i == -1 {
+			return fmt.Errorf("%s has no saved search called %s", user.Username, search)
+		}
+		title = searches[i].Name
+		all, err = bmm.MatchingBookmarks(db.SavedSearchOptions(searches[i]))
+		if err != nil {
+			return err
+		}
+	} else {
+		all, err = bmm.BookmarksForOwner(user.ID)
+		if err != nil {
+			return err
+		}
+	}
+	bookmarks := []entity.Bookmark{}
+	for _, bm := range all {
+		if tag != "" && !bm.HasTag(tag) {
+			continue
+		}
+		if private || bm.IsPublic(config.PublicTags) {
+			bookmarks = append(bookmarks, bm)
+		}
+	}
+
+	if tag != "" {
+		title += " tagged " + tag
+	}
+	err = web.ExportStatic(dir, title, bookmarks)
+	if err != nil {
+		return err
+	}
+	log.Printf("exported %d bookmarks to %s", len(bookmarks), dir)
+	return nil
+}
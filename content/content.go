@@ -19,14 +19,16 @@ func FetchPageInfo(bm entity.Bookmark) entity.PageInfo {
 	c := colly.NewCollector()
 	c.SetRequestTimeout(5 * time.Second)
 
-	c.OnHTML("p,h1,h2,h3,h4,h5,h6,li", func(e *colly.HTMLElement) {
-		info.RawText = info.RawText + e.Text + "\n"
-	})
-
 	c.OnHTML("head>title", func(h *colly.HTMLElement) {
 		info.Title = h.Text
 	})
 
+	langAttr := ""
+	c.OnHTML("html", func(h *colly.HTMLElement) {
+		langAttr = h.Attr("lang")
+		info.RawText = pageText(h.DOM)
+	})
+
 	c.OnResponse(func(r *colly.Response) {
 		info.StatusCode = r.StatusCode
 		info.Size = len(r.Body)
@@ -41,5 +43,6 @@ func FetchPageInfo(bm entity.Bookmark) entity.PageInfo {
 	})
 
 	c.Visit(url)
+	info.Language = DetectLanguage(langAttr, info.Title+"\n"+info.RawText)
 	return info
 }
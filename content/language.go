@@ -0,0 +1,45 @@
+package content
+
+import (
+	"strings"
+
+	"github.com/abadojack/whatlanggo"
+)
+
+// languageNames maps ISO 639-1 codes to the names of the languages.
+var languageNames = map[string]string{}
+
+func init() {
+	for lang, name := range whatlanggo.Langs {
+		if code := lang.Iso6391(); code != "" {
+			languageNames[code] = name
+		}
+	}
+}
+
+// DetectLanguage returns the ISO 639-1 code of the language of a page.
+// The lang attribute of its html element is trusted if it names a
+// language, otherwise the language is guessed from the text. It returns ""
+// if the language cannot be told reliably.
+func DetectLanguage(langAttr string, text string) string {
+	// en-GB and en_GB are both English
+	code, _, _ := strings.Cut(strings.ToLower(strings.TrimSpace(langAttr)), "-")
+	code, _, _ = strings.Cut(code, "_")
+	if _, ok := languageNames[code]; ok {
+		return code
+	}
+	info := whatlanggo.Detect(text)
+	if !info.IsReliable() {
+		return ""
+	}
+	return info.Lang.Iso6391()
+}
+
+// LanguageName returns the name of the language with the ISO 639-1 code,
+// or the code itself if it is not known.
+func LanguageName(code string) string {
+	if name, ok := languageNames[code]; ok {
+		return name
+	}
+	return code
+}
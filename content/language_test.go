@@ -0,0 +1,27 @@
+package content
+
+import "testing"
+
+func TestDetectLanguage(t *testing.T) {
+	tcs := []struct {
+		lang string
+		text string
+		want string
+	}{
+		{"de-DE", "this text is in English but the page says otherwise", "de"},
+		{"en_GB", "", "en"},
+		{"", "Die Katze sitzt auf der Matte und schaut aus dem Fenster, während draußen der Regen fällt.", "de"},
+		{"", "Le chat est assis sur le tapis et regarde par la fenêtre pendant qu'il pleut dehors.", "fr"},
+		{"", "東京の天気予報によると、明日は一日中雨が降るそうです。", "ja"},
+		{"klingon", "", ""},
+		{"", "", ""},
+	}
+	for _, tc := range tcs {
+		if got := DetectLanguage(tc.lang, tc.text); got != tc.want {
+			t.Errorf("%q %q: got %q, want %q", tc.lang, tc.text, got, tc.want)
+		}
+	}
+	if LanguageName("de") != "German" || LanguageName("xx") != "xx" {
+		t.Errorf("wrong language names %s %s", LanguageName("de"), LanguageName("xx"))
+	}
+}
@@ -0,0 +1,248 @@
+package content
+
+import (
+	"math"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/PuerkitoBio/goquery"
+	"golang.org/x/net/html"
+)
+
+// minMainTextLength is the fewest characters the main text of a page can
+// have before it is thought to have been missed, and the text of the whole
+// page is used instead.
+const minMainTextLength = 250
+
+// minScoredLength is the fewest characters a paragraph needs to count
+// towards the score of the elements around it.
+const minScoredLength = 25
+
+var (
+	// removedTags never hold the main text of a page.
+	removedTags = "script, style, noscript, template, iframe, svg, canvas, object, embed, nav, aside, footer, " +
+		"button, select, textarea, input, [hidden], [aria-hidden=true], [style*='display:none'], [style*='display: none'], " +
+		"[role=navigation], [role=menu], [role=menubar], [role=complementary], [role=dialog], [role=alert], [role=alertdialog]"
+
+	// unlikelyRE matches the classes and IDs of elements which are
+	// probably not the main text, unless they also match maybeRE.
+	unlikelyRE = regexp.MustCompile(`(?i)-ad-|ad-break|agegate|banner|breadcrumb|combx|comment|community|consent|cookie|disqus|` +
+		`extra|footer|gdpr|header|legends|menu|\bnav\b|navbar|navbox|navigation|pager|pagination|popup|related|remark|` +
+		`replies|rss|share|shoutbox|sidebar|skyscraper|social|sponsor|supplemental`)
+	maybeRE = regexp.MustCompile(`(?i)and|article|body|column|content|main|shadow`)
+
+	// positiveRE and negativeRE match the classes and IDs of elements
+	// more and less likely to hold the main text.
+	positiveRE = regexp.MustCompile(`(?i)article|body|content|entry|hentry|h-entry|main|page|post|text|blog|story`)
+	negativeRE = regexp.MustCompile(`(?i)-ad-|hidden|\bhid\b|banner|combx|comment|com-|contact|footer|gdpr|masthead|media|meta|` +
+		`outbrain|promo|related|scroll|share|shoutbox|sidebar|skyscraper|sponsor|shopping|tags|widget|navbox|reflist|references`)
+)
+
+// blockTags start a new line of text.
+var blockTags = map[string]bool{
+	"address": true, "article": true, "blockquote": true, "br": true, "dd": true, "div": true, "dl": true, "dt": true,
+	"figcaption": true, "h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true, "hr": true, "li": true,
+	"main": true, "ol": true, "p": true, "pre": true, "section": true, "table": true, "td": true, "th": true, "tr": true,
+	"ul": true,
+}
+
+// mainText returns the text of the main content of a page, such as an
+// article, leaving out menus, footers, banners and the like, in the way
+// Readability does. It returns nothing if it cannot find any.
+//
+// Paragraphs of text score points for the elements around them, by their
+// length and number of commas, and the element with the most points,
+// once those in links are discounted, is taken as the main content,
+// along with its siblings which look like part of it.
+func mainText(page *goquery.Selection) string {
+	doc := page.Clone()
+
+	doc.Find(removedTags).Remove()
+	doc.Find("header").Each(func(_ int, s *goquery.Selection) {
+		if s.Closest("article, main").Length() == 0 {
+			s.Remove()
+		}
+	})
+	doc.Find("*").Each(func(_ int, s *goquery.Selection) {
+		switch goquery.NodeName(s) {
+		case "html", "body", "article", "main", "a":
+			return
+		}
+		names := s.AttrOr("class", "") + " " + s.AttrOr("id", "")
+		if unlikelyRE.MatchString(names) && !maybeRE.MatchString(names) && s.Closest("table, code").Length() == 0 {
+			s.Remove()
+		}
+	})
+
+	scores := map[*html.Node]float64{}
+	candidates := []*goquery.Selection{}
+	addScore := func(s *goquery.Selection, score float64) {
+		node := s.Get(0)
+		if _, ok := scores[node]; !ok {
+			scores[node] = initialScore(s)
+			candidates = append(candidates, s)
+		}
+		scores[node] += score
+	}
+	doc.Find("p, pre, td, blockquote, div").Each(func(_ int, s *goquery.Selection) {
+		// divs are only paragraphs if they hold no other blocks
+		if goquery.NodeName(s) == "div" && s.Children().FilterFunction(func(_ int, c *goquery.Selection) bool {
+			return blockTags[goquery.NodeName(c)] && goquery.NodeName(c) != "br"
+		}).Length() > 0 {
+			return
+		}
+		text := strings.TrimSpace(s.Text())
+		length := utf8.RuneCountInString(text)
+		if length < minScoredLength {
+			return
+		}
+		score := 1 + float64(strings.Count(text, ",")+strings.Count(text, "，")) + math.Min(float64(length/100), 3)
+		// the parent gets all of it, those above less and less
+		for level, ancestor := 0, s.Parent(); level < 3 && ancestor.Length() > 0; level, ancestor = level+1, ancestor.Parent() {
+			if goquery.NodeName(ancestor) == "html" {
+				break
+			}
+			divider := 1.0
+			if level == 1 {
+				divider = 2
+			} else if level > 1 {
+				divider = float64(level * 3)
+			}
+			addScore(ancestor, score/divider)
+		}
+	})
+
+	var top *goquery.Selection
+	topScore := 0.0
+	for _, c := range candidates {
+		node := c.Get(0)
+		scores[node] *= 1 - linkDensity(c)
+		if top == nil || scores[node] > topScore {
+			top, topScore = c, scores[node]
+		}
+	}
+	if top == nil {
+		return ""
+	}
+
+	// siblings which score well, or read like paragraphs, are part of
+	// the main content too
+	parts := []string{}
+	threshold := math.Max(10, topScore*0.2)
+	topClass := top.AttrOr("class", "")
+	top.Parent().Children().Each(func(_ int, s *goquery.Selection) {
+		include := s.Get(0) == top.Get(0)
+		if !include {
+			score, scored := scores[s.Get(0)]
+			if scored && topClass != "" && s.AttrOr("class", "") == topClass {
+				score += topScore * 0.2
+			}
+			include = scored && score >= threshold
+		}
+		if !include && goquery.NodeName(s) == "p" {
+			text := strings.TrimSpace(s.Text())
+			length := utf8.RuneCountInString(text)
+			density := linkDensity(s)
+			include = (length > 80 && density < 0.25) ||
+				(length > 0 && length <= 80 && density == 0 && strings.Contains(text+" ", ". "))
+		}
+		if include {
+			parts = append(parts, blockText(s))
+		}
+	})
+	return strings.TrimSpace(strings.Join(parts, "\n"))
+}
+
+// initialScore is the score of an element before its paragraphs are
+// counted, by its tag and how its class and ID read.
+func initialScore(s *goquery.Selection) float64 {
+	score := 0.0
+	switch goquery.NodeName(s) {
+	case "div", "article", "main", "section":
+		score = 5
+	case "pre", "td", "blockquote":
+		score = 3
+	case "address", "ol", "ul", "dl", "dd", "dt", "li", "form":
+		score = -3
+	case "h1", "h2", "h3", "h4", "h5", "h6", "th":
+		score = -5
+	}
+	for _, name := range []string{s.AttrOr("class", ""), s.AttrOr("id", "")} {
+		if name == "" {
+			continue
+		}
+		if negativeRE.MatchString(name) {
+			score -= 25
+		}
+		if positiveRE.MatchString(name) {
+			score += 25
+		}
+	}
+	return score
+}
+
+// linkDensity returns how much of the text of an element is in links.
+func linkDensity(s *goquery.Selection) float64 {
+	length := utf8.RuneCountInString(strings.TrimSpace(s.Text()))
+	if length == 0 {
+		return 0
+	}
+	linkLength := 0
+	s.Find("a").Each(func(_ int, a *goquery.Selection) {
+		linkLength += utf8.RuneCountInString(strings.TrimSpace(a.Text()))
+	})
+	return float64(linkLength) / float64(length)
+}
+
+// blockText returns the text of an element, with a line for each block
+// inside it and the spacing within lines tidied up.
+func blockText(s *goquery.Selection) string {
+	b := strings.Builder{}
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		switch n.Type {
+		case html.TextNode:
+			b.WriteString(n.Data)
+			return
+		case html.ElementNode:
+			if blockTags[n.Data] {
+				b.WriteString("\n")
+				defer b.WriteString("\n")
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	for _, n := range s.Nodes {
+		walk(n)
+	}
+
+	lines := []string{}
+	for _, line := range strings.Split(b.String(), "\n") {
+		if line = strings.Join(strings.Fields(line), " "); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// allText returns the text of every paragraph, heading and list item of a
+// page, for when its main text cannot be found.
+func allText(page *goquery.Selection) string {
+	text := ""
+	page.Find("p,h1,h2,h3,h4,h5,h6,li").Each(func(_ int, s *goquery.Selection) {
+		text = text + s.Text() + "\n"
+	})
+	return text
+}
+
+// pageText returns the main text of a page, or the text of all of it if
+// that cannot be found.
+func pageText(page *goquery.Selection) string {
+	if text := mainText(page); utf8.RuneCountInString(text) >= minMainTextLength {
+		return text
+	}
+	return allText(page)
+}
@@ -0,0 +1,136 @@
+package content
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+func loadPage(t *testing.T, path string) *goquery.Selection {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	doc, err := goquery.NewDocumentFromReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return doc.Selection
+}
+
+// tidy collapses the spacing in text, so that it compares however it was
+// split into lines.
+func tidy(text string) string {
+	return strings.Join(strings.Fields(text), " ")
+}
+
+func TestMainTextCorpora(t *testing.T) {
+	paths, err := filepath.Glob("corpora/*.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) == 0 {
+		t.Fatal("no corpora")
+	}
+
+	// the menus and footer around every article
+	boilerplate := []string{"Main page", "Random article", "Privacy policy", "About Wikipedia", "Disclaimers"}
+
+	for _, path := range paths {
+		page := loadPage(t, path)
+		main := mainText(page)
+		if utf8.RuneCountInString(main) < minMainTextLength {
+			t.Errorf("%s: only %d characters of main text", path, utf8.RuneCountInString(main))
+			continue
+		}
+		if got := pageText(page); got != main {
+			t.Errorf("%s: page text is not the main text", path)
+		}
+
+		all := allText(page)
+		for _, phrase := range boilerplate {
+			if strings.Contains(all, phrase) && strings.Contains(main, phrase) {
+				t.Errorf("%s: main text has %q", path, phrase)
+			}
+		}
+
+		// nearly all of the article's paragraphs are kept
+		tidied := tidy(main)
+		paragraphs, kept := 0, 0
+		page.Find(".mw-parser-output > p").Each(func(_ int, p *goquery.Selection) {
+			// the styles and hidden text inside some paragraphs are
+			// rightly left out, so compare only those without
+			if p.Find("style, link, [style]").Length() > 0 {
+				return
+			}
+			text := tidy(p.Text())
+			if text == "" {
+				return
+			}
+			paragraphs++
+			if strings.Contains(tidied, text) {
+				kept++
+			}
+		})
+		if kept < paragraphs*9/10 {
+			t.Errorf("%s: only %d of %d paragraphs in main text", path, kept, paragraphs)
+		}
+	}
+}
+
+func TestMainText(t *testing.T) {
+	page, err := goquery.NewDocumentFromReader(strings.NewReader(`<!DOCTYPE html>
+<html>
+<body>
+<nav><ul><li><a href="/">Home</a></li><li><a href="/about">About us</a></li></ul></nav>
+<div id="cookie-banner"><p>We use cookies to make this site better, accept them all to continue.</p></div>
+<div class="wrapper">
+<div class="sidebar"><ul><li><a href="/a">Other posts about keeping bees</a></li></ul></div>
+<div class="post-content">
+<h1>Keeping bees</h1>
+<p>Bees need somewhere dry to live, out of the wind, with plenty of flowers nearby, and a keeper who checks on them every week or so through the summer.</p>
+<div>A hive is made of boxes stacked on top of one another, the brood box at the bottom and the supers, where honey is stored, above it.</div>
+<blockquote>The bee is more honoured than other animals, not because she labours, but because she labours for others.</blockquote>
+<pre>brood box: 11 frames, supers: 10 frames each, queen excluder between them</pre>
+<p>Honey is taken off at the end of the summer, leaving the bees enough to see them through the winter, along with a feed of sugar syrup if needed.</p>
+</div>
+</div>
+<footer><p>Copyright the bee society, all rights reserved, terms and conditions apply.</p></footer>
+</body>
+</html>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	main := mainText(page.Selection)
+	for _, want := range []string{"Keeping bees", "Bees need somewhere dry", "A hive is made of boxes", "The bee is more honoured", "brood box: 11 frames", "Honey is taken off"} {
+		if !strings.Contains(main, want) {
+			t.Errorf("main text is missing %q:\n%s", want, main)
+		}
+	}
+	for _, unwanted := range []string{"About us", "cookies", "Other posts", "Copyright"} {
+		if strings.Contains(main, unwanted) {
+			t.Errorf("main text has %q:\n%s", unwanted, main)
+		}
+	}
+}
+
+func TestPageTextFallback(t *testing.T) {
+	page, err := goquery.NewDocumentFromReader(strings.NewReader(`<html><body>
+<h1>Hello World</h1>
+<p class="description">This is a test page</p>
+<ul><li>one</li><li>two</li></ul>
+</body></html>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "Hello World\nThis is a test page\none\ntwo\n"
+	if got := pageText(page.Selection); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
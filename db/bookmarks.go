@@ -8,18 +8,20 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/blevesearch/bleve/v2"
-	"github.com/blevesearch/bleve/v2/analysis/lang/en"
+	"github.com/blevesearch/bleve/v2/search"
 	"github.com/blevesearch/bleve/v2/search/query"
 	"github.com/tardisx/linkwallet/content"
 	"github.com/tardisx/linkwallet/entity"
 
 	bolthold "github.com/timshannon/bolthold"
+	bolt "go.etcd.io/bbolt"
 )
 
 type BookmarkManager struct {
@@ -28,9 +30,74 @@ type BookmarkManager struct {
 }
 
 type SearchOptions struct {
+	Owner   uint64
 	All     bool
 	Query   string
 	Results int
+	// From is the number of results to skip, for paging.
+	From int
+	// Sort is the fields to sort the results by, as for
+	// bleve.SearchRequest.SortBy. The default is by relevance.
+	Sort []string
+	// Tags limits the search to bookmarks with all of these tags.
+	Tags []string
+	// Domain, if set, limits the search to bookmarks on this registrable
+	// domain.
+	Domain string
+	// Period, if set, limits the search to bookmarks created in this year,
+	// month or day, written as for after: in queries.
+	Period string
+	// Language, if set, limits the search to pages in this language, given
+	// as an ISO 639-1 code.
+	Language string
+	// PublicOnly limits the search to the owner's public bookmarks, those
+	// marked public or with one of PublicTags. Public searches are not
+	// counted in the owner's stats or kept in their search history.
+	PublicOnly bool
+	PublicTags []string
+	// Fuzziness is the most edits a word of the query can be from a word
+	// in a bookmark and still match it, if nothing matches the query as
+	// typed. 0 turns this off, along with suggesting corrections.
+	Fuzziness int
+	// Boosts weight matches in each field when ranking results.
+	Boosts entity.FieldBoosts
+	// Untracked searches, such as those made to suggest completions, are
+	// not counted in the owner's stats or kept in their search history.
+	Untracked bool
+}
+
+// facetSize is the number of most used tags and domains returned with
+// search results.
+const facetSize = 20
+
+// SearchResults are the bookmarks found by a search, and the counts of the
+// tags, domains and languages of all the bookmarks which matched. Timeline counts the
+// matches by the year they were created, or by month within the year of
+// the selected period.
+//
+// Fuzzy is set if nothing matched the query as typed, and the results are
+// from matching the words loosely instead. DidYouMean is then the query
+// with the words not in any bookmarks corrected, if any could be.
+//
+// Skipped is the number of hits left out of Hits because their bookmarks
+// are no longer in the database, so the hits of the next page start at
+// From + len(Hits) + Skipped.
+type SearchResults struct {
+	Hits       []entity.BookmarkSearchResult
+	Skipped    int
+	Total      uint64
+	Tags       []FacetCount
+	Domains    []FacetCount
+	Languages  []FacetCount
+	Timeline   []PeriodCount
+	Fuzzy      bool
+	DidYouMean []string
+}
+
+// FacetCount is the number of matching bookmarks with a particular term.
+type FacetCount struct {
+	Term  string
+	Count int
 }
 
 func NewBookmarkManager(db *DB) *BookmarkManager {
@@ -38,21 +105,26 @@ func NewBookmarkManager(db *DB) *BookmarkManager {
 }
 
 // AddBookmark adds a bookmark to the database. It returns an error
-// if this bookmark already exists (based on URL match).
+// if the owner already has this bookmark (based on URL match).
 // The entity.Bookmark ID field will be updated.
 func (m *BookmarkManager) AddBookmark(bm *entity.Bookmark) error {
 
+	if bm.Owner == 0 {
+		return errors.New("bookmark must have an owner")
+	}
+
 	if strings.Index(bm.URL, "https://") != 0 &&
 		strings.Index(bm.URL, "http://") != 0 {
 		return errors.New("URL must begin with http:// or https://")
 	}
 
 	existing := entity.Bookmark{}
-	err := m.db.store.FindOne(&existing, bolthold.Where("URL").Eq(bm.URL))
+	err := m.db.store.FindOne(&existing, bolthold.Where("URL").Eq(bm.URL).And("Owner").Eq(bm.Owner))
 	if err != bolthold.ErrNotFound {
 		return fmt.Errorf("bookmark already exists")
 	}
 	bm.TimestampCreated = time.Now()
+	bm.SetHost()
 	err = m.db.store.Insert(bolthold.NextSequence(), bm)
 	if err != nil {
 		return fmt.Errorf("addBookmark returned: %w", err)
@@ -61,7 +133,7 @@ func (m *BookmarkManager) AddBookmark(bm *entity.Bookmark) error {
 }
 
 func (m *BookmarkManager) DeleteBookmark(bm *entity.Bookmark) error {
-	err := m.db.store.FindOne(bm, bolthold.Where("URL").Eq(bm.URL))
+	err := m.db.store.FindOne(bm, bolthold.Where("URL").Eq(bm.URL).And("Owner").Eq(bm.Owner))
 	if err == bolthold.ErrNotFound {
 		return fmt.Errorf("bookmark does not exist")
 	}
@@ -69,7 +141,7 @@ func (m *BookmarkManager) DeleteBookmark(bm *entity.Bookmark) error {
 	// delete it
 	m.db.store.DeleteMatching(bm, bolthold.Where("ID").Eq(bm.ID))
 	// delete all the index entries
-	return m.db.bleve.Delete(fmt.Sprint(bm.ID))
+	return m.db.unindexBookmark(bm.ID)
 }
 
 // ListBookmarks returns all bookmarks.
@@ -83,10 +155,10 @@ func (m *BookmarkManager) DeleteBookmark(bm *entity.Bookmark) error {
 // 	return bookmarks, nil
 // }
 
-// ExportBookmarks exports all bookmarks to an io.Writer
-func (m *BookmarkManager) ExportBookmarks(w io.Writer) error {
+// ExportBookmarks exports all of a user's bookmarks to an io.Writer
+func (m *BookmarkManager) ExportBookmarks(w io.Writer, owner uint64) error {
 	bms := []entity.Bookmark{}
-	err := m.db.store.Find(&bms, &bolthold.Query{})
+	err := m.db.store.Find(&bms, bolthold.Where("Owner").Eq(owner))
 	if err != nil {
 		return fmt.Errorf("could not export bookmarks: %w", err)
 	}
@@ -104,65 +176,247 @@ func (m *BookmarkManager) SaveBookmark(bm *entity.Bookmark) error {
 	return nil
 }
 
-func (m *BookmarkManager) LoadBookmarkByID(id uint64) entity.Bookmark {
-	// log.Printf("loading %v", ids)
-	ret := entity.Bookmark{}
-	err := m.db.store.Get(id, &ret)
+// loadHits loads the bookmarks of search hits in one transaction, keyed
+// by their document IDs. A hit whose bookmark is not in the database, as
+// the index is out of step with it, is left out and logged.
+func (m *BookmarkManager) loadHits(hits search.DocumentMatchCollection) (map[string]entity.Bookmark, error) {
+	bookmarks := make(map[string]entity.Bookmark, len(hits))
+	missing := []string{}
+	err := m.db.store.Bolt().View(func(tx *bolt.Tx) error {
+		for _, dm := range hits {
+			id, err := strconv.ParseUint(dm.ID, 10, 64)
+			if err != nil {
+				missing = append(missing, dm.ID)
+				continue
+			}
+			bm := entity.Bookmark{}
+			err = m.db.store.TxGet(tx, id, &bm)
+			if err == bolthold.ErrNotFound {
+				missing = append(missing, dm.ID)
+				continue
+			} else if err != nil {
+				return fmt.Errorf("could not load bookmark %d: %w", id, err)
+			}
+			bookmarks[dm.ID] = bm
+		}
+		return nil
+	})
 	if err != nil {
-		panic(err)
+		return nil, err
+	}
+	if len(missing) > 0 {
+		log.Printf("skipping search hits for bookmarks which do not exist: %s", strings.Join(missing, ", "))
 	}
-	return ret
+	return bookmarks, nil
 }
 
-func (m *BookmarkManager) Search(opts SearchOptions) ([]entity.BookmarkSearchResult, error) {
-	found := []entity.BookmarkSearchResult{}
-	if opts.All && opts.Query != "" {
-		panic("can't fetch all with query")
+// LoadBookmarkForOwner loads a bookmark, returning an error if it does not
+// exist or belongs to a different user.
+func (m *BookmarkManager) LoadBookmarkForOwner(owner uint64, id uint64) (entity.Bookmark, error) {
+	bm := entity.Bookmark{}
+	err := m.db.store.Get(id, &bm)
+	if err == bolthold.ErrNotFound || (err == nil && bm.Owner != owner) {
+		return entity.Bookmark{}, fmt.Errorf("bookmark does not exist")
+	} else if err != nil {
+		return entity.Bookmark{}, fmt.Errorf("could not load bookmark: %w", err)
 	}
+	return bm, nil
+}
 
-	var q query.Query
-
-	if opts.All {
-		q = bleve.NewMatchAllQuery()
-	} else {
-		mq := bleve.NewMatchQuery(opts.Query)
-		mq.Analyzer = en.AnalyzerName
-		tq := bleve.NewTermQuery(opts.Query)
+// Search searches the bookmarks of opts.Owner. The query is in the
+// language described in query.go, a QueryError is returned if it cannot
+// be parsed.
+func (m *BookmarkManager) Search(opts SearchOptions) (SearchResults, error) {
+	start := time.Now()
+	found := SearchResults{Hits: []entity.BookmarkSearchResult{}}
+	periods := timelinePeriods(opts.Period, start)
 
-		q = bleve.NewDisjunctionQuery(mq, tq)
-	}
+	run := func(fuzziness int) (*bleve.SearchResult, error) {
+		q, err := searchQuery(opts, fuzziness)
+		if err != nil {
+			return nil, err
+		}
+		req := bleve.NewSearchRequest(q)
+		if opts.Results > 0 {
+			req.Size = opts.Results
+		}
+		req.From = opts.From
+		if len(opts.Sort) > 0 {
+			req.SortBy(opts.Sort)
+		}
+		req.Highlight = bleve.NewHighlightWithStyle("html")
+		req.AddFacet("tags", bleve.NewFacetRequest("Tags", facetSize))
+		req.AddFacet("domains", bleve.NewFacetRequest("Domain", facetSize))
+		req.AddFacet("languages", bleve.NewFacetRequest("Info.Language", facetSize))
+		req.AddFacet("timeline", timelineFacet(periods))
 
-	req := bleve.NewSearchRequest(q)
-	if opts.Results > 0 {
-		req.Size = opts.Results
+		sr, err := m.db.bleve.Search(req)
+		if err != nil {
+			return nil, fmt.Errorf("search failed: %w", err)
+		}
+		return sr, nil
 	}
-	req.Highlight = bleve.NewHighlightWithStyle("html")
 
-	sr, err := m.db.bleve.Search(req)
+	sr, err := run(0)
 	if err != nil {
-		panic(err)
+		return found, err
+	}
+	if sr.Total == 0 && opts.Fuzziness > 0 && !opts.All {
+		found.DidYouMean, err = m.corrections(opts.Owner, opts.Query, opts.Fuzziness)
+		if err != nil {
+			return found, err
+		}
+		sr, err = run(opts.Fuzziness)
+		if err != nil {
+			return found, err
+		}
+		found.Fuzzy = sr.Total > 0
 	}
 	// log.Printf("%#v", m.db.bleve.StatsMap())
 
+	found.Total = sr.Total
+	found.Tags = facetCounts(sr.Facets["tags"])
+	found.Domains = facetCounts(sr.Facets["domains"])
+	found.Languages = facetCounts(sr.Facets["languages"])
+	found.Timeline = timelineCounts(periods, sr.Facets["timeline"])
+
+	bookmarks, err := m.loadHits(sr.Hits)
+	if err != nil {
+		return found, err
+	}
 	if sr.Total > 0 {
 		for _, dm := range sr.Hits {
-
-			id, _ := strconv.ParseUint(dm.ID, 10, 64)
-			bm := m.LoadBookmarkByID(id)
+			bm, ok := bookmarks[dm.ID]
+			if !ok {
+				found.Skipped++
+				continue
+			}
 			bsr := entity.BookmarkSearchResult{
 				Bookmark:  bm,
 				Score:     dm.Score,
 				Highlight: template.HTML(strings.Join(dm.Fragments["Info.RawText"], "\n")),
+				Fragments: map[string][]template.HTML{},
+			}
+			// the fragments are escaped, apart from the marks
+			for field, fragments := range dm.Fragments {
+				for _, f := range fragments {
+					bsr.Fragments[field] = append(bsr.Fragments[field], template.HTML(f))
+				}
 			}
-			found = append(found, bsr)
+			found.Hits = append(found.Hits, bsr)
 		}
 	}
 
-	m.db.IncrementSearches()
+	if !opts.PublicOnly && !opts.Untracked {
+		m.db.IncrementSearches(opts.Owner)
+		if !opts.All {
+			err = m.db.RecordSearch(entity.SearchRecord{Owner: opts.Owner, Query: opts.Query, Hits: found.Total,
+				Latency: time.Since(start), Timestamp: start})
+			if err != nil {
+				log.Printf("could not record search: %s", err)
+			}
+		}
+	}
 
 	return found, nil
 }
 
+// searchQuery builds the bleve query for a search, with words matching
+// up to fuzziness edits away.
+func searchQuery(opts SearchOptions, fuzziness int) (query.Query, error) {
+	if opts.All && opts.Query != "" {
+		panic("can't fetch all with query")
+	}
+
+	var q query.Query
+	if opts.All {
+		q = bleve.NewMatchAllQuery()
+	} else {
+		var err error
+		q, err = parseQueryWith(opts.Query, queryOptions{fuzziness: fuzziness, boosts: opts.Boosts})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	q = bleve.NewConjunctionQuery(q, ownerQuery(opts.Owner))
+	for _, tag := range opts.Tags {
+		q = bleve.NewConjunctionQuery(q, tagQuery(tag))
+	}
+	if opts.Domain != "" {
+		q = bleve.NewConjunctionQuery(q, domainQuery(opts.Domain))
+	}
+	if opts.Language != "" {
+		q = bleve.NewConjunctionQuery(q, languageQuery(opts.Language))
+	}
+	if opts.Period != "" {
+		start, end, err := periodRange(opts.Period)
+		if err != nil {
+			return nil, err
+		}
+		q = bleve.NewConjunctionQuery(q, periodQuery(start, end))
+	}
+	if opts.PublicOnly {
+		q = bleve.NewConjunctionQuery(q, publicQuery(opts.PublicTags))
+	}
+	return q, nil
+}
+
+// Count returns the number of bookmarks matching a search. It is not
+// counted in the owner's stats.
+func (m *BookmarkManager) Count(opts SearchOptions) (uint64, error) {
+	q, err := searchQuery(opts, 0)
+	if err != nil {
+		return 0, err
+	}
+	req := bleve.NewSearchRequestOptions(q, 0, 0, false)
+	sr, err := m.db.bleve.Search(req)
+	if err != nil {
+		return 0, fmt.Errorf("search failed: %w", err)
+	}
+	return sr.Total, nil
+}
+
+// MatchingBookmarks returns the bookmarks matching a search, in the order
+// given by opts.Sort. It returns every one of them unless opts.Results is
+// set, and ignores opts.From. It is not counted in the owner's stats.
+func (m *BookmarkManager) MatchingBookmarks(opts SearchOptions) ([]entity.Bookmark, error) {
+	q, err := searchQuery(opts, 0)
+	if err != nil {
+		return nil, err
+	}
+	total, err := m.Count(opts)
+	if err != nil {
+		return nil, err
+	}
+	bookmarks := []entity.Bookmark{}
+	if total == 0 {
+		return bookmarks, nil
+	}
+	size := int(total)
+	if opts.Results > 0 && opts.Results < size {
+		size = opts.Results
+	}
+	req := bleve.NewSearchRequestOptions(q, size, 0, false)
+	if len(opts.Sort) > 0 {
+		req.SortBy(opts.Sort)
+	}
+	sr, err := m.db.bleve.Search(req)
+	if err != nil {
+		return nil, fmt.Errorf("search failed: %w", err)
+	}
+	loaded, err := m.loadHits(sr.Hits)
+	if err != nil {
+		return nil, err
+	}
+	for _, dm := range sr.Hits {
+		if bm, ok := loaded[dm.ID]; ok {
+			bookmarks = append(bookmarks, bm)
+		}
+	}
+	return bookmarks, nil
+}
+
 func (m *BookmarkManager) ScrapeAndIndex(bm *entity.Bookmark) error {
 
 	log.Printf("Start scrape for %s", bm.URL)
@@ -185,7 +439,8 @@ func (m *BookmarkManager) ScrapeAndIndex(bm *entity.Bookmark) error {
 
 func (m *BookmarkManager) UpdateIndexForBookmark(bm *entity.Bookmark) {
 	log.Printf("inserting into bleve data for %s", bm.URL)
-	err := m.db.bleve.Index(fmt.Sprint(bm.ID), bm)
+	bm.SetHost()
+	err := m.db.indexBookmark(*bm)
 	if err != nil {
 		panic(err)
 	}
@@ -262,8 +517,53 @@ func (m *BookmarkManager) UpdateContent() {
 	}
 }
 
-// AllBookmarks returns all bookmarks. It does not use the index for this
+// BookmarksForOwner returns all of a user's bookmarks, newest first. It
+// does not use the index for this operation.
+func (m *BookmarkManager) BookmarksForOwner(owner uint64) ([]entity.Bookmark, error) {
+	return m.db.bookmarksForOwner(owner)
+}
+
+func (db *DB) bookmarksForOwner(owner uint64) ([]entity.Bookmark, error) {
+	bookmarks := []entity.Bookmark{}
+	err := db.store.Find(&bookmarks, bolthold.Where("Owner").Eq(owner))
+	if err != nil {
+		return nil, fmt.Errorf("could not load bookmarks: %w", err)
+	}
+	sort.Slice(bookmarks, func(i, j int) bool { return bookmarks[i].TimestampCreated.After(bookmarks[j].TimestampCreated) })
+	return bookmarks, nil
+}
+
+// Domains returns the domains of the owner's bookmarks, with the number of
+// bookmarks on each, most used first. It does not use the index for this
 // operation.
+func (m *BookmarkManager) Domains(owner uint64) ([]FacetCount, error) {
+	bookmarks, err := m.db.bookmarksForOwner(owner)
+	if err != nil {
+		return nil, err
+	}
+	counts := map[string]int{}
+	for _, bm := range bookmarks {
+		// bookmarks saved before domains were recorded don't have one yet
+		bm.SetHost()
+		if bm.Domain != "" {
+			counts[bm.Domain]++
+		}
+	}
+	domains := []FacetCount{}
+	for domain, count := range counts {
+		domains = append(domains, FacetCount{Term: domain, Count: count})
+	}
+	sort.Slice(domains, func(i, j int) bool {
+		if domains[i].Count != domains[j].Count {
+			return domains[i].Count > domains[j].Count
+		}
+		return domains[i].Term < domains[j].Term
+	})
+	return domains, nil
+}
+
+// AllBookmarks returns all bookmarks, regardless of owner. It does not use
+// the index for this operation.
 func (m *BookmarkManager) AllBookmarks() ([]entity.Bookmark, error) {
 	bookmarks := make([]entity.Bookmark, 0)
 	err := m.db.store.Find(&bookmarks, &bolthold.Query{})
@@ -273,9 +573,11 @@ func (m *BookmarkManager) AllBookmarks() ([]entity.Bookmark, error) {
 	return bookmarks, nil
 }
 
-func (m *BookmarkManager) Stats() (entity.DBStats, error) {
+// Stats returns the stats for a user. The file and index sizes are for
+// the whole database.
+func (m *BookmarkManager) Stats(owner uint64) (entity.DBStats, error) {
 	stats := entity.DBStats{}
-	err := m.db.store.Get("stats", &stats)
+	err := m.db.store.Get(owner, &stats)
 	if err != nil && err != bolthold.ErrNotFound {
 		return stats, fmt.Errorf("could not load stats: %s", err)
 	}
@@ -285,7 +587,11 @@ func (m *BookmarkManager) Stats() (entity.DBStats, error) {
 		return stats, fmt.Errorf("could not load db file size: %s", err)
 	}
 	stats.FileSize = int(fi.Size())
-	indexSize, err := getBleveIndexSize(m.db.file + ".bleve")
+	// the index moves when it is rebuilt
+	m.db.indexMu.Lock()
+	blevePath := m.db.blevePath
+	m.db.indexMu.Unlock()
+	indexSize, err := getBleveIndexSize(blevePath)
 	if err != nil {
 		return entity.DBStats{}, err
 	}
@@ -294,6 +600,42 @@ func (m *BookmarkManager) Stats() (entity.DBStats, error) {
 	return stats, nil
 }
 
+// ownerQuery returns a query matching only bookmarks belonging to owner.
+func ownerQuery(owner uint64) query.Query {
+	id := float64(owner)
+	inclusive := true
+	q := bleve.NewNumericRangeInclusiveQuery(&id, &id, &inclusive, &inclusive)
+	q.SetField("Owner")
+	return q
+}
+
+// tagQuery returns a query matching bookmarks with the tag, which are all
+// lower case.
+func tagQuery(tag string) query.Query {
+	q := bleve.NewTermQuery(strings.ToLower(tag))
+	q.SetField("Tags")
+	return q
+}
+
+// domainQuery returns a query matching bookmarks on the registrable domain.
+func domainQuery(domain string) query.Query {
+	q := bleve.NewTermQuery(strings.ToLower(domain))
+	q.SetField("Domain")
+	return q
+}
+
+// publicQuery returns a query matching bookmarks which are marked public,
+// or have one of the public tags.
+func publicQuery(publicTags []string) query.Query {
+	pq := bleve.NewBoolFieldQuery(true)
+	pq.SetField("Public")
+	dq := bleve.NewDisjunctionQuery(pq)
+	for _, tag := range publicTags {
+		dq.AddQuery(tagQuery(tag))
+	}
+	return dq
+}
+
 func getBleveIndexSize(path string) (int64, error) {
 	var size int64
 	err := filepath.Walk(path, func(_ string, info os.FileInfo, err error) error {
@@ -307,3 +649,15 @@ func getBleveIndexSize(path string) (int64, error) {
 	})
 	return size, err
 }
+
+// facetCounts converts the terms of a facet result, which may be missing.
+func facetCounts(f *search.FacetResult) []FacetCount {
+	counts := []FacetCount{}
+	if f == nil || f.Terms == nil {
+		return counts
+	}
+	for _, t := range f.Terms.Terms() {
+		counts = append(counts, FacetCount{Term: t.Term, Count: t.Count})
+	}
+	return counts
+}
@@ -4,12 +4,18 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"math/rand"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"slices"
+	"strconv"
+	"strings"
 	"testing"
 
+	"github.com/blevesearch/bleve/v2"
 	"github.com/tardisx/linkwallet/entity"
+	bolthold "github.com/timshannon/bolthold"
 )
 
 var bmm *BookmarkManager
@@ -54,7 +60,7 @@ func importCorpora(bmm BookmarkManager) {
 
 	for i := 1; i <= 100; i++ {
 		url := fmt.Sprintf("%s/%d", ts.URL, i)
-		bm := entity.Bookmark{URL: url}
+		bm := entity.Bookmark{URL: url, Owner: 1}
 		bmm.AddBookmark(&bm)
 		bmm.ScrapeAndIndex(&bm)
 	}
@@ -73,7 +79,7 @@ func BenchmarkOneWordSearch(b *testing.B) {
 	bmm := NewBookmarkManager(&dbh)
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		bmm.Search(SearchOptions{Query: "hello"})
+		bmm.Search(SearchOptions{Owner: 1, Query: "hello"})
 	}
 }
 
@@ -84,7 +90,7 @@ func BenchmarkTwoWordSearch(b *testing.B) {
 	bmm := NewBookmarkManager(&dbh)
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		bmm.Search(SearchOptions{Query: "human relate"})
+		bmm.Search(SearchOptions{Owner: 1, Query: "human relate"})
 	}
 }
 
@@ -95,6 +101,389 @@ func BenchmarkThreeWordSearch(b *testing.B) {
 	bmm := NewBookmarkManager(&dbh)
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		bmm.Search(SearchOptions{Query: "human wiki editor"})
+		bmm.Search(SearchOptions{Owner: 1, Query: "human wiki editor"})
 	}
 }
+
+func TestSearchTagFacets(t *testing.T) {
+	db := newTestDB(t)
+	bmm := NewBookmarkManager(db)
+
+	for i, tags := range [][]string{{"golang", "web"}, {"golang"}, {"rust", "web"}, {"golang", "machine learning"}} {
+		bm := entity.Bookmark{URL: fmt.Sprintf("https://example.com/%d", i), Owner: 1, Tags: tags}
+		err := bmm.AddBookmark(&bm)
+		if err != nil {
+			t.Fatal(err)
+		}
+		bmm.UpdateIndexForBookmark(&bm)
+	}
+	other := entity.Bookmark{URL: "https://example.com/other", Owner: 2, Tags: []string{"golang"}}
+	bmm.AddBookmark(&other)
+	bmm.UpdateIndexForBookmark(&other)
+
+	counts := func(res SearchResults) map[string]int {
+		m := map[string]int{}
+		for _, f := range res.Tags {
+			m[f.Term] = f.Count
+		}
+		return m
+	}
+
+	res, err := bmm.Search(SearchOptions{Owner: 1, All: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Total != 4 || len(res.Hits) != 4 {
+		t.Errorf("expected 4 results, got %d (%d hits)", res.Total, len(res.Hits))
+	}
+	if res.Tags[0] != (FacetCount{Term: "golang", Count: 3}) {
+		t.Errorf("expected golang to be the most used tag, got %v", res.Tags)
+	}
+	got := counts(res)
+	if got["web"] != 2 || got["rust"] != 1 || got["machine learning"] != 1 {
+		t.Errorf("wrong tag counts %v", got)
+	}
+
+	res, err = bmm.Search(SearchOptions{Owner: 1, All: true, Tags: []string{"golang", "web"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Total != 1 || res.Hits[0].Bookmark.URL != "https://example.com/0" {
+		t.Errorf("expected only the bookmark with both tags, got %v", res.Hits)
+	}
+	got = counts(res)
+	if len(got) != 2 || got["golang"] != 1 || got["web"] != 1 {
+		t.Errorf("facets should only count the filtered results, got %v", got)
+	}
+}
+
+func TestDomains(t *testing.T) {
+	db := newTestDB(t)
+	bmm := NewBookmarkManager(db)
+
+	for _, url := range []string{"https://github.com/a", "https://gist.github.com/b", "https://www.bbc.co.uk/news", "https://example.com/"} {
+		bm := entity.Bookmark{URL: url, Owner: 1}
+		err := bmm.AddBookmark(&bm)
+		if err != nil {
+			t.Fatal(err)
+		}
+		bmm.UpdateIndexForBookmark(&bm)
+	}
+
+	domains, err := bmm.Domains(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []FacetCount{{Term: "github.com", Count: 2}, {Term: "bbc.co.uk", Count: 1}, {Term: "example.com", Count: 1}}
+	if !slices.Equal(domains, want) {
+		t.Errorf("got %v, want %v", domains, want)
+	}
+
+	res, err := bmm.Search(SearchOptions{Owner: 1, All: true, Domain: "github.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Total != 2 {
+		t.Errorf("expected 2 bookmarks on github.com, got %d", res.Total)
+	}
+	if len(res.Domains) != 1 || res.Domains[0] != (FacetCount{Term: "github.com", Count: 2}) {
+		t.Errorf("wrong domain facet %v", res.Domains)
+	}
+}
+
+func TestSearchSortAndPaging(t *testing.T) {
+	db := newTestDB(t)
+	bmm := NewBookmarkManager(db)
+
+	titles := []string{"banana", "Apple", "cherry", "apricot", "Blueberry"}
+	for i, title := range titles {
+		bm := entity.Bookmark{URL: fmt.Sprintf("https://example.com/%d", i), Owner: 1, Info: entity.PageInfo{Title: title, Size: (i + 1) * 100}}
+		err := bmm.AddBookmark(&bm)
+		if err != nil {
+			t.Fatal(err)
+		}
+		bmm.UpdateIndexForBookmark(&bm)
+	}
+
+	page := func(sort string, from int) []string {
+		res, err := bmm.Search(SearchOptions{Owner: 1, All: true, Sort: []string{sort, "_id"}, Results: 2, From: from})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Total != 5 {
+			t.Errorf("expected a total of 5, got %d", res.Total)
+		}
+		found := []string{}
+		for _, hit := range res.Hits {
+			found = append(found, hit.Bookmark.Info.Title)
+		}
+		return found
+	}
+
+	// titles sort regardless of case
+	got := append(append(page("Info.TitleSort", 0), page("Info.TitleSort", 2)...), page("Info.TitleSort", 4)...)
+	want := []string{"Apple", "apricot", "banana", "Blueberry", "cherry"}
+	if !slices.Equal(got, want) {
+		t.Errorf("sorted by title got %v, want %v", got, want)
+	}
+
+	got = page("-Info.Size", 0)
+	want = []string{"Blueberry", "apricot"}
+	if !slices.Equal(got, want) {
+		t.Errorf("sorted by size got %v, want %v", got, want)
+	}
+}
+
+func TestSearchBoostsAndHighlights(t *testing.T) {
+	db := newTestDB(t)
+	bmm := NewBookmarkManager(db)
+
+	for _, bm := range []entity.Bookmark{
+		{URL: "https://example.com/text", Owner: 1, Info: entity.PageInfo{Title: "Weekly notes",
+			RawText: "compilers compilers compilers, and a long ramble about other compilers"}},
+		{URL: "https://example.com/title", Owner: 1, Tags: []string{"books"}, Info: entity.PageInfo{Title: "Compilers: principles, techniques and tools, second edition",
+			RawText: "the dragon book, a classic text which covers lexing, parsing, type checking and code generation in great detail"}},
+	} {
+		err := bmm.AddBookmark(&bm)
+		if err != nil {
+			t.Fatal(err)
+		}
+		bmm.UpdateIndexForBookmark(&bm)
+	}
+
+	first := func(boosts entity.FieldBoosts) entity.BookmarkSearchResult {
+		res, err := bmm.Search(SearchOptions{Owner: 1, Query: "compilers", Boosts: boosts})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Total != 2 {
+			t.Fatalf("expected both bookmarks, got %d", res.Total)
+		}
+		return res.Hits[0]
+	}
+
+	hit := first(DefaultBoosts)
+	if hit.Bookmark.URL != "https://example.com/title" {
+		t.Errorf("expected the title match first, got %s", hit.Bookmark.URL)
+	}
+	if hit.HighlightedTitle() != "<mark>Compilers</mark>: principles, techniques and tools, second edition" {
+		t.Errorf("title not highlighted: %q", hit.HighlightedTitle())
+	}
+
+	hit = first(entity.FieldBoosts{RawText: 5})
+	if hit.Bookmark.URL != "https://example.com/text" {
+		t.Errorf("expected the page text match first, got %s", hit.Bookmark.URL)
+	}
+	if len(hit.Fragments["Info.RawText"]) == 0 || hit.HighlightedTitle() != "Weekly notes" {
+		t.Errorf("wrong fragments %v", hit.Fragments)
+	}
+}
+
+func TestSearchSkipsMissingBookmarks(t *testing.T) {
+	db := newTestDB(t)
+	bmm := NewBookmarkManager(db)
+
+	bookmarks := []entity.Bookmark{}
+	for i := 0; i < 3; i++ {
+		bm := entity.Bookmark{URL: fmt.Sprintf("https://example.com/%d", i), Owner: 1, Tags: []string{"kubernetes"},
+			Info: entity.PageInfo{Title: "Kubernetes operators", RawText: "writing operators for kubernetes"}}
+		err := bmm.AddBookmark(&bm)
+		if err != nil {
+			t.Fatal(err)
+		}
+		bmm.UpdateIndexForBookmark(&bm)
+		bookmarks = append(bookmarks, bm)
+	}
+	// so that the words above say something about the topic
+	other := entity.Bookmark{URL: "https://example.com/bread", Owner: 1, Info: entity.PageInfo{Title: "Baking bread"}}
+	err := bmm.AddBookmark(&other)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bmm.UpdateIndexForBookmark(&other)
+	// the index still has the bookmark the database has lost
+	err = db.store.Delete(bookmarks[1].ID, &entity.Bookmark{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := bmm.Search(SearchOptions{Owner: 1, Query: "operators"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Hits) != 2 || res.Skipped != 1 {
+		t.Errorf("expected the 2 bookmarks which exist and 1 skipped, got %d and %d", len(res.Hits), res.Skipped)
+	}
+	for _, hit := range res.Hits {
+		if hit.Bookmark.ID == bookmarks[1].ID || hit.Bookmark.URL == "" {
+			t.Errorf("missing bookmark returned %+v", hit.Bookmark)
+		}
+	}
+
+	matching, err := bmm.MatchingBookmarks(SearchOptions{Owner: 1, Tags: []string{"kubernetes"}, All: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matching) != 2 {
+		t.Errorf("expected the 2 matching bookmarks which exist, got %d", len(matching))
+	}
+
+	related, err := bmm.Related(bookmarks[0], 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(related) != 1 || related[0].Bookmark.ID != bookmarks[2].ID {
+		t.Errorf("expected only the other bookmark which exists as related, got %+v", related)
+	}
+	for _, r := range related {
+		if r.Bookmark.ID == bookmarks[1].ID || r.Bookmark.URL == "" {
+			t.Errorf("missing bookmark returned as related %+v", r.Bookmark)
+		}
+	}
+}
+
+var generatedDB string = "/tmp/generated.db"
+
+// generatedSize is the number of bookmarks in the generated corpus.
+const generatedSize = 20000
+
+// createGeneratedIfNecessary creates a database of bookmarks with made up
+// words, too many to scrape, in one transaction and index batches.
+func createGeneratedIfNecessary(b *testing.B) {
+	_, err := os.Stat(generatedDB)
+	if err == nil {
+		return
+	}
+	log.Printf("creating generated corpus")
+	dbh := DB{}
+	_, err = dbh.Open(generatedDB)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer dbh.Close()
+
+	r := rand.New(rand.NewSource(1))
+	syllables := []string{"ka", "to", "ri", "ne", "su", "mo", "la", "pi", "de", "gu", "ven", "tor", "lin", "bar", "sek"}
+	words := make([]string, 5000)
+	for i := range words {
+		for n := 2 + r.Intn(3); n > 0; n-- {
+			words[i] += syllables[r.Intn(len(syllables))]
+		}
+	}
+	// a few words are common, most are rare
+	text := func(n int) string {
+		out := make([]string, n)
+		for i := range out {
+			out[i] = words[int(float64(len(words))*r.Float64()*r.Float64())]
+		}
+		return strings.Join(out, " ")
+	}
+
+	txn, err := dbh.store.Bolt().Begin(true)
+	if err != nil {
+		b.Fatal(err)
+	}
+	batch := dbh.bleve.NewBatch()
+	for i := 0; i < generatedSize; i++ {
+		bm := entity.Bookmark{
+			URL:   fmt.Sprintf("https://example.com/%d", i),
+			Owner: 1,
+			Tags:  []string{words[r.Intn(50)]},
+			Info:  entity.PageInfo{Title: text(6), RawText: text(300)},
+		}
+		err = dbh.store.TxInsert(txn, bolthold.NextSequence(), &bm)
+		if err != nil {
+			b.Fatal(err)
+		}
+		err = batch.Index(fmt.Sprint(bm.ID), bookmarkDocument(dbh.index, bm))
+		if err != nil {
+			b.Fatal(err)
+		}
+		if batch.Size() >= reindexBatchSize {
+			err = dbh.bleve.Batch(batch)
+			if err != nil {
+				b.Fatal(err)
+			}
+			batch.Reset()
+		}
+	}
+	err = dbh.bleve.Batch(batch)
+	if err != nil {
+		b.Fatal(err)
+	}
+	err = txn.Commit()
+	if err != nil {
+		b.Fatal(err)
+	}
+	log.Printf("finished creating generated corpus")
+}
+
+// BenchmarkSearchGenerated searches the generated corpus for a common word,
+// loading pages of results of different sizes.
+func BenchmarkSearchGenerated(b *testing.B) {
+	createGeneratedIfNecessary(b)
+	dbh := DB{}
+	_, err := dbh.Open(generatedDB)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer dbh.Close()
+	bmm := NewBookmarkManager(&dbh)
+
+	res, err := bmm.Search(SearchOptions{Owner: 1, Query: "kato", Untracked: true})
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Logf("%d bookmarks found", res.Total)
+
+	for _, size := range []int{10, 100, 1000} {
+		b.Run(fmt.Sprintf("%d results", size), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				_, err := bmm.Search(SearchOptions{Owner: 1, Query: "kato", Results: size, Untracked: true})
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkLoadHits compares loading the bookmarks of search hits in one
+// transaction with loading each in its own.
+func BenchmarkLoadHits(b *testing.B) {
+	createGeneratedIfNecessary(b)
+	dbh := DB{}
+	_, err := dbh.Open(generatedDB)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer dbh.Close()
+	bmm := NewBookmarkManager(&dbh)
+
+	req := bleve.NewSearchRequestOptions(bleve.NewMatchAllQuery(), 1000, 0, false)
+	sr, err := dbh.bleve.Search(req)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.Run("one transaction", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			_, err := bmm.loadHits(sr.Hits)
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("transaction each", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			for _, dm := range sr.Hits {
+				id, _ := strconv.ParseUint(dm.ID, 10, 64)
+				bm := entity.Bookmark{}
+				err := dbh.store.Get(id, &bm)
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+	})
+}
@@ -8,6 +8,17 @@ import (
 	bolthold "github.com/timshannon/bolthold"
 )
 
+// configVersion is the version of newly saved configs.
+const configVersion = 3
+
+// DefaultFuzzyDistance is the number of typos allowed in search words
+// unless the user chooses otherwise.
+const DefaultFuzzyDistance = 1
+
+// DefaultBoosts are the weights of matches in each field unless the user
+// chooses otherwise.
+var DefaultBoosts = entity.FieldBoosts{Title: 3, Tags: 2, URL: 1.5, RawText: 1}
+
 type ConfigManager struct {
 	db *DB
 }
@@ -16,15 +27,25 @@ func NewConfigManager(db *DB) *ConfigManager {
 	return &ConfigManager{db: db}
 }
 
-func (cmm *ConfigManager) LoadConfig() (entity.Config, error) {
+// LoadConfig loads the config for a user, or the default config if they
+// have not saved one yet.
+func (cmm *ConfigManager) LoadConfig(owner uint64) (entity.Config, error) {
 	config := entity.Config{}
-	err := cmm.db.store.FindOne(&config, &bolthold.Query{})
+	err := cmm.db.store.Get(owner, &config)
 	if err == nil {
-		if config.Version == 1 {
-			return config, nil
-		} else {
+		if config.Version < 1 || config.Version > configVersion {
 			return entity.Config{}, fmt.Errorf("failed to load config - wrong version %d", config.Version)
 		}
+		if config.Version < 2 {
+			// version 2 added FuzzyDistance
+			config.FuzzyDistance = DefaultFuzzyDistance
+		}
+		if config.Version < 3 {
+			// version 3 added Boosts
+			config.Boosts = DefaultBoosts
+		}
+		config.Version = configVersion
+		return config, nil
 	} else if err == bolthold.ErrNotFound {
 		log.Printf("using default config")
 		return cmm.DefaultConfig(), nil
@@ -35,13 +56,15 @@ func (cmm *ConfigManager) LoadConfig() (entity.Config, error) {
 
 func (cmm *ConfigManager) DefaultConfig() entity.Config {
 	return entity.Config{
-		BaseURL: "http://localhost:8080",
-		Version: 1,
+		BaseURL:       "http://localhost:8080",
+		FuzzyDistance: DefaultFuzzyDistance,
+		Boosts:        DefaultBoosts,
+		Version:       configVersion,
 	}
 }
 
-func (cmm *ConfigManager) SaveConfig(conf *entity.Config) error {
-	err := cmm.db.store.Upsert("config", conf)
+func (cmm *ConfigManager) SaveConfig(owner uint64, conf *entity.Config) error {
+	err := cmm.db.store.Upsert(owner, conf)
 	if err != nil {
 		return fmt.Errorf("could not save config: %w", err)
 	}
@@ -0,0 +1,36 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/tardisx/linkwallet/entity"
+)
+
+func TestLoadConfigMigrates(t *testing.T) {
+	db := newTestDB(t)
+	cmm := NewConfigManager(db)
+
+	// as saved before typos were allowed
+	old := entity.Config{BaseURL: "https://links.example.com", Version: 1}
+	err := cmm.SaveConfig(1, &old)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config, err := cmm.LoadConfig(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Version != configVersion || config.FuzzyDistance != DefaultFuzzyDistance || config.Boosts != DefaultBoosts || config.BaseURL != old.BaseURL {
+		t.Errorf("config not migrated: %+v", config)
+	}
+
+	config.FuzzyDistance = 0
+	err = cmm.SaveConfig(1, &config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config, _ = cmm.LoadConfig(1)
+	if config.FuzzyDistance != 0 {
+		t.Errorf("turning typos off was not kept: %+v", config)
+	}
+}
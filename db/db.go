@@ -2,12 +2,17 @@ package db
 
 import (
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/blevesearch/bleve/v2"
 
+	"github.com/blevesearch/bleve/v2/analysis/analyzer/custom"
 	"github.com/blevesearch/bleve/v2/analysis/analyzer/keyword"
+	"github.com/blevesearch/bleve/v2/analysis/analyzer/standard"
 	"github.com/blevesearch/bleve/v2/analysis/lang/en"
+	"github.com/blevesearch/bleve/v2/analysis/token/lowercase"
+	"github.com/blevesearch/bleve/v2/analysis/tokenizer/single"
 	"github.com/blevesearch/bleve/v2/mapping"
 	"github.com/tardisx/linkwallet/entity"
 	bolthold "github.com/timshannon/bolthold"
@@ -16,7 +21,17 @@ import (
 type DB struct {
 	store *bolthold.Store
 	file  string
-	bleve bleve.Index
+	// bleve serves searches from index, the index at blevePath, and lets
+	// it be swapped for a rebuilt one.
+	bleve     bleve.IndexAlias
+	index     bleve.Index
+	blevePath string
+	// indexMu is held while indexing a bookmark. While the index is being
+	// rebuilt, changed holds the IDs of the bookmarks indexed or removed.
+	indexMu    sync.Mutex
+	changed    map[uint64]bool
+	reindexing sync.WaitGroup
+	stop       chan struct{}
 }
 
 // Open opens the bookmark boltdb, and the bleve index. It returns
@@ -33,7 +48,12 @@ func (db *DB) Open(path string) (bool, error) {
 	}
 
 	blevePath := path + ".bleve"
+	err = finishReindex(blevePath)
+	if err != nil {
+		return false, fmt.Errorf("cannot finish rebuilding bleve '%s' - %s", path, err)
+	}
 
+	reindexNeeded := false
 	index, err := bleve.New(blevePath, createIndexMapping())
 
 	if err != nil {
@@ -42,6 +62,11 @@ func (db *DB) Open(path string) (bool, error) {
 			if err != nil {
 				return false, fmt.Errorf("cannot open bleve '%s' - %s", path, err)
 			}
+			version, err := mappingVersion(index)
+			if err != nil {
+				return false, fmt.Errorf("cannot open bleve '%s' - %s", path, err)
+			}
+			reindexNeeded = version != indexMappingVersion
 		} else {
 			return false, fmt.Errorf("cannot open bleve '%s' - %s", path, err)
 		}
@@ -49,40 +74,115 @@ func (db *DB) Open(path string) (bool, error) {
 		// we just created an index, one didn't exist, so we need to queue
 		// all bookmarks to be scraped
 		rescrapeNeeded = true
+		err = setMappingVersion(index)
+		if err != nil {
+			return false, fmt.Errorf("cannot create bleve '%s' - %s", path, err)
+		}
 	}
 
 	db.store = store
 	db.file = path
-	db.bleve = index
+	db.bleve = bleve.NewIndexAlias(index)
+	db.index = index
+	db.blevePath = blevePath
+	db.stop = make(chan struct{})
+
+	err = db.migrateAdminPassword()
+	if err != nil {
+		return false, fmt.Errorf("cannot migrate admin password - %s", err)
+	}
+	if reindexNeeded && !rescrapeNeeded {
+		db.startReindex()
+	}
 	return rescrapeNeeded, nil
 }
 
+// sortAnalyzer indexes a whole field as one lower case term, so that it
+// can be sorted on without regard to case.
+const sortAnalyzer = "sortable"
+
 func createIndexMapping() mapping.IndexMapping {
 	indexMapping := bleve.NewIndexMapping()
+	err := indexMapping.AddCustomAnalyzer(sortAnalyzer, map[string]interface{}{
+		"type":          custom.Name,
+		"tokenizer":     single.Name,
+		"token_filters": []string{lowercase.Name},
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	// bookmarks are typed by the language of their page, see
+	// bookmarkType, and each type analyses the text for its language
+	indexMapping.AddDocumentMapping("bookmark", bookmarkMapping(en.AnalyzerName))
+	for lang, analyzer := range languageAnalyzers {
+		if lang != "en" {
+			indexMapping.AddDocumentMapping(bookmarkType(lang), bookmarkMapping(analyzer))
+		}
+	}
+	indexMapping.AddDocumentMapping(bookmarkType(otherLanguage), bookmarkMapping(standard.Name))
+
+	return indexMapping
+}
 
-	englishTextFieldMapping := bleve.NewTextFieldMapping()
-	englishTextFieldMapping.Analyzer = en.AnalyzerName
+// bookmarkMapping returns the mapping for bookmarks whose title and page
+// text are in the language of textAnalyzer.
+func bookmarkMapping(textAnalyzer string) *mapping.DocumentMapping {
+	textFieldMapping := bleve.NewTextFieldMapping()
+	textFieldMapping.Analyzer = textAnalyzer
 
 	// a generic reusable mapping for keyword text
 	keywordFieldMapping := bleve.NewTextFieldMapping()
 	keywordFieldMapping.Analyzer = keyword.Name
 
+	// the title again as Info.TitleSort, for sorting by
+	titleSortFieldMapping := bleve.NewTextFieldMapping()
+	titleSortFieldMapping.Name = "TitleSort"
+	titleSortFieldMapping.Analyzer = sortAnalyzer
+	titleSortFieldMapping.IncludeInAll = false
+	titleSortFieldMapping.IncludeTermVectors = false
+
+	// the language analyzers stem words, so Info.TitleWords and
+	// Info.RawTextWords keep them whole, to suggest completions from
+	titleWordsFieldMapping := wordsFieldMapping("TitleWords")
+	rawTextWordsFieldMapping := wordsFieldMapping("RawTextWords")
+
 	pageInfoMapping := bleve.NewDocumentMapping()
-	pageInfoMapping.AddFieldMappingsAt("Title", englishTextFieldMapping)
+	pageInfoMapping.AddFieldMappingsAt("Title", textFieldMapping, titleSortFieldMapping, titleWordsFieldMapping)
 	pageInfoMapping.AddFieldMappingsAt("Size", bleve.NewNumericFieldMapping())
-	pageInfoMapping.AddFieldMappingsAt("RawText", englishTextFieldMapping)
+	pageInfoMapping.AddFieldMappingsAt("RawText", textFieldMapping, rawTextWordsFieldMapping)
+	pageInfoMapping.AddFieldMappingsAt("StatusCode", bleve.NewNumericFieldMapping())
+	pageInfoMapping.AddFieldMappingsAt("Language", keywordFieldMapping)
 
 	bookmarkMapping := bleve.NewDocumentMapping()
+	bookmarkMapping.AddFieldMappingsAt("Owner", bleve.NewNumericFieldMapping())
 	bookmarkMapping.AddFieldMappingsAt("URL", bleve.NewTextFieldMapping())
+	bookmarkMapping.AddFieldMappingsAt("Host", keywordFieldMapping)
+	bookmarkMapping.AddFieldMappingsAt("Domain", keywordFieldMapping)
+	bookmarkMapping.AddFieldMappingsAt("TimestampCreated", bleve.NewDateTimeFieldMapping())
+	bookmarkMapping.AddFieldMappingsAt("TimestampLastScraped", bleve.NewDateTimeFieldMapping())
 	bookmarkMapping.AddFieldMappingsAt("Tags", keywordFieldMapping)
+	bookmarkMapping.AddFieldMappingsAt("Public", bleve.NewBooleanFieldMapping())
 	bookmarkMapping.AddSubDocumentMapping("Info", pageInfoMapping)
+	return bookmarkMapping
+}
 
-	indexMapping.AddDocumentMapping("bookmark", bookmarkMapping)
-
-	return indexMapping
+// wordsFieldMapping returns a mapping which indexes a text field again
+// under name, split into whole lower case words, only to be looked up in
+// the field's dictionary.
+func wordsFieldMapping(name string) *mapping.FieldMapping {
+	fm := bleve.NewTextFieldMapping()
+	fm.Name = name
+	fm.Analyzer = standard.Name
+	fm.IncludeInAll = false
+	fm.IncludeTermVectors = false
+	return fm
 }
 
 func (db *DB) Close() {
+	close(db.stop)
+	db.reindexing.Wait()
+	db.index.Close()
 	db.store.Close()
 }
 
@@ -92,22 +192,22 @@ func (db *DB) Close() {
 // 	log.Printf("%v", res)
 // }
 
-// IncrementSearches increments the number of searches we have ever performed by one.
-func (db *DB) IncrementSearches() error {
+// IncrementSearches increments the number of searches a user has ever performed by one.
+func (db *DB) IncrementSearches(owner uint64) error {
 	txn, err := db.store.Bolt().Begin(true)
 	if err != nil {
 		return fmt.Errorf("could not start transaction for increment searches: %s", err)
 	}
 
 	stats := entity.DBStats{}
-	err = db.store.TxGet(txn, "stats", &stats)
+	err = db.store.TxGet(txn, owner, &stats)
 	if err != nil && err != bolthold.ErrNotFound {
 		txn.Rollback()
 		return fmt.Errorf("could not get stats for incrementing searches: %s", err)
 	}
 
 	stats.Searches += 1
-	err = db.store.TxUpsert(txn, "stats", &stats)
+	err = db.store.TxUpsert(txn, owner, &stats)
 	if err != nil {
 		txn.Rollback()
 		return fmt.Errorf("could not upsert stats for incrementing searches: %s", err)
@@ -120,38 +220,49 @@ func (db *DB) IncrementSearches() error {
 	return nil
 }
 
-// UpdateBookmarkStats updates the history on the number of bookmarks and words indexed.
+// UpdateBookmarkStats updates the history on the number of bookmarks each
+// user has.
 func (db *DB) UpdateBookmarkStats() error {
 
 	txn, err := db.store.Bolt().Begin(true)
 	if err != nil {
 		return fmt.Errorf("could not start transaction for update stats: %s", err)
 	}
-	// count bookmarks and words indexed
-	bmI := entity.Bookmark{}
-	bookmarkCount, err := db.store.TxCount(txn, &bmI, &bolthold.Query{})
+
+	users := []entity.User{}
+	err = db.store.TxFind(txn, &users, &bolthold.Query{})
 	if err != nil {
 		txn.Rollback()
-		return fmt.Errorf("could not get bookmark count: %s", err)
+		return fmt.Errorf("could not load users: %s", err)
 	}
 
 	// bucket these stats by day
 	now := time.Now().Truncate(time.Hour * 24)
 
-	stats := entity.DBStats{}
-	err = db.store.TxGet(txn, "stats", &stats)
-	if err != nil && err != bolthold.ErrNotFound {
-		txn.Rollback()
-		return fmt.Errorf("could not get stats: %s", err)
-	}
-	if stats.History == nil {
-		stats.History = make(map[time.Time]entity.BookmarkInfo)
-	}
-	stats.History[now] = entity.BookmarkInfo{Bookmarks: bookmarkCount}
-	err = db.store.TxUpsert(txn, "stats", &stats)
-	if err != nil {
-		txn.Rollback()
-		return fmt.Errorf("could not upsert stats: %s", err)
+	for _, user := range users {
+		// count bookmarks
+		bmI := entity.Bookmark{}
+		bookmarkCount, err := db.store.TxCount(txn, &bmI, bolthold.Where("Owner").Eq(user.ID))
+		if err != nil {
+			txn.Rollback()
+			return fmt.Errorf("could not get bookmark count: %s", err)
+		}
+
+		stats := entity.DBStats{}
+		err = db.store.TxGet(txn, user.ID, &stats)
+		if err != nil && err != bolthold.ErrNotFound {
+			txn.Rollback()
+			return fmt.Errorf("could not get stats: %s", err)
+		}
+		if stats.History == nil {
+			stats.History = make(map[time.Time]entity.BookmarkInfo)
+		}
+		stats.History[now] = entity.BookmarkInfo{Bookmarks: bookmarkCount}
+		err = db.store.TxUpsert(txn, user.ID, &stats)
+		if err != nil {
+			txn.Rollback()
+			return fmt.Errorf("could not upsert stats: %s", err)
+		}
 	}
 
 	err = txn.Commit()
@@ -37,7 +37,7 @@ func TestAddRemove(t *testing.T) {
 	db.Open(f.Name())
 
 	bmm := NewBookmarkManager(&db)
-	bm := entity.Bookmark{URL: ts.URL}
+	bm := entity.Bookmark{URL: ts.URL, Owner: 1}
 
 	err := bmm.AddBookmark(&bm)
 	if err != nil {
@@ -51,11 +51,11 @@ func TestAddRemove(t *testing.T) {
 		t.Errorf("scrape index returned %s", err)
 	}
 
-	searchRes, err := bmm.Search(SearchOptions{Query: "fox"})
+	searchRes, err := bmm.Search(SearchOptions{Owner: 1, Query: "fox"})
 	if err != nil {
 		t.Errorf("search returned %s", err)
 	}
-	if len(searchRes) != 1 {
+	if len(searchRes.Hits) != 1 {
 		t.Error("did not get one id")
 	}
 
@@ -66,19 +66,19 @@ func TestAddRemove(t *testing.T) {
 		t.Errorf("scrape index returned %s", err)
 	}
 
-	searchRes, err = bmm.Search(SearchOptions{Query: "fox"})
+	searchRes, err = bmm.Search(SearchOptions{Owner: 1, Query: "fox"})
 	if err != nil {
 		t.Errorf("search returned %s", err)
 	}
-	if len(searchRes) != 0 {
+	if len(searchRes.Hits) != 0 {
 		t.Error("got result when should not")
 	}
 
-	searchRes, err = bmm.Search(SearchOptions{Query: "rabbit"})
+	searchRes, err = bmm.Search(SearchOptions{Owner: 1, Query: "rabbit"})
 	if err != nil {
 		t.Errorf("search returned %s", err)
 	}
-	if len(searchRes) != 1 {
+	if len(searchRes.Hits) != 1 {
 		t.Error("did not get result when should")
 	}
 
@@ -87,11 +87,11 @@ func TestAddRemove(t *testing.T) {
 		t.Errorf("got error when deleting: %s", err)
 	}
 
-	searchRes, err = bmm.Search(SearchOptions{Query: "rabbit"})
+	searchRes, err = bmm.Search(SearchOptions{Owner: 1, Query: "rabbit"})
 	if err != nil {
 		t.Errorf("search returned %s", err)
 	}
-	if len(searchRes) != 0 {
+	if len(searchRes.Hits) != 0 {
 		t.Error("rabbit should be gone from index")
 	}
 
@@ -109,7 +109,7 @@ func TestTagIndexing(t *testing.T) {
 	db.Open(f.Name())
 
 	bmm := NewBookmarkManager(&db)
-	bm := entity.Bookmark{URL: ts.URL}
+	bm := entity.Bookmark{URL: ts.URL, Owner: 1}
 
 	err := bmm.AddBookmark(&bm)
 	if err != nil {
@@ -123,11 +123,11 @@ func TestTagIndexing(t *testing.T) {
 		t.Errorf("scrape index returned %s", err)
 	}
 
-	searchRes, err := bmm.Search(SearchOptions{Query: "fox"})
+	searchRes, err := bmm.Search(SearchOptions{Owner: 1, Query: "fox"})
 	if err != nil {
 		t.Errorf("search returned %s", err)
 	}
-	if len(searchRes) != 1 {
+	if len(searchRes.Hits) != 1 {
 		t.Error("did not get one id")
 	}
 
@@ -137,11 +137,11 @@ func TestTagIndexing(t *testing.T) {
 	if err != nil {
 		t.Errorf("scrape index returned %s", err)
 	}
-	searchRes, err = bmm.Search(SearchOptions{Query: "sloth"})
+	searchRes, err = bmm.Search(SearchOptions{Owner: 1, Query: "sloth"})
 	if err != nil {
 		t.Errorf("search returned %s", err)
 	}
-	if len(searchRes) != 1 {
+	if len(searchRes.Hits) != 1 {
 		t.Error("did not get one id for sloth")
 	}
 }
@@ -0,0 +1,176 @@
+package db
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/blevesearch/bleve/v2"
+	"github.com/blevesearch/bleve/v2/analysis/analyzer/standard"
+	"github.com/blevesearch/bleve/v2/analysis/lang/ar"
+	"github.com/blevesearch/bleve/v2/analysis/lang/cjk"
+	"github.com/blevesearch/bleve/v2/analysis/lang/da"
+	"github.com/blevesearch/bleve/v2/analysis/lang/de"
+	"github.com/blevesearch/bleve/v2/analysis/lang/en"
+	"github.com/blevesearch/bleve/v2/analysis/lang/es"
+	"github.com/blevesearch/bleve/v2/analysis/lang/fa"
+	"github.com/blevesearch/bleve/v2/analysis/lang/fi"
+	"github.com/blevesearch/bleve/v2/analysis/lang/fr"
+	"github.com/blevesearch/bleve/v2/analysis/lang/hi"
+	"github.com/blevesearch/bleve/v2/analysis/lang/hr"
+	"github.com/blevesearch/bleve/v2/analysis/lang/hu"
+	"github.com/blevesearch/bleve/v2/analysis/lang/it"
+	"github.com/blevesearch/bleve/v2/analysis/lang/nl"
+	"github.com/blevesearch/bleve/v2/analysis/lang/no"
+	"github.com/blevesearch/bleve/v2/analysis/lang/pl"
+	"github.com/blevesearch/bleve/v2/analysis/lang/pt"
+	"github.com/blevesearch/bleve/v2/analysis/lang/ro"
+	"github.com/blevesearch/bleve/v2/analysis/lang/ru"
+	"github.com/blevesearch/bleve/v2/analysis/lang/sv"
+	"github.com/blevesearch/bleve/v2/analysis/lang/tr"
+	"github.com/blevesearch/bleve/v2/search/query"
+	"github.com/tardisx/linkwallet/entity"
+)
+
+// languageAnalyzers maps the languages pages can be detected in to the
+// analyzers for their text. Chinese, Japanese and Korean are not written
+// with spaces between words, so share one which indexes pairs of
+// characters.
+var languageAnalyzers = map[string]string{
+	"ar": ar.AnalyzerName,
+	"da": da.AnalyzerName,
+	"de": de.AnalyzerName,
+	"en": en.AnalyzerName,
+	"es": es.AnalyzerName,
+	"fa": fa.AnalyzerName,
+	"fi": fi.AnalyzerName,
+	"fr": fr.AnalyzerName,
+	"hi": hi.AnalyzerName,
+	"hr": hr.AnalyzerName,
+	"hu": hu.AnalyzerName,
+	"it": it.AnalyzerName,
+	"nl": nl.AnalyzerName,
+	"nb": no.AnalyzerName,
+	"pl": pl.AnalyzerName,
+	"pt": pt.AnalyzerName,
+	"ro": ro.AnalyzerName,
+	"ru": ru.AnalyzerName,
+	"sv": sv.AnalyzerName,
+	"tr": tr.AnalyzerName,
+	"ja": cjk.AnalyzerName,
+	"ko": cjk.AnalyzerName,
+	"zh": cjk.AnalyzerName,
+}
+
+// otherLanguage stands for the languages without an analyzer of their own,
+// whose text is split into words without stemming.
+const otherLanguage = "other"
+
+// bookmarkType returns the type bookmarks in the language are indexed as.
+// English, and pages whose language is not known, are plain bookmarks.
+func bookmarkType(lang string) string {
+	switch {
+	case lang == "" || lang == "en":
+		return "bookmark"
+	case languageAnalyzers[lang] != "":
+		return "bookmark_" + lang
+	}
+	return "bookmark_" + otherLanguage
+}
+
+// languageAnalyzer returns the analyzer of the text of pages in the
+// language.
+func languageAnalyzer(lang string) string {
+	switch {
+	case lang == "":
+		return en.AnalyzerName
+	case languageAnalyzers[lang] != "":
+		return languageAnalyzers[lang]
+	}
+	return standard.Name
+}
+
+// textAnalyzers returns every analyzer text is indexed with, English
+// first.
+func textAnalyzers() []string {
+	seen := map[string]bool{en.AnalyzerName: true, standard.Name: true}
+	analyzers := []string{}
+	for _, analyzer := range languageAnalyzers {
+		if !seen[analyzer] {
+			seen[analyzer] = true
+			analyzers = append(analyzers, analyzer)
+		}
+	}
+	sort.Strings(analyzers)
+	return append([]string{en.AnalyzerName, standard.Name}, analyzers...)
+}
+
+// queryAnalyzers returns the analyzers to search for text with, so that it
+// matches pages in any language. Of those which would search for the same
+// terms only the first is returned, and those which find no terms at all
+// in it, such as a stop word of their language, are left out.
+func queryAnalyzers(text string) []string {
+	analyzers := []string{}
+	seen := map[string]bool{}
+	for _, name := range textAnalyzers() {
+		analyzer, err := bleve.Config.Cache.AnalyzerNamed(name)
+		if err != nil {
+			continue
+		}
+		terms := []string{}
+		for _, token := range analyzer.Analyze([]byte(text)) {
+			terms = append(terms, string(token.Term))
+		}
+		key := strings.Join(terms, "\x00")
+		if len(terms) == 0 || seen[key] {
+			continue
+		}
+		seen[key] = true
+		analyzers = append(analyzers, name)
+	}
+	return analyzers
+}
+
+// languageQuery matches bookmarks of pages in the language.
+func languageQuery(lang string) query.Query {
+	q := bleve.NewTermQuery(lang)
+	q.SetField("Info.Language")
+	return q
+}
+
+// indexedBookmark is a bookmark as it is indexed, typed by the language of
+// its page.
+type indexedBookmark struct {
+	entity.Bookmark
+	docType string
+}
+
+func (b indexedBookmark) Type() string {
+	return b.docType
+}
+
+// indexBookmark adds the bookmark to the index, or updates it. Indexes
+// created before the mapping for its language was added index it as an
+// English page, until they are rebuilt.
+func (db *DB) indexBookmark(bm entity.Bookmark) error {
+	db.indexMu.Lock()
+	defer db.indexMu.Unlock()
+	if db.changed != nil {
+		db.changed[bm.ID] = true
+	}
+	err := db.bleve.Index(fmt.Sprint(bm.ID), bookmarkDocument(db.index, bm))
+	if err != nil {
+		return fmt.Errorf("could not index bookmark %d: %w", bm.ID, err)
+	}
+	return nil
+}
+
+// unindexBookmark removes the bookmark from the index.
+func (db *DB) unindexBookmark(id uint64) error {
+	db.indexMu.Lock()
+	defer db.indexMu.Unlock()
+	if db.changed != nil {
+		db.changed[id] = true
+	}
+	return db.bleve.Delete(fmt.Sprint(id))
+}
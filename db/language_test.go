@@ -0,0 +1,64 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/tardisx/linkwallet/entity"
+)
+
+func TestLanguageAnalysis(t *testing.T) {
+	db := newTestDB(t)
+	bmm := NewBookmarkManager(db)
+
+	for _, bm := range []entity.Bookmark{
+		{URL: "https://example.de/haus", Owner: 1, Info: entity.PageInfo{Title: "Die schönsten Häuser am See", Language: "de"}},
+		{URL: "https://example.jp/tenki", Owner: 1, Info: entity.PageInfo{Title: "東京の天気予報", Language: "ja"}},
+		{URL: "https://example.com/houses", Owner: 1, Info: entity.PageInfo{Title: "Lake houses", Language: "en"}},
+		{URL: "https://example.is/hus", Owner: 1, Info: entity.PageInfo{Title: "Hús við vatnið", Language: "is"}},
+	} {
+		err := bmm.AddBookmark(&bm)
+		if err != nil {
+			t.Fatal(err)
+		}
+		bmm.UpdateIndexForBookmark(&bm)
+	}
+
+	search := func(opts SearchOptions) []string {
+		opts.Owner = 1
+		res, err := bmm.Search(opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		urls := []string{}
+		for _, h := range res.Hits {
+			urls = append(urls, h.Bookmark.URL)
+		}
+		return urls
+	}
+
+	tcs := map[string]string{
+		// stemmed as German, so the singular finds the plural
+		"Haus": "https://example.de/haus",
+		// split into pairs of characters, as there are no spaces
+		"天気": "https://example.jp/tenki",
+		// stemmed as English
+		"house": "https://example.com/houses",
+		// languages without an analyzer are still split into words
+		"vatnið": "https://example.is/hus",
+	}
+	for q, want := range tcs {
+		got := search(SearchOptions{Query: q})
+		if len(got) != 1 || got[0] != want {
+			t.Errorf("%q: expected %s, got %v", q, want, got)
+		}
+	}
+
+	got := search(SearchOptions{All: true, Language: "de"})
+	if len(got) != 1 || got[0] != "https://example.de/haus" {
+		t.Errorf("expected only the German page, got %v", got)
+	}
+	res, _ := bmm.Search(SearchOptions{Owner: 1, All: true})
+	if len(res.Languages) != 4 {
+		t.Errorf("expected four languages, got %v", res.Languages)
+	}
+}
@@ -0,0 +1,478 @@
+package db
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/blevesearch/bleve/v2"
+	"github.com/blevesearch/bleve/v2/search/query"
+	"github.com/tardisx/linkwallet/entity"
+)
+
+// The search query language. Terms are ANDed together unless separated
+// by OR, and can be grouped with parentheses. A term is a word, a "quoted
+// phrase", or one of the fields below followed by a word or phrase, eg
+// tag:"machine learning". Prefixing a term with - (or NOT) excludes
+// bookmarks which match it.
+//
+//	tag:x            bookmarks tagged exactly x
+//	site:x domain:x  bookmarks on the host x, or any subdomain of it
+//	title:x          x in the title
+//	url:x            x anywhere in the URL
+//	after:x          created during or after x (2024, 2024-01 or 2024-01-31)
+//	before:x         created before x
+//	status:x         last fetched with HTTP status x (404, or 4xx)
+
+// QueryError is returned for queries which cannot be parsed.
+type QueryError struct {
+	Msg string
+}
+
+func (e QueryError) Error() string {
+	return "bad query: " + e.Msg
+}
+
+type tokenKind int
+
+const (
+	tokTerm tokenKind = iota
+	tokOr
+	tokNot
+	tokLParen
+	tokRParen
+)
+
+type token struct {
+	kind   tokenKind
+	field  string
+	value  string
+	phrase bool
+	// start and end are the rune offsets of the value of a term which is
+	// not a phrase, so that it can be replaced with a correction.
+	start, end int
+}
+
+var queryFields = map[string]bool{
+	"tag": true, "site": true, "domain": true, "title": true, "url": true,
+	"after": true, "before": true, "status": true,
+}
+
+// QuoteTerm returns term as it is written in a query, in quotes if it has
+// spaces or brackets in it. Phrases end at the next quote, so any quotes in
+// term become spaces, which match the same as they are not indexed.
+func QuoteTerm(term string) string {
+	term = strings.ReplaceAll(term, `"`, " ")
+	if !strings.ContainsFunc(term, func(r rune) bool { return unicode.IsSpace(r) || r == '(' || r == ')' }) {
+		return term
+	}
+	return `"` + term + `"`
+}
+
+// lexQuery splits a query into tokens.
+func lexQuery(s string) ([]token, error) {
+	tokens := []token{}
+	r := []rune(s)
+	i := 0
+
+	// quoted reads a phrase starting at the quote at r[i]
+	quoted := func() (string, error) {
+		end := i + 1
+		for end < len(r) && r[end] != '"' {
+			end++
+		}
+		if end == len(r) {
+			return "", QueryError{"missing closing quote"}
+		}
+		phrase := string(r[i+1 : end])
+		i = end + 1
+		return phrase, nil
+	}
+
+	for i < len(r) {
+		switch {
+		case unicode.IsSpace(r[i]):
+			i++
+		case r[i] == '(':
+			tokens = append(tokens, token{kind: tokLParen})
+			i++
+		case r[i] == ')':
+			tokens = append(tokens, token{kind: tokRParen})
+			i++
+		case r[i] == '-' && i+1 < len(r) && !unicode.IsSpace(r[i+1]):
+			tokens = append(tokens, token{kind: tokNot})
+			i++
+		case r[i] == '"':
+			phrase, err := quoted()
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, token{kind: tokTerm, value: phrase, phrase: true})
+		default:
+			start := i
+			for i < len(r) && !unicode.IsSpace(r[i]) && r[i] != '(' && r[i] != ')' && r[i] != '"' {
+				i++
+			}
+			word := string(r[start:i])
+
+			field, value, found := strings.Cut(word, ":")
+			field = strings.ToLower(field)
+			if found && queryFields[field] {
+				if value == "" && i < len(r) && r[i] == '"' {
+					phrase, err := quoted()
+					if err != nil {
+						return nil, err
+					}
+					tokens = append(tokens, token{kind: tokTerm, field: field, value: phrase, phrase: true})
+					continue
+				}
+				if value == "" {
+					return nil, QueryError{fmt.Sprintf("nothing to search for after %s:", field)}
+				}
+				tokens = append(tokens, token{kind: tokTerm, field: field, value: value, start: i - len([]rune(value)), end: i})
+				continue
+			}
+			// anything else with a colon, such as a URL, std::vector or
+			// 10:30, is searched for as a plain term
+			switch word {
+			case "OR":
+				tokens = append(tokens, token{kind: tokOr})
+			case "NOT":
+				tokens = append(tokens, token{kind: tokNot})
+			case "AND":
+				// terms are ANDed anyway
+			default:
+				tokens = append(tokens, token{kind: tokTerm, value: word, start: start, end: i})
+			}
+		}
+	}
+	return tokens, nil
+}
+
+// queryOptions change how the terms of a query match.
+type queryOptions struct {
+	// fuzziness is the most edits allowed in words, see wordFuzziness.
+	fuzziness int
+	// boosts weight matches of plain terms in each field.
+	boosts entity.FieldBoosts
+}
+
+type queryParser struct {
+	tokens []token
+	pos    int
+	opts   queryOptions
+}
+
+// parseQuery parses a query in the search query language into a bleve
+// query.
+func parseQuery(s string) (query.Query, error) {
+	return parseQueryWith(s, queryOptions{})
+}
+
+// parseQueryWith parses a query like parseQuery, with plain terms
+// matching as given by opts.
+func parseQueryWith(s string, opts queryOptions) (query.Query, error) {
+	tokens, err := lexQuery(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, QueryError{"nothing to search for"}
+	}
+	p := &queryParser{tokens: tokens, opts: opts}
+	q, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, QueryError{"unexpected )"}
+	}
+	return q, nil
+}
+
+func (p *queryParser) peek() (token, bool) {
+	if p.pos >= len(p.tokens) {
+		return token{}, false
+	}
+	return p.tokens[p.pos], true
+}
+
+// parseOr parses terms separated by OR.
+func (p *queryParser) parseOr() (query.Query, error) {
+	q, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	alternatives := []query.Query{q}
+	for {
+		t, ok := p.peek()
+		if !ok || t.kind != tokOr {
+			break
+		}
+		p.pos++
+		q, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		alternatives = append(alternatives, q)
+	}
+	if len(alternatives) == 1 {
+		return alternatives[0], nil
+	}
+	return bleve.NewDisjunctionQuery(alternatives...), nil
+}
+
+// parseAnd parses a sequence of terms, all of which must match.
+func (p *queryParser) parseAnd() (query.Query, error) {
+	must := []query.Query{}
+	mustNot := []query.Query{}
+	for {
+		t, ok := p.peek()
+		if !ok || t.kind == tokOr || t.kind == tokRParen {
+			break
+		}
+		q, negated, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		if negated {
+			mustNot = append(mustNot, q)
+		} else {
+			must = append(must, q)
+		}
+	}
+
+	if len(must) == 0 && len(mustNot) == 0 {
+		if t, ok := p.peek(); ok && t.kind == tokOr {
+			return nil, QueryError{"OR needs a search term on both sides"}
+		}
+		return nil, QueryError{"expected a search term"}
+	}
+	if len(mustNot) == 0 && len(must) == 1 {
+		return must[0], nil
+	}
+	bq := bleve.NewBooleanQuery()
+	if len(must) == 0 {
+		// only exclusions, so start from everything
+		must = append(must, bleve.NewMatchAllQuery())
+	}
+	bq.AddMust(must...)
+	bq.AddMustNot(mustNot...)
+	return bq, nil
+}
+
+// parseUnary parses a possibly negated term or group.
+func (p *queryParser) parseUnary() (query.Query, bool, error) {
+	t, ok := p.peek()
+	if !ok {
+		return nil, false, QueryError{"expected a search term"}
+	}
+	switch t.kind {
+	case tokNot:
+		p.pos++
+		if next, ok := p.peek(); !ok || next.kind == tokOr || next.kind == tokRParen {
+			return nil, false, QueryError{"nothing to exclude after -"}
+		}
+		q, negated, err := p.parseUnary()
+		return q, !negated, err
+	case tokLParen:
+		p.pos++
+		q, err := p.parseOr()
+		if err != nil {
+			return nil, false, err
+		}
+		if t, ok := p.peek(); !ok || t.kind != tokRParen {
+			return nil, false, QueryError{"missing )"}
+		}
+		p.pos++
+		return q, false, nil
+	case tokTerm:
+		p.pos++
+		q, err := termQuery(t, p.opts)
+		return q, false, err
+	}
+	return nil, false, QueryError{"expected a search term"}
+}
+
+// termQuery compiles a single term. Words which are not phrases also
+// match words up to opts.fuzziness edits away, if it is more than 0.
+// Plain terms match anywhere, and score more for matches in the fields
+// with boosts.
+func termQuery(t token, opts queryOptions) (query.Query, error) {
+	switch t.field {
+	case "":
+		q := bleve.NewDisjunctionQuery(textQueries(t, "", 0)...)
+		q.AddQuery(boostedQueries(t, opts.boosts)...)
+		if !t.phrase {
+			q.AddQuery(bleve.NewTermQuery(t.value))
+			q.AddQuery(fuzzyQueries(t.value, opts.fuzziness, wordFields...)...)
+			// re:invent is indexed as a single word, but std::vector
+			// and 10:30 are split at the colons
+			if strings.Contains(t.value, ":") {
+				parts := token{kind: tokTerm, value: strings.ReplaceAll(t.value, ":", " "), phrase: true}
+				q.AddQuery(textQueries(parts, "", 0)...)
+			}
+		}
+		return q, nil
+
+	case "tag":
+		return tagQuery(t.value), nil
+
+	case "site", "domain":
+		return siteQuery(strings.ToLower(t.value)), nil
+
+	case "title":
+		q := bleve.NewDisjunctionQuery(textQueries(t, "Info.Title", 0)...)
+		if !t.phrase {
+			q.AddQuery(fuzzyQueries(t.value, opts.fuzziness, "Info.TitleWords")...)
+		}
+		return q, nil
+
+	case "url":
+		if t.phrase {
+			q := bleve.NewMatchPhraseQuery(t.value)
+			q.SetField("URL")
+			return q, nil
+		}
+		mq := bleve.NewMatchQuery(t.value)
+		mq.SetField("URL")
+		// anywhere in the URL, with any * or ? in it taken literally
+		rq := bleve.NewRegexpQuery(".*" + regexp.QuoteMeta(strings.ToLower(t.value)) + ".*")
+		rq.SetField("URL")
+		return bleve.NewDisjunctionQuery(mq, rq), nil
+
+	case "after", "before":
+		start, err := parsePeriod(t.value)
+		if err != nil {
+			return nil, err
+		}
+		var q *query.DateRangeQuery
+		inclusive, exclusive := true, false
+		if t.field == "after" {
+			q = bleve.NewDateRangeInclusiveQuery(start, time.Time{}, &inclusive, nil)
+		} else {
+			q = bleve.NewDateRangeInclusiveQuery(time.Time{}, start, nil, &exclusive)
+		}
+		q.SetField("TimestampCreated")
+		return q, nil
+
+	case "status":
+		min, max, err := parseStatus(t.value)
+		if err != nil {
+			return nil, err
+		}
+		inclusive := true
+		q := bleve.NewNumericRangeInclusiveQuery(&min, &max, &inclusive, &inclusive)
+		q.SetField("Info.StatusCode")
+		return q, nil
+	}
+	return nil, QueryError{fmt.Sprintf("unknown field %s:", t.field)}
+}
+
+// boostedQueries returns queries matching a plain term in each field with
+// a boost, weighted by it. Fields without one are left to the match on all
+// fields.
+func boostedQueries(t token, boosts entity.FieldBoosts) []query.Query {
+	queries := []query.Query{}
+	if boosts.Title > 0 {
+		queries = append(queries, textQueries(t, "Info.Title", boosts.Title)...)
+	}
+	if boosts.RawText > 0 {
+		queries = append(queries, textQueries(t, "Info.RawText", boosts.RawText)...)
+	}
+	if boosts.URL > 0 {
+		if t.phrase {
+			q := bleve.NewMatchPhraseQuery(t.value)
+			q.SetField("URL")
+			q.SetBoost(boosts.URL)
+			queries = append(queries, q)
+		} else {
+			q := bleve.NewMatchQuery(t.value)
+			q.SetField("URL")
+			q.SetBoost(boosts.URL)
+			queries = append(queries, q)
+		}
+	}
+	if boosts.Tags > 0 {
+		q := bleve.NewTermQuery(t.value)
+		q.SetField("Tags")
+		q.SetBoost(boosts.Tags)
+		queries = append(queries, q)
+	}
+	return queries
+}
+
+// textQueries returns queries matching the term in text in any language,
+// analysed as each language is, in field or every field if it is "". A
+// boost of 0 leaves them unboosted.
+func textQueries(t token, field string, boost float64) []query.Query {
+	queries := []query.Query{}
+	for _, analyzer := range queryAnalyzers(t.value) {
+		if t.phrase {
+			q := bleve.NewMatchPhraseQuery(t.value)
+			q.Analyzer = analyzer
+			if field != "" {
+				q.SetField(field)
+			}
+			if boost > 0 {
+				q.SetBoost(boost)
+			}
+			queries = append(queries, q)
+			continue
+		}
+		q := bleve.NewMatchQuery(t.value)
+		q.Analyzer = analyzer
+		if field != "" {
+			q.SetField(field)
+		}
+		if boost > 0 {
+			q.SetBoost(boost)
+		}
+		queries = append(queries, q)
+	}
+	return queries
+}
+
+// siteQuery matches bookmarks on the host, or any of its subdomains.
+func siteQuery(host string) query.Query {
+	tq := bleve.NewTermQuery(host)
+	tq.SetField("Host")
+	// any * or ? in it are taken literally
+	rq := bleve.NewRegexpQuery(`.*\.` + regexp.QuoteMeta(host))
+	rq.SetField("Host")
+	return bleve.NewDisjunctionQuery(tq, rq)
+}
+
+// parsePeriod parses a year, month or day, returning the start of it.
+func parsePeriod(s string) (time.Time, error) {
+	for _, layout := range []string{"2006-01-02", "2006-01", "2006"} {
+		t, err := time.ParseInLocation(layout, s, time.Local)
+		if err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, QueryError{fmt.Sprintf("bad date %q, use 2024, 2024-01 or 2024-01-31", s)}
+}
+
+// parseStatus parses a HTTP status code, or a class of them like 4xx.
+func parseStatus(s string) (float64, float64, error) {
+	bad := QueryError{fmt.Sprintf("bad status %q, use a code like 404 or a class like 4xx", s)}
+	if len(s) != 3 {
+		return 0, 0, bad
+	}
+	if strings.EqualFold(s[1:], "xx") {
+		class, err := strconv.Atoi(s[:1])
+		if err != nil || class < 1 || class > 5 {
+			return 0, 0, bad
+		}
+		return float64(class * 100), float64(class*100 + 99), nil
+	}
+	code, err := strconv.Atoi(s)
+	if err != nil || code < 100 || code > 599 {
+		return 0, 0, bad
+	}
+	return float64(code), float64(code), nil
+}
@@ -0,0 +1,148 @@
+package db
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/tardisx/linkwallet/entity"
+)
+
+func TestParseQueryErrors(t *testing.T) {
+	tcs := []string{
+		"",
+		"   ",
+		`"unterminated phrase`,
+		`title:"unterminated`,
+		"tag:",
+		"golang OR",
+		"OR golang",
+		"(golang",
+		"golang)",
+		"after:yesterday",
+		"before:2024-13",
+		"status:ok",
+		"status:6xx",
+		"status:99",
+	}
+	for _, tc := range tcs {
+		_, err := parseQuery(tc)
+		qe := QueryError{}
+		if !errors.As(err, &qe) {
+			t.Errorf("%q: expected a QueryError, got %v", tc, err)
+		}
+	}
+
+	for _, tc := range []string{"golang", "https://example.com/a", "-tag:x", "a AND b", `tag:"machine learning"`, "(a OR b) -c", "status:4XX", "std::vector", "re:invent", "10:30", "note:foo"} {
+		_, err := parseQuery(tc)
+		if err != nil {
+			t.Errorf("%q: unexpected error %s", tc, err)
+		}
+	}
+}
+
+func TestQueryLanguage(t *testing.T) {
+	db := newTestDB(t)
+	bmm := NewBookmarkManager(db)
+
+	day := func(s string) time.Time {
+		d, _ := time.ParseInLocation("2006-01-02", s, time.Local)
+		return d.Add(time.Hour * 12)
+	}
+	bookmarks := []entity.Bookmark{
+		{URL: "https://github.com/golang/go", Tags: []string{"golang"}, TimestampCreated: day("2024-03-01"),
+			Info: entity.PageInfo{Title: "The Go programming language", StatusCode: 200, RawText: "a fast compiled language"}},
+		{URL: "https://gist.github.com/someone/1", Tags: []string{"golang", "snippets"}, TimestampCreated: day("2023-12-31"),
+			Info: entity.PageInfo{Title: "Handy snippets", StatusCode: 404}},
+		{URL: "https://www.rust-lang.org/", Tags: []string{"rust", "machine learning"}, TimestampCreated: day("2024-01-15"),
+			Info: entity.PageInfo{Title: "Rust programming language", StatusCode: 200, RawText: "a fast compiled language with a borrow checker"}},
+		{URL: "https://notgithub.com/", TimestampCreated: day("2022-06-01"),
+			Info: entity.PageInfo{Title: "Not github at all", StatusCode: 503}},
+	}
+	for i := range bookmarks {
+		bookmarks[i].Owner = 1
+		created := bookmarks[i].TimestampCreated
+		err := bmm.AddBookmark(&bookmarks[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		bookmarks[i].TimestampCreated = created
+		bmm.SaveBookmark(&bookmarks[i])
+		bmm.UpdateIndexForBookmark(&bookmarks[i])
+	}
+
+	tcs := map[string][]string{
+		"tag:golang":                            {"https://github.com/golang/go", "https://gist.github.com/someone/1"},
+		"tag:golang -tag:snippets":              {"https://github.com/golang/go"},
+		"tag:GoLang -tag:Snippets":              {"https://github.com/golang/go"},
+		`tag:"machine learning"`:                {"https://www.rust-lang.org/"},
+		"site:github.com":                       {"https://github.com/golang/go", "https://gist.github.com/someone/1"},
+		"domain:rust-lang.org":                  {"https://www.rust-lang.org/"},
+		"title:programming":                     {"https://github.com/golang/go", "https://www.rust-lang.org/"},
+		"url:golang":                            {"https://github.com/golang/go"},
+		"url:GitHub.com/golang":                 {"https://github.com/golang/go"},
+		"url:gol*ng":                            {},
+		"url:githu?":                            {},
+		"after:2024-01":                         {"https://github.com/golang/go", "https://www.rust-lang.org/"},
+		"before:2024":                           {"https://gist.github.com/someone/1", "https://notgithub.com/"},
+		"after:2023 before:2024-01-15":          {"https://gist.github.com/someone/1"},
+		"status:404":                            {"https://gist.github.com/someone/1"},
+		"status:5xx":                            {"https://notgithub.com/"},
+		`"borrow checker"`:                      {"https://www.rust-lang.org/"},
+		`"checker borrow"`:                      {},
+		"compiled":                              {"https://github.com/golang/go", "https://www.rust-lang.org/"},
+		"compiled -tag:rust":                    {"https://github.com/golang/go"},
+		"tag:rust OR tag:snippets":              {"https://gist.github.com/someone/1", "https://www.rust-lang.org/"},
+		"(tag:rust OR tag:snippets) after:2024": {"https://www.rust-lang.org/"},
+		"-status:200":                           {"https://gist.github.com/someone/1", "https://notgithub.com/"},
+		"NOT site:github.com before:2024":       {"https://notgithub.com/"},
+		"site:*":                                {},
+		"site:?ithub.com":                       {},
+		"borrow:checker":                        {"https://www.rust-lang.org/"},
+		"std::vector":                           {},
+	}
+	for q, exp := range tcs {
+		res, err := bmm.Search(SearchOptions{Owner: 1, Query: q})
+		if err != nil {
+			t.Errorf("%q: %s", q, err)
+			continue
+		}
+		got := []string{}
+		for _, r := range res.Hits {
+			got = append(got, r.Bookmark.URL)
+		}
+		slices.Sort(got)
+		slices.Sort(exp)
+		if !slices.Equal(got, exp) {
+			t.Errorf("%q: expected %v, got %v", q, exp, got)
+		}
+	}
+
+	_, err := bmm.Search(SearchOptions{Owner: 1, Query: "golang OR"})
+	if err == nil {
+		t.Error("expected an error for a bad query")
+	}
+}
+
+func TestQuoteTerm(t *testing.T) {
+	for term, want := range map[string]string{
+		"golang":                "golang",
+		"machine learning":      `"machine learning"`,
+		`Go's "any" \ generics`: `"Go's  any  \ generics"`,
+		"C++ (the language)":    `"C++ (the language)"`,
+		`say "hi"`:              `"say  hi "`,
+		"tabs\tand nbsp":        "\"tabs\tand nbsp\"",
+		"std::vector":           "std::vector",
+	} {
+		got := QuoteTerm(term)
+		if got != want {
+			t.Errorf("%q: expected %q, got %q", term, want, got)
+		}
+		// the lexer reads it back as one term
+		tokens, err := lexQuery("title:" + got)
+		if err != nil || len(tokens) != 1 || tokens[0].field != "title" {
+			t.Errorf("%q: lexed as %+v, %v", got, tokens, err)
+		}
+	}
+}
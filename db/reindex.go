@@ -0,0 +1,225 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/blevesearch/bleve/v2"
+	"github.com/blevesearch/bleve/v2/mapping"
+	"github.com/tardisx/linkwallet/entity"
+	bolthold "github.com/timshannon/bolthold"
+)
+
+// indexMappingVersion is the version of the mapping createIndexMapping
+// returns. Bump it whenever the mapping changes, and indexes built with an
+// older one are rebuilt from the bookmarks in the database when opened.
+const indexMappingVersion = 1
+
+// mappingVersionKey is the internal key of an index its mapping version is
+// stored under.
+var mappingVersionKey = []byte("linkwallet:mapping_version")
+
+// reindexBatchSize is the number of bookmarks added to a new index at a
+// time.
+const reindexBatchSize = 500
+
+var errReindexStopped = errors.New("reindex stopped")
+
+// newIndexPath returns where an index is rebuilt next to the one at path.
+func newIndexPath(path string) string {
+	return path + ".new"
+}
+
+// mappingVersion returns the mapping version of the index, 0 if it was
+// built before versions were kept.
+func mappingVersion(idx bleve.Index) (int, error) {
+	v, err := idx.GetInternal(mappingVersionKey)
+	if err != nil {
+		return 0, fmt.Errorf("could not read mapping version: %w", err)
+	}
+	if v == nil {
+		return 0, nil
+	}
+	version, err := strconv.Atoi(string(v))
+	if err != nil {
+		return 0, fmt.Errorf("bad mapping version %q: %w", v, err)
+	}
+	return version, nil
+}
+
+// setMappingVersion records the index as built with the current mapping.
+func setMappingVersion(idx bleve.Index) error {
+	err := idx.SetInternal(mappingVersionKey, []byte(strconv.Itoa(indexMappingVersion)))
+	if err != nil {
+		return fmt.Errorf("could not store mapping version: %w", err)
+	}
+	return nil
+}
+
+// finishReindex tidies up after an index rebuilt at the new path, before
+// the index at path is opened. A complete one was swapped in while running
+// and replaces the old index, an incomplete one was interrupted and is
+// thrown away.
+func finishReindex(path string) error {
+	newPath := newIndexPath(path)
+	if _, err := os.Stat(newPath); os.IsNotExist(err) {
+		return nil
+	}
+	idx, err := bleve.Open(newPath)
+	version := 0
+	if err == nil {
+		version, err = mappingVersion(idx)
+		idx.Close()
+	}
+	if err != nil || version != indexMappingVersion {
+		log.Printf("removing incomplete index %s", newPath)
+		return os.RemoveAll(newPath)
+	}
+	err = os.RemoveAll(path)
+	if err != nil {
+		return fmt.Errorf("could not remove old index: %w", err)
+	}
+	err = os.Rename(newPath, path)
+	if err != nil {
+		return fmt.Errorf("could not move rebuilt index into place: %w", err)
+	}
+	return nil
+}
+
+// bookmarkDocument returns the bookmark typed by the language of its page,
+// or as an English page if the index's mapping has no type for it.
+func bookmarkDocument(idx bleve.Index, bm entity.Bookmark) indexedBookmark {
+	docType := bookmarkType(bm.Info.Language)
+	if im, ok := idx.Mapping().(*mapping.IndexMappingImpl); ok {
+		if _, found := im.TypeMapping[docType]; !found {
+			docType = bookmarkType("")
+		}
+	}
+	return indexedBookmark{Bookmark: bm, docType: docType}
+}
+
+// startReindex rebuilds the index from the bookmarks in the database, in
+// the background. The current index carries on serving searches and
+// taking changes until the new one is ready to be swapped in.
+func (db *DB) startReindex() {
+	db.reindexing.Add(1)
+	go func() {
+		defer db.reindexing.Done()
+		start := time.Now()
+		log.Printf("index mapping is out of date, rebuilding %s in the background", db.blevePath)
+		err := db.reindex()
+		if err == errReindexStopped {
+			log.Printf("stopped rebuilding index")
+			return
+		} else if err != nil {
+			log.Printf("could not rebuild index: %s", err)
+			return
+		}
+		log.Printf("rebuilt index in %s", time.Since(start).Round(time.Millisecond))
+	}()
+}
+
+// reindex builds a new index next to the current one, swaps it in and
+// deletes the old one. Bookmarks changed while it is built are noted, and
+// indexed again just before the swap.
+func (db *DB) reindex() error {
+	path := db.blevePath
+	newPath := newIndexPath(path)
+	err := os.RemoveAll(newPath)
+	if err != nil {
+		return fmt.Errorf("could not remove old new index: %w", err)
+	}
+	idx, err := bleve.New(newPath, createIndexMapping())
+	if err != nil {
+		return fmt.Errorf("could not create new index: %w", err)
+	}
+	abandon := func(err error) error {
+		idx.Close()
+		os.RemoveAll(newPath)
+		return err
+	}
+
+	db.indexMu.Lock()
+	db.changed = map[uint64]bool{}
+	db.indexMu.Unlock()
+	defer func() {
+		db.indexMu.Lock()
+		db.changed = nil
+		db.indexMu.Unlock()
+	}()
+
+	// the bookmarks are read in one transaction, so that none are missed
+	// or seen twice
+	batch := idx.NewBatch()
+	count := 0
+	err = db.store.ForEach(&bolthold.Query{}, func(bm *entity.Bookmark) error {
+		select {
+		case <-db.stop:
+			return errReindexStopped
+		default:
+		}
+		err := batch.Index(fmt.Sprint(bm.ID), bookmarkDocument(idx, *bm))
+		if err != nil {
+			return fmt.Errorf("could not index bookmark %d: %w", bm.ID, err)
+		}
+		count++
+		if batch.Size() >= reindexBatchSize {
+			err = idx.Batch(batch)
+			if err != nil {
+				return fmt.Errorf("could not index bookmarks: %w", err)
+			}
+			batch.Reset()
+		}
+		return nil
+	})
+	if err != nil {
+		return abandon(err)
+	}
+	err = idx.Batch(batch)
+	if err != nil {
+		return abandon(fmt.Errorf("could not index bookmarks: %w", err))
+	}
+
+	// nothing can be indexed from here until the new index is in place
+	db.indexMu.Lock()
+	for id := range db.changed {
+		bm := entity.Bookmark{}
+		err := db.store.Get(id, &bm)
+		if err == bolthold.ErrNotFound {
+			err = idx.Delete(fmt.Sprint(id))
+		} else if err == nil {
+			err = idx.Index(fmt.Sprint(id), bookmarkDocument(idx, bm))
+		}
+		if err != nil {
+			db.indexMu.Unlock()
+			return abandon(fmt.Errorf("could not index bookmark %d changed while rebuilding: %w", id, err))
+		}
+	}
+	changed := len(db.changed)
+	old := db.index
+	db.bleve.Swap([]bleve.Index{idx}, []bleve.Index{old})
+	db.index = idx
+	db.blevePath = newPath
+	db.indexMu.Unlock()
+	log.Printf("indexed %d bookmarks, %d changed while rebuilding", count, changed)
+
+	// only now is the new index complete, and used in place of the old
+	// one if the old one is still there when next opened
+	err = setMappingVersion(idx)
+	if err != nil {
+		return err
+	}
+	err = old.Close()
+	if err != nil {
+		log.Printf("could not close old index: %s", err)
+	}
+	err = os.RemoveAll(path)
+	if err != nil {
+		return fmt.Errorf("could not remove old index: %w", err)
+	}
+	return nil
+}
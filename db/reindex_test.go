@@ -0,0 +1,113 @@
+package db
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/tardisx/linkwallet/entity"
+)
+
+func TestReindexOnMappingChange(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	db := &DB{}
+	_, err := db.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bmm := NewBookmarkManager(db)
+	for _, bm := range []entity.Bookmark{
+		{URL: "https://example.com/operator", Owner: 1, Info: entity.PageInfo{Title: "Writing an operator"}},
+		{URL: "https://example.de/zeitung", Owner: 1, Info: entity.PageInfo{Title: "Die Zeitungen", Language: "de"}},
+	} {
+		err := bmm.AddBookmark(&bm)
+		if err != nil {
+			t.Fatal(err)
+		}
+		bmm.UpdateIndexForBookmark(&bm)
+	}
+
+	// an index from before mapping versions were kept
+	err = db.bleve.DeleteInternal(mappingVersionKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	db = &DB{}
+	rescrape, err := db.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rescrape {
+		t.Error("rebuilding the index should not need a rescrape")
+	}
+	db.reindexing.Wait()
+	if db.blevePath != path+".bleve.new" {
+		t.Fatalf("rebuilt index not swapped in, serving %s", db.blevePath)
+	}
+	if _, err := os.Stat(path + ".bleve"); !os.IsNotExist(err) {
+		t.Errorf("old index not removed: %v", err)
+	}
+	version, err := mappingVersion(db.bleve)
+	if err != nil || version != indexMappingVersion {
+		t.Errorf("expected mapping version %d, got %d %v", indexMappingVersion, version, err)
+	}
+	bmm = NewBookmarkManager(db)
+	for _, q := range []string{"operator", "zeitung"} {
+		sr, err := bmm.Search(SearchOptions{Owner: 1, Query: q})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(sr.Hits) != 1 {
+			t.Errorf("expected %q to find one bookmark in the rebuilt index, got %d", q, len(sr.Hits))
+		}
+	}
+	db.Close()
+
+	// next time it is moved into place
+	db = &DB{}
+	_, err = db.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if db.blevePath != path+".bleve" {
+		t.Errorf("rebuilt index not moved into place, serving %s", db.blevePath)
+	}
+	if _, err := os.Stat(path + ".bleve.new"); !os.IsNotExist(err) {
+		t.Errorf("rebuilt index left behind: %v", err)
+	}
+	sr, err := NewBookmarkManager(db).Search(SearchOptions{Owner: 1, Query: "zeitung"})
+	if err != nil || len(sr.Hits) != 1 {
+		t.Errorf("expected the German bookmark after reopening, got %v %v", sr.Hits, err)
+	}
+}
+
+func TestFinishReindexDropsIncompleteIndex(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	db := &DB{}
+	_, err := db.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	// a rebuild which stopped before it was swapped in
+	err = os.Mkdir(path+".bleve.new", 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db = &DB{}
+	_, err = db.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if db.blevePath != path+".bleve" {
+		t.Errorf("expected the old index, serving %s", db.blevePath)
+	}
+	if _, err := os.Stat(path + ".bleve.new"); !os.IsNotExist(err) {
+		t.Errorf("incomplete index left behind: %v", err)
+	}
+}
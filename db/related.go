@@ -0,0 +1,159 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/blevesearch/bleve/v2"
+	index "github.com/blevesearch/bleve_index_api"
+	"github.com/tardisx/linkwallet/entity"
+)
+
+// relatedTerms is the number of a bookmark's most distinctive terms which
+// are looked for in others to find related ones.
+const relatedTerms = 25
+
+// relatedTitleWeight is how many times a term in the title counts for,
+// compared to one in the page text.
+const relatedTitleWeight = 3
+
+// weightedTerm is a term in a field, weighted by how distinctive it is of
+// a bookmark.
+type weightedTerm struct {
+	field  string
+	term   string
+	weight float64
+}
+
+// Related returns up to size of the owner's other bookmarks on the same
+// topic as bm, the most similar first.
+//
+// The terms of bm's title, page text and tags are weighted by TF-IDF: how
+// often each appears in bm, against how many bookmarks in the index have
+// it. The most distinctive are then searched for, each boosted by its
+// weight.
+func (m *BookmarkManager) Related(bm entity.Bookmark, size int) ([]entity.BookmarkSearchResult, error) {
+	related := []entity.BookmarkSearchResult{}
+	terms, err := m.distinctiveTerms(bm)
+	if err != nil {
+		return nil, err
+	}
+	if len(terms) == 0 {
+		return related, nil
+	}
+
+	similar := bleve.NewDisjunctionQuery()
+	for _, t := range terms {
+		tq := bleve.NewTermQuery(t.term)
+		tq.SetField(t.field)
+		tq.SetBoost(t.weight)
+		similar.AddQuery(tq)
+	}
+	q := bleve.NewBooleanQuery()
+	q.AddMust(ownerQuery(bm.Owner), similar)
+	q.AddMustNot(bleve.NewDocIDQuery([]string{strconv.FormatUint(bm.ID, 10)}))
+
+	req := bleve.NewSearchRequestOptions(q, size, 0, false)
+	sr, err := m.db.bleve.Search(req)
+	if err != nil {
+		return nil, fmt.Errorf("related search failed: %w", err)
+	}
+	bookmarks, err := m.loadHits(sr.Hits)
+	if err != nil {
+		return nil, err
+	}
+	for _, dm := range sr.Hits {
+		if bm, ok := bookmarks[dm.ID]; ok {
+			related = append(related, entity.BookmarkSearchResult{Bookmark: bm, Score: dm.Score})
+		}
+	}
+	return related, nil
+}
+
+// distinctiveTerms returns the terms of the bookmark with the highest
+// TF-IDF weights, analysed as they are in the index.
+func (m *BookmarkManager) distinctiveTerms(bm entity.Bookmark) ([]weightedTerm, error) {
+	name := languageAnalyzer(bm.Info.Language)
+	analyzer := m.db.bleve.Mapping().AnalyzerNamed(name)
+	if analyzer == nil {
+		return nil, fmt.Errorf("no %s analyzer", name)
+	}
+
+	// term frequencies in each field
+	type fieldTerm struct{ field, term string }
+	tf := map[fieldTerm]float64{}
+	count := func(field string, text string, weight float64) {
+		for _, token := range analyzer.Analyze([]byte(text)) {
+			term := string(token.Term)
+			// numbers and fragments say little about the topic
+			if utf8.RuneCountInString(term) < 3 || !isWord(term) {
+				continue
+			}
+			tf[fieldTerm{field, term}] += weight
+		}
+	}
+	count("Info.Title", bm.Info.Title, relatedTitleWeight)
+	count("Info.RawText", bm.Info.RawText, 1)
+	for _, tag := range bm.Tags {
+		tf[fieldTerm{"Tags", tag}] += relatedTitleWeight
+	}
+
+	idx, err := m.db.bleve.Advanced()
+	if err != nil {
+		return nil, fmt.Errorf("could not open index: %w", err)
+	}
+	reader, err := idx.Reader()
+	if err != nil {
+		return nil, fmt.Errorf("could not open index: %w", err)
+	}
+	defer reader.Close()
+	docs, err := reader.DocCount()
+	if err != nil {
+		return nil, fmt.Errorf("could not count documents: %w", err)
+	}
+
+	terms := []weightedTerm{}
+	for ft, freq := range tf {
+		df, err := docFrequency(reader, ft.field, ft.term)
+		if err != nil {
+			return nil, err
+		}
+		// terms only in this bookmark cannot find others
+		if df < 2 {
+			continue
+		}
+		idf := math.Log(float64(docs) / float64(df))
+		if idf <= 0 {
+			continue
+		}
+		terms = append(terms, weightedTerm{ft.field, ft.term, (1 + math.Log(freq)) * idf})
+	}
+	sort.Slice(terms, func(i, j int) bool {
+		if terms[i].weight != terms[j].weight {
+			return terms[i].weight > terms[j].weight
+		}
+		if terms[i].term != terms[j].term {
+			return terms[i].term < terms[j].term
+		}
+		return terms[i].field < terms[j].field
+	})
+	if len(terms) > relatedTerms {
+		terms = terms[:relatedTerms]
+	}
+	return terms, nil
+}
+
+// docFrequency returns the number of documents in the index with the term
+// in the field.
+func docFrequency(reader index.IndexReader, field string, term string) (uint64, error) {
+	tfr, err := reader.TermFieldReader(context.Background(), []byte(term), field, false, false, false)
+	if err != nil {
+		return 0, fmt.Errorf("could not read %s terms: %w", field, err)
+	}
+	defer tfr.Close()
+	return tfr.Count(), nil
+}
@@ -0,0 +1,50 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/tardisx/linkwallet/entity"
+)
+
+func TestRelated(t *testing.T) {
+	db := newTestDB(t)
+	bmm := NewBookmarkManager(db)
+
+	bookmarks := []entity.Bookmark{
+		{URL: "https://example.com/operators", Owner: 1, Tags: []string{"kubernetes"}, Info: entity.PageInfo{Title: "Writing Kubernetes operators",
+			RawText: "controllers reconcile custom resources in a cluster"}},
+		{URL: "https://example.com/controllers", Owner: 1, Info: entity.PageInfo{Title: "Kubernetes controllers explained",
+			RawText: "a controller watches resources and reconciles the cluster state"}},
+		{URL: "https://example.com/sourdough", Owner: 1, Tags: []string{"baking"}, Info: entity.PageInfo{Title: "Sourdough starter",
+			RawText: "feed the starter flour and water"}},
+		{URL: "https://example.com/bread", Owner: 1, Tags: []string{"baking"}, Info: entity.PageInfo{Title: "Bread in a cluster of ovens",
+			RawText: "flour, water and salt"}},
+		{URL: "https://example.com/theirs", Owner: 2, Tags: []string{"kubernetes"}, Info: entity.PageInfo{Title: "Kubernetes operators at scale",
+			RawText: "operators reconcile custom resources"}},
+	}
+	for i := range bookmarks {
+		err := bmm.AddBookmark(&bookmarks[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		bmm.UpdateIndexForBookmark(&bookmarks[i])
+	}
+
+	related, err := bmm.Related(bookmarks[0], 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(related) == 0 || related[0].Bookmark.URL != "https://example.com/controllers" {
+		t.Fatalf("expected the other kubernetes bookmark first, got %v", related)
+	}
+	for _, r := range related {
+		if r.Bookmark.ID == bookmarks[0].ID || r.Bookmark.Owner != 1 {
+			t.Errorf("unexpected related bookmark %s", r.Bookmark.URL)
+		}
+	}
+
+	related, _ = bmm.Related(bookmarks[2], 1)
+	if len(related) != 1 || related[0].Bookmark.URL != "https://example.com/bread" {
+		t.Errorf("expected the other baking bookmark, got %v", related)
+	}
+}
@@ -0,0 +1,221 @@
+package db
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/tardisx/linkwallet/entity"
+	bolthold "github.com/timshannon/bolthold"
+)
+
+var ErrSavedSearchNotFound = errors.New("saved search not found")
+
+type SavedSearchManager struct {
+	db *DB
+}
+
+func NewSavedSearchManager(db *DB) *SavedSearchManager {
+	return &SavedSearchManager{db: db}
+}
+
+// checkSavedSearch tidies up a saved search, and checks that it has a name
+// and will run.
+func checkSavedSearch(ss *entity.SavedSearch) error {
+	ss.Name = strings.TrimSpace(ss.Name)
+	ss.Query = strings.TrimSpace(ss.Query)
+	if ss.Name == "" {
+		return errors.New("a saved search needs a name")
+	}
+	if ss.Query != "" {
+		_, err := parseQuery(ss.Query)
+		if err != nil {
+			return err
+		}
+	}
+	if ss.Period != "" {
+		_, _, err := periodRange(ss.Period)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// newFeedToken returns a new secret for the address of a feed.
+func newFeedToken() (string, error) {
+	b := make([]byte, 24)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", fmt.Errorf("could not generate feed token: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// AddSavedSearch saves a new search. The ID, FeedToken and Created fields
+// are set.
+func (ssm *SavedSearchManager) AddSavedSearch(ss *entity.SavedSearch) error {
+	err := checkSavedSearch(ss)
+	if err != nil {
+		return err
+	}
+	ss.FeedToken, err = newFeedToken()
+	if err != nil {
+		return err
+	}
+	ss.Created = time.Now()
+	err = ssm.db.store.Insert(bolthold.NextSequence(), ss)
+	if err != nil {
+		return fmt.Errorf("could not save search: %w", err)
+	}
+	return nil
+}
+
+// UpdateSavedSearch saves changes to one of the owner's searches. The feed
+// token is only changed by RegenerateFeedToken and DisableFeed.
+func (ssm *SavedSearchManager) UpdateSavedSearch(ss *entity.SavedSearch) error {
+	existing, err := ssm.LoadSavedSearch(ss.Owner, ss.ID)
+	if err != nil {
+		return err
+	}
+	err = checkSavedSearch(ss)
+	if err != nil {
+		return err
+	}
+	ss.FeedToken = existing.FeedToken
+	ss.Created = existing.Created
+	err = ssm.db.store.Update(ss.ID, ss)
+	if err != nil {
+		return fmt.Errorf("could not save search: %w", err)
+	}
+	return nil
+}
+
+// RegenerateFeedToken gives the feed of one of the owner's searches a new
+// address, turning it on if it was off. The old address stops working.
+func (ssm *SavedSearchManager) RegenerateFeedToken(owner uint64, id uint64) (entity.SavedSearch, error) {
+	token, err := newFeedToken()
+	if err != nil {
+		return entity.SavedSearch{}, err
+	}
+	return ssm.setFeedToken(owner, id, token)
+}
+
+// DisableFeed turns off the feed of one of the owner's searches, until
+// RegenerateFeedToken gives it a new address.
+func (ssm *SavedSearchManager) DisableFeed(owner uint64, id uint64) (entity.SavedSearch, error) {
+	return ssm.setFeedToken(owner, id, "")
+}
+
+func (ssm *SavedSearchManager) setFeedToken(owner uint64, id uint64, token string) (entity.SavedSearch, error) {
+	ss, err := ssm.LoadSavedSearch(owner, id)
+	if err != nil {
+		return ss, err
+	}
+	ss.FeedToken = token
+	err = ssm.db.store.Update(ss.ID, &ss)
+	if err != nil {
+		return ss, fmt.Errorf("could not save search: %w", err)
+	}
+	return ss, nil
+}
+
+// LoadSavedSearch loads one of the owner's saved searches.
+func (ssm *SavedSearchManager) LoadSavedSearch(owner uint64, id uint64) (entity.SavedSearch, error) {
+	ss := entity.SavedSearch{}
+	err := ssm.db.store.Get(id, &ss)
+	if err == bolthold.ErrNotFound || (err == nil && ss.Owner != owner) {
+		return entity.SavedSearch{}, ErrSavedSearchNotFound
+	} else if err != nil {
+		return entity.SavedSearch{}, fmt.Errorf("could not load saved search: %w", err)
+	}
+	return ss, nil
+}
+
+// LoadSavedSearchByFeedToken loads the saved search with the feed token.
+// Searches with their feed turned off have no token, and are not found.
+func (ssm *SavedSearchManager) LoadSavedSearchByFeedToken(token string) (entity.SavedSearch, error) {
+	ss := entity.SavedSearch{}
+	if token == "" {
+		return ss, ErrSavedSearchNotFound
+	}
+	err := ssm.db.store.FindOne(&ss, bolthold.Where("FeedToken").Eq(token))
+	if err == bolthold.ErrNotFound {
+		return ss, ErrSavedSearchNotFound
+	} else if err != nil {
+		return ss, fmt.Errorf("could not load saved search: %w", err)
+	}
+	return ss, nil
+}
+
+// SavedSearches returns all of the owner's saved searches, by name.
+func (ssm *SavedSearchManager) SavedSearches(owner uint64) ([]entity.SavedSearch, error) {
+	searches := []entity.SavedSearch{}
+	err := ssm.db.store.Find(&searches, bolthold.Where("Owner").Eq(owner))
+	if err != nil {
+		return nil, fmt.Errorf("could not load saved searches: %w", err)
+	}
+	sort.Slice(searches, func(i, j int) bool {
+		return strings.ToLower(searches[i].Name) < strings.ToLower(searches[j].Name)
+	})
+	return searches, nil
+}
+
+// DeleteSavedSearch deletes one of the owner's saved searches.
+func (ssm *SavedSearchManager) DeleteSavedSearch(owner uint64, id uint64) error {
+	_, err := ssm.LoadSavedSearch(owner, id)
+	if err != nil {
+		return err
+	}
+	err = ssm.db.store.Delete(id, &entity.SavedSearch{})
+	if err != nil {
+		return fmt.Errorf("could not delete saved search: %w", err)
+	}
+	return nil
+}
+
+// SortFields maps the sorts of the manage view and saved searches to the
+// index fields they sort on.
+var SortFields = map[string]string{
+	"title":   "Info.TitleSort",
+	"created": "TimestampCreated",
+	"scraped": "TimestampLastScraped",
+	"status":  "Info.StatusCode",
+	"size":    "Info.Size",
+}
+
+// DefaultSort is the sort used when none is given, newest first.
+const DefaultSort = "-created"
+
+// SortOrder returns the SearchOptions.Sort for a key of SortFields,
+// prefixed with - for descending order, or for DefaultSort if it is not
+// one. Results with the same sort value are ordered by ID, so that paging
+// through them is stable.
+func SortOrder(sort string) []string {
+	field, ok := SortFields[strings.TrimPrefix(sort, "-")]
+	if !ok {
+		return SortOrder(DefaultSort)
+	}
+	if strings.HasPrefix(sort, "-") {
+		field = "-" + field
+	}
+	return []string{field, "_id"}
+}
+
+// SavedSearchOptions returns the options to run a saved search, in its
+// sort order.
+func SavedSearchOptions(ss entity.SavedSearch) SearchOptions {
+	return SearchOptions{
+		Owner:  ss.Owner,
+		All:    ss.Query == "",
+		Query:  ss.Query,
+		Tags:   ss.Tags,
+		Domain: ss.Domain,
+		Period: ss.Period,
+		Sort:   SortOrder(ss.Sort),
+	}
+}
@@ -0,0 +1,140 @@
+package db
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/tardisx/linkwallet/entity"
+)
+
+func TestSavedSearches(t *testing.T) {
+	db := newTestDB(t)
+	bmm := NewBookmarkManager(db)
+	ssm := NewSavedSearchManager(db)
+
+	for _, bm := range []entity.Bookmark{
+		{URL: "https://example.com/operator", Owner: 1, Tags: []string{"kubernetes"}, Info: entity.PageInfo{Title: "Writing an operator"}},
+		{URL: "https://example.com/helm", Owner: 1, Tags: []string{"kubernetes"}, Info: entity.PageInfo{Title: "Helm charts"}},
+		{URL: "https://example.com/broken", Owner: 1, Info: entity.PageInfo{Title: "Gone", StatusCode: 404}},
+		{URL: "https://example.com/theirs", Owner: 2, Tags: []string{"kubernetes"}, Info: entity.PageInfo{Title: "Another operator"}},
+	} {
+		err := bmm.AddBookmark(&bm)
+		if err != nil {
+			t.Fatal(err)
+		}
+		bmm.UpdateIndexForBookmark(&bm)
+	}
+
+	for _, bad := range []entity.SavedSearch{
+		{Owner: 1, Name: "  ", Query: "operator"},
+		{Owner: 1, Name: "broken", Query: `"unterminated`},
+		{Owner: 1, Name: "when", Period: "yesterday"},
+	} {
+		if err := ssm.AddSavedSearch(&bad); err == nil {
+			t.Errorf("expected %+v to be rejected", bad)
+		}
+	}
+
+	operators := entity.SavedSearch{Owner: 1, Name: "operators", Query: "operator", Tags: []string{"kubernetes"}}
+	err := ssm.AddSavedSearch(&operators)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dead := entity.SavedSearch{Owner: 1, Name: "Dead links", Query: "status:404"}
+	err = ssm.AddSavedSearch(&dead)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if operators.ID == 0 || len(operators.FeedToken) < 32 || operators.FeedToken == dead.FeedToken {
+		t.Errorf("bad ID or feed token %+v", operators)
+	}
+
+	searches, err := ssm.SavedSearches(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(searches) != 2 || searches[0].Name != "Dead links" || searches[1].Name != "operators" {
+		t.Errorf("expected both searches by name, got %+v", searches)
+	}
+
+	count, err := bmm.Count(SavedSearchOptions(operators))
+	if err != nil || count != 1 {
+		t.Errorf("expected operators to find 1 bookmark, got %d (%v)", count, err)
+	}
+	found, err := bmm.MatchingBookmarks(SavedSearchOptions(dead))
+	if err != nil || len(found) != 1 || found[0].URL != "https://example.com/broken" {
+		t.Errorf("expected the broken link, got %v (%v)", found, err)
+	}
+
+	// in the saved order, and only as many as asked for
+	byTitle := SavedSearchOptions(entity.SavedSearch{Owner: 1, Tags: []string{"kubernetes"}, Sort: "title"})
+	found, err = bmm.MatchingBookmarks(byTitle)
+	if err != nil || len(found) != 2 || found[0].URL != "https://example.com/helm" {
+		t.Errorf("expected both by title, got %v (%v)", found, err)
+	}
+	byTitle.Results = 1
+	found, err = bmm.MatchingBookmarks(byTitle)
+	if err != nil || len(found) != 1 || found[0].URL != "https://example.com/helm" {
+		t.Errorf("expected just the first by title, got %v (%v)", found, err)
+	}
+	if sort := SortOrder("bogus"); sort[0] != "-TimestampCreated" {
+		t.Errorf("expected the default sort for a bad one, got %v", sort)
+	}
+
+	// other users can't see or change it
+	_, err = ssm.LoadSavedSearch(2, operators.ID)
+	if !errors.Is(err, ErrSavedSearchNotFound) {
+		t.Errorf("expected not found for another user, got %v", err)
+	}
+	stolen := operators
+	stolen.Owner = 2
+	if err := ssm.UpdateSavedSearch(&stolen); !errors.Is(err, ErrSavedSearchNotFound) {
+		t.Errorf("expected another user's update to fail, got %v", err)
+	}
+	if err := ssm.DeleteSavedSearch(2, operators.ID); !errors.Is(err, ErrSavedSearchNotFound) {
+		t.Errorf("expected another user's delete to fail, got %v", err)
+	}
+
+	// updates keep the feed token
+	token := operators.FeedToken
+	operators.Query = "helm"
+	operators.FeedToken = "chosen"
+	err = ssm.UpdateSavedSearch(&operators)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := ssm.LoadSavedSearchByFeedToken(token)
+	if err != nil || loaded.ID != operators.ID || loaded.Query != "helm" {
+		t.Errorf("expected the updated search by its original token, got %+v (%v)", loaded, err)
+	}
+	if _, err := ssm.LoadSavedSearchByFeedToken("chosen"); !errors.Is(err, ErrSavedSearchNotFound) {
+		t.Errorf("feed token should not be changeable, got %v", err)
+	}
+
+	// only the owner can change the feed, and a turned off feed is gone
+	if _, err := ssm.DisableFeed(2, operators.ID); !errors.Is(err, ErrSavedSearchNotFound) {
+		t.Errorf("expected another user's change of feed to fail, got %v", err)
+	}
+	renewed, err := ssm.RegenerateFeedToken(1, operators.ID)
+	if err != nil || renewed.FeedToken == token || len(renewed.FeedToken) < 32 {
+		t.Errorf("expected a new feed token, got %+v (%v)", renewed, err)
+	}
+	if _, err := ssm.LoadSavedSearchByFeedToken(token); !errors.Is(err, ErrSavedSearchNotFound) {
+		t.Errorf("expected the old feed token to stop working, got %v", err)
+	}
+	off, err := ssm.DisableFeed(1, operators.ID)
+	if err != nil || off.FeedToken != "" {
+		t.Errorf("expected the feed to be off, got %+v (%v)", off, err)
+	}
+	if _, err := ssm.LoadSavedSearchByFeedToken(renewed.FeedToken); !errors.Is(err, ErrSavedSearchNotFound) {
+		t.Errorf("expected the turned off feed to be gone, got %v", err)
+	}
+
+	err = ssm.DeleteSavedSearch(1, dead.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ssm.LoadSavedSearchByFeedToken(dead.FeedToken); !errors.Is(err, ErrSavedSearchNotFound) {
+		t.Errorf("expected deleted search's feed to be gone, got %v", err)
+	}
+}
@@ -0,0 +1,155 @@
+package db
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/tardisx/linkwallet/entity"
+	bolthold "github.com/timshannon/bolthold"
+)
+
+// searchHistorySize is the number of searches kept for each user. Older
+// ones are dropped as new ones are recorded.
+const searchHistorySize = 500
+
+// searchRefineWindow is how soon after a search one which adds to or
+// takes from the end of its query replaces it. The search box searches as
+// the query is typed, so without this every word would be recorded a
+// letter at a time.
+const searchRefineWindow = 10 * time.Second
+
+// SearchHistory is a user's recent searches, and their queries counted:
+// those searched for most, and those which found nothing.
+type SearchHistory struct {
+	Recent    []entity.SearchRecord
+	Common    []entity.QueryCount
+	NoResults []entity.QueryCount
+}
+
+// normalQuery returns the query as it is counted, ignoring case and
+// spacing.
+func normalQuery(q string) string {
+	return strings.Join(strings.Fields(strings.ToLower(q)), " ")
+}
+
+// refines reports whether the search replaces the previous one, as it was
+// typed straight after it.
+func refines(rec entity.SearchRecord, prev entity.SearchRecord) bool {
+	if rec.Timestamp.Sub(prev.Timestamp) > searchRefineWindow {
+		return false
+	}
+	q, p := strings.ToLower(rec.Query), strings.ToLower(prev.Query)
+	return strings.HasPrefix(q, p) || strings.HasPrefix(p, q)
+}
+
+// RecordSearch adds a search to the owner's history, dropping the oldest
+// if it is full.
+func (db *DB) RecordSearch(rec entity.SearchRecord) error {
+	rec.Query = strings.TrimSpace(rec.Query)
+	if rec.Query == "" {
+		return nil
+	}
+
+	txn, err := db.store.Bolt().Begin(true)
+	if err != nil {
+		return fmt.Errorf("could not start transaction for record search: %s", err)
+	}
+
+	records := []entity.SearchRecord{}
+	err = db.store.TxFind(txn, &records, bolthold.Where("Owner").Eq(rec.Owner))
+	if err != nil {
+		txn.Rollback()
+		return fmt.Errorf("could not load search history: %s", err)
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].ID < records[j].ID })
+
+	if n := len(records); n > 0 && refines(rec, records[n-1]) {
+		rec.ID = records[n-1].ID
+		err = db.store.TxUpdate(txn, rec.ID, &rec)
+	} else {
+		err = db.store.TxInsert(txn, bolthold.NextSequence(), &rec)
+		records = append(records, rec)
+	}
+	if err != nil {
+		txn.Rollback()
+		return fmt.Errorf("could not record search: %s", err)
+	}
+
+	for len(records) > searchHistorySize {
+		err = db.store.TxDelete(txn, records[0].ID, &entity.SearchRecord{})
+		if err != nil {
+			txn.Rollback()
+			return fmt.Errorf("could not drop old search: %s", err)
+		}
+		records = records[1:]
+	}
+
+	err = txn.Commit()
+	if err != nil {
+		return fmt.Errorf("could not commit record search transaction: %s", err)
+	}
+	return nil
+}
+
+// SearchHistory returns up to size of the owner's most recent searches,
+// most common queries and queries which found nothing. Queries are counted
+// ignoring case and spacing, and shown as last searched for.
+func (m *BookmarkManager) SearchHistory(owner uint64, size int) (SearchHistory, error) {
+	history := SearchHistory{Recent: []entity.SearchRecord{}, Common: []entity.QueryCount{}, NoResults: []entity.QueryCount{}}
+	records := []entity.SearchRecord{}
+	err := m.db.store.Find(&records, bolthold.Where("Owner").Eq(owner))
+	if err != nil {
+		return history, fmt.Errorf("could not load search history: %w", err)
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].ID > records[j].ID })
+
+	counts := map[string]*entity.QueryCount{}
+	for _, rec := range records {
+		key := normalQuery(rec.Query)
+		if qc, ok := counts[key]; ok {
+			qc.Count++
+			continue
+		}
+		// the newest record of each query comes first
+		counts[key] = &entity.QueryCount{Query: rec.Query, Count: 1, Hits: rec.Hits, Last: rec.Timestamp}
+	}
+	for _, qc := range counts {
+		history.Common = append(history.Common, *qc)
+		if qc.Hits == 0 {
+			history.NoResults = append(history.NoResults, *qc)
+		}
+	}
+	byCount := func(queries []entity.QueryCount) {
+		sort.Slice(queries, func(i, j int) bool {
+			if queries[i].Count != queries[j].Count {
+				return queries[i].Count > queries[j].Count
+			}
+			return queries[i].Last.After(queries[j].Last)
+		})
+	}
+	byCount(history.Common)
+	byCount(history.NoResults)
+
+	if len(records) > size {
+		records = records[:size]
+	}
+	history.Recent = records
+	if len(history.Common) > size {
+		history.Common = history.Common[:size]
+	}
+	if len(history.NoResults) > size {
+		history.NoResults = history.NoResults[:size]
+	}
+	return history, nil
+}
+
+// ClearSearchHistory forgets all of the owner's searches.
+func (m *BookmarkManager) ClearSearchHistory(owner uint64) error {
+	err := m.db.store.DeleteMatching(&entity.SearchRecord{}, bolthold.Where("Owner").Eq(owner))
+	if err != nil {
+		return fmt.Errorf("could not clear search history: %w", err)
+	}
+	return nil
+}
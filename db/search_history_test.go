@@ -0,0 +1,117 @@
+package db
+
+import (
+	"testing"
+	"time"
+
+	"github.com/tardisx/linkwallet/entity"
+	bolthold "github.com/timshannon/bolthold"
+)
+
+func TestSearchHistory(t *testing.T) {
+	db := newTestDB(t)
+	bmm := NewBookmarkManager(db)
+
+	for _, bm := range []entity.Bookmark{
+		{URL: "https://example.com/operator", Owner: 1, Tags: []string{"kubernetes"}, Info: entity.PageInfo{Title: "Writing an operator"}},
+		{URL: "https://example.com/theirs", Owner: 2, Info: entity.PageInfo{Title: "Another operator"}},
+	} {
+		err := bmm.AddBookmark(&bm)
+		if err != nil {
+			t.Fatal(err)
+		}
+		bmm.UpdateIndexForBookmark(&bm)
+	}
+
+	for _, opts := range []SearchOptions{
+		{Owner: 1, Query: "operator"},
+		{Owner: 1, Query: "zebra"},
+		{Owner: 1, Query: "  Operator "},
+		{Owner: 1, All: true, Tags: []string{"kubernetes"}},
+		{Owner: 1, Query: "operator", PublicOnly: true},
+		{Owner: 2, Query: "helm"},
+	} {
+		_, err := bmm.Search(opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	h, err := bmm.SearchHistory(1, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(h.Recent) != 3 || h.Recent[0].Query != "Operator" || h.Recent[1].Query != "zebra" || h.Recent[1].Hits != 0 || h.Recent[2].Hits != 1 {
+		t.Errorf("wrong recent searches %+v", h.Recent)
+	}
+	if len(h.Common) != 2 || h.Common[0].Query != "Operator" || h.Common[0].Count != 2 || h.Common[1].Query != "zebra" {
+		t.Errorf("wrong common queries %+v", h.Common)
+	}
+	if len(h.NoResults) != 1 || h.NoResults[0].Query != "zebra" {
+		t.Errorf("wrong queries without results %+v", h.NoResults)
+	}
+
+	err = bmm.ClearSearchHistory(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, _ = bmm.SearchHistory(1, 10)
+	if len(h.Recent) != 0 {
+		t.Errorf("history not cleared %+v", h.Recent)
+	}
+	h, _ = bmm.SearchHistory(2, 10)
+	if len(h.Recent) != 1 || h.Recent[0].Query != "helm" {
+		t.Errorf("other user's history changed %+v", h.Recent)
+	}
+}
+
+func TestRecordSearchRefinesAndCaps(t *testing.T) {
+	db := newTestDB(t)
+	bmm := NewBookmarkManager(db)
+
+	start := time.Now()
+	for i, q := range []string{"k", "ku", "kube", "kub", "kubernetes"} {
+		err := db.RecordSearch(entity.SearchRecord{Owner: 1, Query: q, Timestamp: start.Add(time.Duration(i) * time.Second)})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	// a query typed long after is a new search
+	err := db.RecordSearch(entity.SearchRecord{Owner: 1, Query: "kubernetes operator", Timestamp: start.Add(time.Minute)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, _ := bmm.SearchHistory(1, 10)
+	if len(h.Recent) != 2 || h.Recent[0].Query != "kubernetes operator" || h.Recent[1].Query != "kubernetes" {
+		t.Fatalf("typing not recorded as one search %+v", h.Recent)
+	}
+
+	// fill the history in one go, then record past the end of it
+	txn, err := db.store.Bolt().Begin(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < searchHistorySize; i++ {
+		err = db.store.TxInsert(txn, bolthold.NextSequence(), &entity.SearchRecord{Owner: 1, Query: "q", Timestamp: start.Add(time.Hour)})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = txn.Commit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		err := db.RecordSearch(entity.SearchRecord{Owner: 1, Query: "q", Timestamp: start.Add(time.Duration(i+2) * time.Hour)})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	h, _ = bmm.SearchHistory(1, searchHistorySize+10)
+	if len(h.Recent) != searchHistorySize {
+		t.Errorf("expected history capped at %d, got %d", searchHistorySize, len(h.Recent))
+	}
+	if len(h.Common) != 1 || h.Common[0].Count != searchHistorySize {
+		t.Errorf("expected oldest searches dropped, got %+v", h.Common)
+	}
+}
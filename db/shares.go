@@ -0,0 +1,104 @@
+package db
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/tardisx/linkwallet/entity"
+	bolthold "github.com/timshannon/bolthold"
+)
+
+var ErrShareNotFound = errors.New("share not found")
+
+type ShareManager struct {
+	db *DB
+}
+
+func NewShareManager(db *DB) *ShareManager {
+	return &ShareManager{db: db}
+}
+
+// CreateShare creates a new share link for the owner's public bookmarks,
+// optionally limited to those with tag. Tags are lowercase, like those of
+// bookmarks.
+func (sm *ShareManager) CreateShare(owner uint64, tag string) (entity.Share, error) {
+	b := make([]byte, 24)
+	_, err := rand.Read(b)
+	if err != nil {
+		return entity.Share{}, fmt.Errorf("could not generate share token: %w", err)
+	}
+	share := entity.Share{
+		Token:   base64.RawURLEncoding.EncodeToString(b),
+		Owner:   owner,
+		Tag:     strings.ToLower(strings.TrimSpace(tag)),
+		Created: time.Now(),
+	}
+	err = sm.db.store.Insert(share.Token, &share)
+	if err != nil {
+		return entity.Share{}, fmt.Errorf("could not save share: %w", err)
+	}
+	return share, nil
+}
+
+// LoadShare loads the share with the given token.
+func (sm *ShareManager) LoadShare(token string) (entity.Share, error) {
+	share := entity.Share{}
+	err := sm.db.store.Get(token, &share)
+	if err == bolthold.ErrNotFound {
+		return share, ErrShareNotFound
+	} else if err != nil {
+		return share, fmt.Errorf("could not load share: %w", err)
+	}
+	return share, nil
+}
+
+// Shares returns all of the owner's shares, oldest first.
+func (sm *ShareManager) Shares(owner uint64) ([]entity.Share, error) {
+	shares := []entity.Share{}
+	err := sm.db.store.Find(&shares, bolthold.Where("Owner").Eq(owner))
+	if err != nil {
+		return nil, fmt.Errorf("could not load shares: %w", err)
+	}
+	sort.Slice(shares, func(i, j int) bool { return shares[i].Created.Before(shares[j].Created) })
+	return shares, nil
+}
+
+// RevokeShare deletes a share, so the link no longer works.
+func (sm *ShareManager) RevokeShare(owner uint64, token string) error {
+	share, err := sm.LoadShare(token)
+	if err != nil {
+		return err
+	}
+	if share.Owner != owner {
+		return ErrShareNotFound
+	}
+	err = sm.db.store.Delete(token, &entity.Share{})
+	if err != nil {
+		return fmt.Errorf("could not delete share: %w", err)
+	}
+	return nil
+}
+
+// SharedBookmarks returns the bookmarks visible through the share, newest
+// first. publicTags are the owner's public tags.
+func (sm *ShareManager) SharedBookmarks(share entity.Share, publicTags []string) ([]entity.Bookmark, error) {
+	bookmarks, err := sm.db.bookmarksForOwner(share.Owner)
+	if err != nil {
+		return nil, err
+	}
+	shared := []entity.Bookmark{}
+	for _, bm := range bookmarks {
+		if share.Tag != "" && !bm.HasTag(share.Tag) {
+			continue
+		}
+		if bm.IsPublic(publicTags) {
+			shared = append(shared, bm)
+		}
+	}
+	return shared, nil
+}
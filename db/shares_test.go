@@ -0,0 +1,88 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/tardisx/linkwallet/entity"
+)
+
+func TestShares(t *testing.T) {
+	db := newTestDB(t)
+	bmm := NewBookmarkManager(db)
+	sm := NewShareManager(db)
+
+	publicTags := []string{"onboarding"}
+	bookmarks := []entity.Bookmark{
+		{URL: "http://example.com/public", Info: entity.PageInfo{Title: "A guide"}, Owner: 1, Public: true},
+		{URL: "http://example.com/onboarding", Info: entity.PageInfo{Title: "A guide"}, Owner: 1, Tags: []string{"onboarding"}},
+		{URL: "http://example.com/private", Info: entity.PageInfo{Title: "A guide"}, Owner: 1, Tags: []string{"secret"}},
+		{URL: "http://example.com/other", Info: entity.PageInfo{Title: "A guide"}, Owner: 2, Public: true, Tags: []string{"onboarding"}},
+	}
+	for i := range bookmarks {
+		err := bmm.AddBookmark(&bookmarks[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		bmm.UpdateIndexForBookmark(&bookmarks[i])
+	}
+
+	all, err := sm.CreateShare(1, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tagged, err := sm.CreateShare(1, " Onboarding ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tagged.Tag != "onboarding" {
+		t.Errorf("expected tag to be lowercased, got %q", tagged.Tag)
+	}
+	if len(all.Token) < 32 || all.Token == tagged.Token {
+		t.Errorf("bad share tokens %q %q", all.Token, tagged.Token)
+	}
+
+	shares, _ := sm.Shares(1)
+	if len(shares) != 2 {
+		t.Errorf("expected 2 shares, got %d", len(shares))
+	}
+
+	shared, err := sm.SharedBookmarks(all, publicTags)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(shared) != 2 {
+		t.Errorf("expected 2 shared bookmarks, got %d", len(shared))
+	}
+	for _, bm := range shared {
+		if bm.URL == "http://example.com/private" || bm.Owner != 1 {
+			t.Errorf("%s should not be shared", bm.URL)
+		}
+	}
+
+	shared, _ = sm.SharedBookmarks(tagged, publicTags)
+	if len(shared) != 1 || shared[0].URL != "http://example.com/onboarding" {
+		t.Errorf("unexpected bookmarks for tagged share: %v", shared)
+	}
+
+	res, _ := bmm.Search(SearchOptions{Owner: 1, Query: "guide", PublicOnly: true, PublicTags: publicTags})
+	if len(res.Hits) != 2 {
+		t.Errorf("expected 2 public search results, got %d", len(res.Hits))
+	}
+	res, _ = bmm.Search(SearchOptions{Owner: 1, Query: "guide", PublicOnly: true, PublicTags: publicTags, Tags: []string{"onboarding"}})
+	if len(res.Hits) != 1 {
+		t.Errorf("expected 1 public search result for tag, got %d", len(res.Hits))
+	}
+
+	err = sm.RevokeShare(2, all.Token)
+	if err == nil {
+		t.Error("should not be able to revoke another user's share")
+	}
+	err = sm.RevokeShare(1, all.Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = sm.LoadShare(all.Token)
+	if err != ErrShareNotFound {
+		t.Errorf("revoked share should not load, got %v", err)
+	}
+}
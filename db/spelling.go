@@ -0,0 +1,216 @@
+package db
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/blevesearch/bleve/v2"
+	"github.com/blevesearch/bleve/v2/search"
+	"github.com/blevesearch/bleve/v2/search/query"
+	index "github.com/blevesearch/bleve_index_api"
+)
+
+// wordFields are the fields holding the whole words of titles and page
+// text, which fuzzy searches and spelling corrections work from.
+var wordFields = []string{"Info.TitleWords", "Info.RawTextWords"}
+
+// maxFuzziness is the most edits bleve allows in a fuzzy query.
+const maxFuzziness = 2
+
+// didYouMeanSize is the number of corrected queries suggested for a
+// search which found nothing.
+const didYouMeanSize = 3
+
+// wordFuzziness returns the number of edits allowed in word, up to max.
+// Words under three letters must be exact and words under six can have
+// one edit, or too much would match them.
+func wordFuzziness(word string, max int) int {
+	max = min(max, maxFuzziness)
+	switch n := utf8.RuneCountInString(word); {
+	case n < 3:
+		return 0
+	case n < 6:
+		return min(max, 1)
+	}
+	return max
+}
+
+// isWord reports whether s is made only of letters, and so could be a
+// misspelling.
+func isWord(s string) bool {
+	return s != "" && strings.IndexFunc(s, func(r rune) bool { return !unicode.IsLetter(r) }) == -1
+}
+
+// fuzzyQueries returns queries matching words close to word in the
+// fields, or none if it is not a word or fuzziness allows no edits.
+func fuzzyQueries(word string, fuzziness int, fields ...string) []query.Query {
+	word = strings.ToLower(word)
+	d := wordFuzziness(word, fuzziness)
+	if d == 0 || !isWord(word) {
+		return nil
+	}
+	queries := []query.Query{}
+	for _, f := range fields {
+		fq := bleve.NewFuzzyQuery(word)
+		fq.SetFuzziness(d)
+		fq.SetField(f)
+		queries = append(queries, fq)
+	}
+	return queries
+}
+
+// corrections returns the query with the words which are in none of the
+// owner's bookmarks replaced by the closest that are, the best first. It
+// returns nothing if every word is known, or none have close matches.
+func (m *BookmarkManager) corrections(owner uint64, q string, fuzziness int) ([]string, error) {
+	tokens, err := lexQuery(q)
+	if err != nil {
+		return nil, err
+	}
+
+	type misspelling struct {
+		start, end int
+		spellings  []string
+	}
+	misspellings := []misspelling{}
+	for _, t := range tokens {
+		if t.kind != tokTerm || t.phrase || (t.field != "" && t.field != "title") {
+			continue
+		}
+		word := strings.ToLower(t.value)
+		d := wordFuzziness(word, fuzziness)
+		if d == 0 || !isWord(word) {
+			continue
+		}
+		count, err := m.termCount(owner, "", "word", word)
+		if err != nil {
+			return nil, err
+		}
+		if count > 0 {
+			continue
+		}
+		spellings, err := m.spellings(owner, word, d)
+		if err != nil {
+			return nil, err
+		}
+		if len(spellings) > 0 {
+			misspellings = append(misspellings, misspelling{t.start, t.end, spellings})
+		}
+	}
+	if len(misspellings) == 0 {
+		return nil, nil
+	}
+
+	// the first correction uses the best spelling of each word, the
+	// others the next best of each, where there is one
+	r := []rune(q)
+	queries := []string{}
+	seen := map[string]bool{}
+	for i := 0; i < didYouMeanSize; i++ {
+		b := strings.Builder{}
+		pos := 0
+		for _, ms := range misspellings {
+			b.WriteString(string(r[pos:ms.start]))
+			b.WriteString(ms.spellings[min(i, len(ms.spellings)-1)])
+			pos = ms.end
+		}
+		b.WriteString(string(r[pos:]))
+		if !seen[b.String()] {
+			seen[b.String()] = true
+			queries = append(queries, b.String())
+		}
+	}
+	return queries, nil
+}
+
+// spellings returns the words in the owner's bookmarks up to fuzziness
+// edits from word, the closest and then the most used first.
+//
+// As with suggestions, the dictionaries cover every user's bookmarks, so
+// the most common candidates are each counted in the owner's own.
+func (m *BookmarkManager) spellings(owner uint64, word string, fuzziness int) ([]string, error) {
+	idx, err := m.db.bleve.Advanced()
+	if err != nil {
+		return nil, fmt.Errorf("could not open index: %w", err)
+	}
+	reader, err := idx.Reader()
+	if err != nil {
+		return nil, fmt.Errorf("could not open index: %w", err)
+	}
+	defer reader.Close()
+	fuzzyReader, ok := reader.(index.IndexReaderFuzzy)
+	if !ok {
+		return nil, nil
+	}
+
+	type candidate struct {
+		term     string
+		distance int
+		count    uint64
+	}
+	found := map[string]*candidate{}
+	for _, field := range wordFields {
+		dict, err := fuzzyReader.FieldDictFuzzy(field, word, fuzziness, "")
+		if err != nil {
+			return nil, fmt.Errorf("could not read %s terms: %w", field, err)
+		}
+		for {
+			de, err := dict.Next()
+			if err != nil {
+				dict.Close()
+				return nil, fmt.Errorf("could not read %s terms: %w", field, err)
+			}
+			if de == nil {
+				break
+			}
+			if de.Term == word {
+				continue
+			}
+			if c, ok := found[de.Term]; ok {
+				c.count += de.Count
+				continue
+			}
+			found[de.Term] = &candidate{de.Term, search.LevenshteinDistance(word, de.Term), de.Count}
+		}
+		dict.Close()
+	}
+
+	candidates := []candidate{}
+	for _, c := range found {
+		candidates = append(candidates, *c)
+	}
+	closer := func(a, b candidate) bool {
+		if a.distance != b.distance {
+			return a.distance < b.distance
+		}
+		if a.count != b.count {
+			return a.count > b.count
+		}
+		return a.term < b.term
+	}
+	sort.Slice(candidates, func(i, j int) bool { return closer(candidates[i], candidates[j]) })
+	if len(candidates) > suggestCandidates {
+		candidates = candidates[:suggestCandidates]
+	}
+
+	owned := []candidate{}
+	for _, c := range candidates {
+		count, err := m.termCount(owner, "", "word", c.term)
+		if err != nil {
+			return nil, err
+		}
+		if count > 0 {
+			owned = append(owned, candidate{c.term, c.distance, uint64(count)})
+		}
+	}
+	sort.Slice(owned, func(i, j int) bool { return closer(owned[i], owned[j]) })
+
+	spellings := []string{}
+	for _, c := range owned {
+		spellings = append(spellings, c.term)
+	}
+	return spellings, nil
+}
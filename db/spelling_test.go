@@ -0,0 +1,82 @@
+package db
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/tardisx/linkwallet/entity"
+)
+
+func TestWordFuzziness(t *testing.T) {
+	tcs := []struct {
+		word string
+		max  int
+		want int
+	}{
+		{"go", 2, 0},
+		{"git", 2, 1},
+		{"rusty", 2, 1},
+		{"golang", 2, 2},
+		{"golang", 1, 1},
+		{"golang", 5, 2},
+		{"golang", 0, 0},
+	}
+	for _, tc := range tcs {
+		if got := wordFuzziness(tc.word, tc.max); got != tc.want {
+			t.Errorf("%q with %d: got %d, want %d", tc.word, tc.max, got, tc.want)
+		}
+	}
+}
+
+func TestFuzzySearch(t *testing.T) {
+	db := newTestDB(t)
+	bmm := NewBookmarkManager(db)
+
+	for _, bm := range []entity.Bookmark{
+		{URL: "https://example.com/1", Owner: 1, Info: entity.PageInfo{Title: "Kubernetes operators", RawText: "reconcile loops"}},
+		{URL: "https://example.com/2", Owner: 1, Info: entity.PageInfo{Title: "Postgres replication"}},
+		{URL: "https://example.com/3", Owner: 2, Info: entity.PageInfo{Title: "Kubeflow pipelines"}},
+	} {
+		err := bmm.AddBookmark(&bm)
+		if err != nil {
+			t.Fatal(err)
+		}
+		bmm.UpdateIndexForBookmark(&bm)
+	}
+
+	search := func(q string, fuzziness int) SearchResults {
+		res, err := bmm.Search(SearchOptions{Owner: 1, Query: q, Fuzziness: fuzziness})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res
+	}
+
+	res := search("kubernetis", 1)
+	if !res.Fuzzy || res.Total != 1 || res.Hits[0].Bookmark.URL != "https://example.com/1" {
+		t.Errorf("expected a fuzzy match on the first bookmark, got %+v", res)
+	}
+	if !slices.Equal(res.DidYouMean, []string{"kubernetes"}) {
+		t.Errorf("expected a correction, got %v", res.DidYouMean)
+	}
+
+	// only the misspelt word is replaced
+	res = search("title:postgress -reconcile", 1)
+	if !slices.Equal(res.DidYouMean, []string{"title:postgres -reconcile"}) {
+		t.Errorf("expected a correction in place, got %v", res.DidYouMean)
+	}
+
+	// exact matches are not loosened
+	res = search("postgres", 1)
+	if res.Fuzzy || res.DidYouMean != nil || res.Total != 1 {
+		t.Errorf("expected an exact match, got %+v", res)
+	}
+
+	// off, and other users' words are never suggested
+	if res := search("kubernetis", 0); res.Total != 0 || res.DidYouMean != nil {
+		t.Errorf("expected nothing with fuzziness off, got %+v", res)
+	}
+	if res := search("kubeflw", 1); res.Total != 0 || res.DidYouMean != nil {
+		t.Errorf("expected nothing from another user, got %+v", res)
+	}
+}
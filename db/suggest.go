@@ -0,0 +1,247 @@
+package db
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/blevesearch/bleve/v2"
+)
+
+// suggestCandidates is the number of terms from each field's dictionary
+// in the owner's bookmarks, the most common across all users first, which
+// are suggested from.
+const suggestCandidates = 20
+
+// suggestBatch is the number of terms from the dictionaries checked
+// against the owner's bookmarks in one search, and suggestBatches the most
+// searches made for each kind of suggestion to find suggestCandidates.
+const (
+	suggestBatch   = 100
+	suggestBatches = 3
+)
+
+// Suggestion is a completion for a partly typed word. Field is "tag" for
+// tags, "title" for whole titles and "word" for words in the titles and
+// page text. Count is the number of the owner's bookmarks containing it.
+type Suggestion struct {
+	Term  string
+	Field string
+	Count int
+}
+
+// SuggestOptions are the partly typed text to complete. Word is completed
+// to tags and words, or only tags if TagsOnly is set, and Title to whole
+// titles.
+type SuggestOptions struct {
+	Owner    uint64
+	Word     string
+	Title    string
+	TagsOnly bool
+	Size     int
+}
+
+// Suggest returns completions from the owner's bookmarks, the most used
+// first.
+//
+// The field dictionaries cover every user's bookmarks, so the candidates
+// are counted in the owner's own a batch at a time, and any which are not
+// there are skipped until enough which are have been found.
+func (m *BookmarkManager) Suggest(opts SuggestOptions) ([]Suggestion, error) {
+	suggestions := []Suggestion{}
+
+	// tags are stored lower case, like the words of the other fields
+	type source struct {
+		kind   string
+		fields []string
+		term   string
+	}
+	sources := []source{}
+	if opts.Word != "" {
+		word := strings.ToLower(opts.Word)
+		sources = append(sources, source{"tag", []string{"Tags"}, word})
+		if !opts.TagsOnly {
+			// words appear in both titles and text
+			sources = append(sources, source{"word", wordFields, word})
+		}
+	}
+	if opts.Title != "" {
+		sources = append(sources, source{"title", []string{"Info.TitleSort"}, strings.ToLower(opts.Title)})
+	}
+
+	for _, f := range sources {
+		candidates, err := m.dictPrefix(f.term, f.fields...)
+		if err != nil {
+			return nil, err
+		}
+		owned := []Suggestion{}
+		for b := 0; b < suggestBatches && len(owned) < suggestCandidates && len(candidates) > 0; b++ {
+			batch := candidates[:min(suggestBatch, len(candidates))]
+			candidates = candidates[len(batch):]
+			counts, err := m.termCounts(opts.Owner, f.fields, batch)
+			if err != nil {
+				return nil, err
+			}
+			for _, term := range batch {
+				if counts[term] > 0 && len(owned) < suggestCandidates {
+					owned = append(owned, Suggestion{Term: term, Field: f.kind, Count: counts[term]})
+				}
+			}
+		}
+		if f.kind == "title" {
+			err = m.displayTitles(opts.Owner, owned)
+			if err != nil {
+				return nil, err
+			}
+		}
+		suggestions = append(suggestions, owned...)
+	}
+
+	sort.SliceStable(suggestions, func(i, j int) bool { return suggestions[i].Count > suggestions[j].Count })
+	if len(suggestions) > opts.Size {
+		suggestions = suggestions[:opts.Size]
+	}
+	return suggestions, nil
+}
+
+// dictPrefix returns the terms in the fields starting with prefix, other
+// than prefix itself, the most common first.
+func (m *BookmarkManager) dictPrefix(prefix string, fields ...string) ([]string, error) {
+	counts := map[string]uint64{}
+	for _, field := range fields {
+		err := func() error {
+			dict, err := m.db.bleve.FieldDictPrefix(field, []byte(prefix))
+			if err != nil {
+				return fmt.Errorf("could not read %s terms: %w", field, err)
+			}
+			defer dict.Close()
+			for {
+				de, err := dict.Next()
+				if err != nil {
+					return fmt.Errorf("could not read %s terms: %w", field, err)
+				}
+				if de == nil {
+					return nil
+				}
+				if de.Term != prefix {
+					counts[de.Term] += de.Count
+				}
+			}
+		}()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	terms := make([]string, 0, len(counts))
+	for term := range counts {
+		terms = append(terms, term)
+	}
+	sort.Slice(terms, func(i, j int) bool {
+		if counts[terms[i]] != counts[terms[j]] {
+			return counts[terms[i]] > counts[terms[j]]
+		}
+		return terms[i] < terms[j]
+	})
+	return terms, nil
+}
+
+// termCounts returns the number of the owner's bookmarks with each of the
+// terms in the fields, counted in one search by faceting on them. A term
+// in more than one field, such as a word in both titles and page text, is
+// given the larger of its counts.
+func (m *BookmarkManager) termCounts(owner uint64, fields []string, terms []string) (map[string]int, error) {
+	q := bleve.NewDisjunctionQuery()
+	for _, f := range fields {
+		for _, term := range terms {
+			tq := bleve.NewTermQuery(term)
+			tq.SetField(f)
+			q.AddQuery(tq)
+		}
+	}
+	req := bleve.NewSearchRequestOptions(bleve.NewConjunctionQuery(q, ownerQuery(owner)), 0, 0, false)
+	for _, f := range fields {
+		// the bookmarks found have other terms too, which must not push
+		// the candidates out of the facet
+		req.AddFacet(f, bleve.NewFacetRequest(f, math.MaxInt32))
+	}
+	sr, err := m.db.bleve.Search(req)
+	if err != nil {
+		return nil, fmt.Errorf("could not count terms: %w", err)
+	}
+
+	wanted := make(map[string]bool, len(terms))
+	for _, term := range terms {
+		wanted[term] = true
+	}
+	counts := map[string]int{}
+	for _, f := range fields {
+		facet := sr.Facets[f]
+		if facet == nil || facet.Terms == nil {
+			continue
+		}
+		for _, tf := range facet.Terms.Terms() {
+			if wanted[tf.Term] && tf.Count > counts[tf.Term] {
+				counts[tf.Term] = tf.Count
+			}
+		}
+	}
+	return counts, nil
+}
+
+// termCount returns the number of the owner's bookmarks with the term in
+// the field. Words are looked for in both titles and page text.
+func (m *BookmarkManager) termCount(owner uint64, field string, kind string, term string) (int, error) {
+	q := bleve.NewDisjunctionQuery()
+	fields := []string{field}
+	if kind == "word" {
+		fields = wordFields
+	}
+	for _, f := range fields {
+		tq := bleve.NewTermQuery(term)
+		tq.SetField(f)
+		q.AddQuery(tq)
+	}
+	req := bleve.NewSearchRequestOptions(bleve.NewConjunctionQuery(q, ownerQuery(owner)), 0, 0, false)
+	sr, err := m.db.bleve.Search(req)
+	if err != nil {
+		return 0, fmt.Errorf("could not count %s: %w", term, err)
+	}
+	return int(sr.Total), nil
+}
+
+// displayTitles replaces the lower case titles of suggestions, as they
+// are in Info.TitleSort, with the titles of the owner's bookmarks as they
+// are shown.
+func (m *BookmarkManager) displayTitles(owner uint64, suggestions []Suggestion) error {
+	if len(suggestions) == 0 {
+		return nil
+	}
+	q := bleve.NewDisjunctionQuery()
+	for _, s := range suggestions {
+		tq := bleve.NewTermQuery(s.Term)
+		tq.SetField("Info.TitleSort")
+		q.AddQuery(tq)
+	}
+	req := bleve.NewSearchRequestOptions(bleve.NewConjunctionQuery(q, ownerQuery(owner)), suggestBatch, 0, false)
+	req.Fields = []string{"Info.Title"}
+	sr, err := m.db.bleve.Search(req)
+	if err != nil {
+		return fmt.Errorf("could not load titles: %w", err)
+	}
+	titles := map[string]string{}
+	for _, dm := range sr.Hits {
+		if title, ok := dm.Fields["Info.Title"].(string); ok {
+			if _, seen := titles[strings.ToLower(title)]; !seen {
+				titles[strings.ToLower(title)] = title
+			}
+		}
+	}
+	for i := range suggestions {
+		if title, ok := titles[suggestions[i].Term]; ok {
+			suggestions[i].Term = title
+		}
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package db
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/tardisx/linkwallet/entity"
+)
+
+func TestSuggest(t *testing.T) {
+	db := newTestDB(t)
+	bmm := NewBookmarkManager(db)
+
+	for _, bm := range []entity.Bookmark{
+		{URL: "https://example.com/1", Owner: 1, Tags: []string{"kubernetes"}, Info: entity.PageInfo{Title: "Writing a Kubernetes operator", RawText: "operators manage kubelets"}},
+		{URL: "https://example.com/2", Owner: 1, Tags: []string{"kubernetes", "kubectl"}, Info: entity.PageInfo{Title: "Kubernetes networking"}},
+		{URL: "https://example.com/4", Owner: 1, Info: entity.PageInfo{Title: "kubernetes NETWORKING"}},
+		{URL: "https://example.com/3", Owner: 2, Tags: []string{"kubeflow"}, Info: entity.PageInfo{Title: "Kubeflow pipelines", RawText: "kubeflow secrets"}},
+	} {
+		err := bmm.AddBookmark(&bm)
+		if err != nil {
+			t.Fatal(err)
+		}
+		bmm.UpdateIndexForBookmark(&bm)
+	}
+	// another user's more common tags, more of them than are looked at in
+	// any one search
+	crowd := []string{}
+	for i := range suggestBatch + 5 {
+		crowd = append(crowd, fmt.Sprintf("kubecrowd%d", i))
+	}
+	for i := range 3 {
+		bm := entity.Bookmark{URL: fmt.Sprintf("https://example.com/crowd/%d", i), Owner: 2, Tags: crowd}
+		err := bmm.AddBookmark(&bm)
+		if err != nil {
+			t.Fatal(err)
+		}
+		bmm.UpdateIndexForBookmark(&bm)
+	}
+
+	suggest := func(opts SuggestOptions) map[string]Suggestion {
+		opts.Owner = 1
+		opts.Size = 10
+		suggestions, err := bmm.Suggest(opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		found := map[string]Suggestion{}
+		for _, s := range suggestions {
+			found[s.Field+":"+s.Term] = s
+		}
+		return found
+	}
+
+	got := suggest(SuggestOptions{Word: "Kube"})
+	for _, want := range []Suggestion{
+		{Term: "kubernetes", Field: "word", Count: 3},
+		{Term: "kubelets", Field: "word", Count: 1},
+		{Term: "kubernetes", Field: "tag", Count: 2},
+	} {
+		if got[want.Field+":"+want.Term] != want {
+			t.Errorf("missing %+v in %v", want, got)
+		}
+	}
+	// other users' words are never suggested
+	for key := range got {
+		if key == "word:kubeflow" || key == "tag:kubeflow" || strings.HasPrefix(key, "tag:kubecrowd") {
+			t.Errorf("suggested %s from another user's bookmarks", key)
+		}
+	}
+
+	got = suggest(SuggestOptions{Word: "kube", TagsOnly: true})
+	if len(got) != 2 || got["tag:kubernetes"].Count != 2 || got["tag:kubectl"].Count != 1 {
+		t.Errorf("expected only the two tags, got %v", got)
+	}
+
+	// titles are suggested as one of the bookmarks has them, not lower case
+	got = suggest(SuggestOptions{Title: "Kubernetes n"})
+	if len(got) != 1 || (got["title:Kubernetes networking"].Count != 2 && got["title:kubernetes NETWORKING"].Count != 2) {
+		t.Errorf("expected the title, got %v", got)
+	}
+
+	if got := suggest(SuggestOptions{}); len(got) != 0 {
+		t.Errorf("expected nothing to complete nothing, got %v", got)
+	}
+}
@@ -0,0 +1,105 @@
+package db
+
+import (
+	"time"
+
+	"github.com/blevesearch/bleve/v2"
+	"github.com/blevesearch/bleve/v2/search"
+	"github.com/blevesearch/bleve/v2/search/query"
+)
+
+// timelineYears is how many years back the timeline of search results
+// goes. Years before the first bookmark are left out.
+const timelineYears = 30
+
+// PeriodCount is the number of matching bookmarks created in a period,
+// a year like 2024 or a month like 2024-03.
+type PeriodCount struct {
+	Period string
+	Start  time.Time
+	Count  int
+}
+
+// period is a year or month in the timeline.
+type period struct {
+	name       string
+	start, end time.Time
+}
+
+// periodRange parses a period in the format used by after: and before:,
+// returning the start of it and the start of the next one.
+func periodRange(s string) (time.Time, time.Time, error) {
+	start, err := parsePeriod(s)
+	if err != nil {
+		return start, start, err
+	}
+	switch len(s) {
+	case len("2006"):
+		return start, start.AddDate(1, 0, 0), nil
+	case len("2006-01"):
+		return start, start.AddDate(0, 1, 0), nil
+	}
+	return start, start.AddDate(0, 0, 1), nil
+}
+
+// periodQuery returns a query matching bookmarks created from start until
+// end.
+func periodQuery(start, end time.Time) query.Query {
+	inclusive, exclusive := true, false
+	q := bleve.NewDateRangeInclusiveQuery(start, end, &inclusive, &exclusive)
+	q.SetField("TimestampCreated")
+	return q
+}
+
+// timelinePeriods returns the periods of the timeline for a search. With
+// no period selected, it is the years up to now. Within a selected period
+// it is the months of its year.
+func timelinePeriods(selected string, now time.Time) []period {
+	periods := []period{}
+	if selected != "" {
+		start, _, err := periodRange(selected)
+		if err == nil {
+			year := time.Date(start.Year(), time.January, 1, 0, 0, 0, 0, time.Local)
+			for m := 0; m < 12; m++ {
+				from := year.AddDate(0, m, 0)
+				periods = append(periods, period{name: from.Format("2006-01"), start: from, end: from.AddDate(0, 1, 0)})
+			}
+			return periods
+		}
+	}
+	for y := now.Year() - timelineYears + 1; y <= now.Year(); y++ {
+		from := time.Date(y, time.January, 1, 0, 0, 0, 0, time.Local)
+		periods = append(periods, period{name: from.Format("2006"), start: from, end: from.AddDate(1, 0, 0)})
+	}
+	return periods
+}
+
+// timelineFacet returns the facet request counting bookmarks in each of
+// the periods.
+func timelineFacet(periods []period) *bleve.FacetRequest {
+	fr := bleve.NewFacetRequest("TimestampCreated", len(periods))
+	for _, p := range periods {
+		fr.AddDateTimeRange(p.name, p.start, p.end)
+	}
+	return fr
+}
+
+// timelineCounts converts the facet result into counts for all the periods
+// in order, including empty ones, but leaving out any years before the
+// first bookmark.
+func timelineCounts(periods []period, f *search.FacetResult) []PeriodCount {
+	counts := map[string]int{}
+	if f != nil {
+		for _, dr := range f.DateRanges {
+			counts[dr.Name] = dr.Count
+		}
+	}
+	timeline := []PeriodCount{}
+	for _, p := range periods {
+		if len(timeline) == 0 && counts[p.name] == 0 && len(p.name) == len("2006") {
+			continue
+		}
+		timeline = append(timeline, PeriodCount{Period: p.name, Start: p.start, Count: counts[p.name]})
+	}
+	return timeline
+}
@@ -0,0 +1,77 @@
+package db
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/tardisx/linkwallet/entity"
+)
+
+func TestTimeline(t *testing.T) {
+	db := newTestDB(t)
+	bmm := NewBookmarkManager(db)
+
+	now := time.Now()
+	thisYear := now.Year()
+	created := []time.Time{
+		time.Date(thisYear-2, time.March, 3, 12, 0, 0, 0, time.Local),
+		time.Date(thisYear-2, time.March, 20, 12, 0, 0, 0, time.Local),
+		time.Date(thisYear-2, time.November, 1, 12, 0, 0, 0, time.Local),
+		time.Date(thisYear, time.January, 1, 12, 0, 0, 0, time.Local),
+	}
+	for i, ts := range created {
+		bm := entity.Bookmark{URL: fmt.Sprintf("https://example.com/%d", i), Owner: 1}
+		err := bmm.AddBookmark(&bm)
+		if err != nil {
+			t.Fatal(err)
+		}
+		bm.TimestampCreated = ts
+		bmm.SaveBookmark(&bm)
+		bmm.UpdateIndexForBookmark(&bm)
+	}
+
+	res, err := bmm.Search(SearchOptions{Owner: 1, All: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// years before the first bookmark are left out, empty ones after kept
+	want := []PeriodCount{
+		{Period: fmt.Sprint(thisYear - 2), Count: 3},
+		{Period: fmt.Sprint(thisYear - 1), Count: 0},
+		{Period: fmt.Sprint(thisYear), Count: 1},
+	}
+	if len(res.Timeline) != len(want) {
+		t.Fatalf("got timeline %v, want %v", res.Timeline, want)
+	}
+	for i := range want {
+		if res.Timeline[i].Period != want[i].Period || res.Timeline[i].Count != want[i].Count {
+			t.Errorf("got timeline %v, want %v", res.Timeline, want)
+		}
+	}
+
+	year := fmt.Sprint(thisYear - 2)
+	res, err = bmm.Search(SearchOptions{Owner: 1, All: true, Period: year})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Total != 3 {
+		t.Errorf("expected 3 bookmarks in %s, got %d", year, res.Total)
+	}
+	if len(res.Timeline) != 12 || res.Timeline[2].Count != 2 || res.Timeline[10].Count != 1 || res.Timeline[0].Count != 0 {
+		t.Errorf("wrong months %v", res.Timeline)
+	}
+
+	res, err = bmm.Search(SearchOptions{Owner: 1, All: true, Period: year + "-03"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Total != 2 || len(res.Timeline) != 12 {
+		t.Errorf("expected 2 bookmarks in March, and the months of the year, got %d %v", res.Total, res.Timeline)
+	}
+
+	_, err = bmm.Search(SearchOptions{Owner: 1, All: true, Period: "last week"})
+	if _, ok := err.(QueryError); !ok {
+		t.Errorf("expected a QueryError for a bad period, got %v", err)
+	}
+}
@@ -0,0 +1,232 @@
+package db
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/hotp"
+	"github.com/pquerna/otp/totp"
+	"github.com/tardisx/linkwallet/entity"
+	bolthold "github.com/timshannon/bolthold"
+	bolt "go.etcd.io/bbolt"
+)
+
+const totpIssuer = "linkwallet"
+const totpPeriod = 30
+
+// recoveryCodeCount is the number of recovery codes generated when two
+// factor authentication is enabled.
+const recoveryCodeCount = 10
+
+// secondFactorAttempts is the number of wrong second factors a user can
+// enter in a row, across any number of logins, before it is locked for
+// secondFactorLockout.
+const secondFactorAttempts = 10
+const secondFactorLockout = time.Minute * 15
+
+// ErrSecondFactorLocked is returned when there have been too many wrong
+// second factors for the user, and they must wait before trying again.
+var ErrSecondFactorLocked = errors.New("too many incorrect codes, try again later")
+
+// TOTPKey returns the key for the user's TOTP secret, suitable for
+// rendering as a QR code.
+func TOTPKey(u entity.User) (*otp.Key, error) {
+	if u.TOTPSecret == "" {
+		return nil, errors.New("no TOTP secret")
+	}
+	v := url.Values{}
+	v.Set("secret", u.TOTPSecret)
+	v.Set("issuer", totpIssuer)
+	v.Set("period", fmt.Sprint(totpPeriod))
+	return otp.NewKeyFromURL("otpauth://totp/" + url.PathEscape(totpIssuer+":"+u.Username) + "?" + v.Encode())
+}
+
+// BeginTOTPEnrollment generates a new TOTP secret for the user. It is not
+// required at login until confirmed with ConfirmTOTPEnrollment.
+func (um *UserManager) BeginTOTPEnrollment(id uint64) (entity.User, error) {
+	u, err := um.LoadUserByID(id)
+	if err != nil {
+		return u, err
+	}
+	if u.TOTPEnabled {
+		return u, errors.New("two factor authentication is already enabled")
+	}
+	key, err := totp.Generate(totp.GenerateOpts{Issuer: totpIssuer, AccountName: u.Username, Period: totpPeriod})
+	if err != nil {
+		return u, fmt.Errorf("could not generate TOTP secret: %w", err)
+	}
+	u.TOTPSecret = key.Secret()
+	return u, um.SaveUser(&u)
+}
+
+// ConfirmTOTPEnrollment enables two factor authentication, if code is
+// valid for the pending secret. It returns the recovery codes, which are
+// only stored hashed, so this is the only chance to show them.
+func (um *UserManager) ConfirmTOTPEnrollment(id uint64, code string) ([]string, error) {
+	u, err := um.LoadUserByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if u.TOTPEnabled {
+		return nil, errors.New("two factor authentication is already enabled")
+	}
+	if u.TOTPSecret == "" {
+		return nil, errors.New("two factor authentication enrollment has not been started")
+	}
+	if !checkTOTP(&u, code, time.Now()) {
+		return nil, errors.New("incorrect code")
+	}
+
+	codes := make([]string, recoveryCodeCount)
+	u.RecoveryCodes = make([][]byte, recoveryCodeCount)
+	for i := range codes {
+		codes[i], err = newRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		u.RecoveryCodes[i] = hashRecoveryCode(codes[i])
+	}
+	u.TOTPEnabled = true
+	err = um.SaveUser(&u)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("two factor authentication enabled for %s", u.Username)
+	return codes, nil
+}
+
+// ResetTOTP disables two factor authentication for the user, removing the
+// secret and any recovery codes.
+func (um *UserManager) ResetTOTP(id uint64) error {
+	u, err := um.LoadUserByID(id)
+	if err != nil {
+		return err
+	}
+	u.TOTPSecret = ""
+	u.TOTPEnabled = false
+	u.TOTPLastCounter = 0
+	u.TOTPFailures = 0
+	u.TOTPLockedUntil = time.Time{}
+	u.RecoveryCodes = nil
+	err = um.SaveUser(&u)
+	if err != nil {
+		return err
+	}
+	log.Printf("two factor authentication reset for %s", u.Username)
+	return nil
+}
+
+// VerifySecondFactor checks a TOTP code or a recovery code for the user.
+// A TOTP code can only be used once, and so can each recovery code. After
+// secondFactorAttempts wrong ones it returns ErrSecondFactorLocked, until
+// secondFactorLockout has passed.
+func (um *UserManager) VerifySecondFactor(id uint64, code string) (bool, error) {
+	code = strings.TrimSpace(code)
+	ok := false
+	// the code is checked and marked used in one transaction, so it
+	// cannot be used twice by racing requests
+	err := um.db.store.Bolt().Update(func(tx *bolt.Tx) error {
+		u := entity.User{}
+		err := um.db.store.TxGet(tx, id, &u)
+		if err == bolthold.ErrNotFound {
+			return ErrUserNotFound
+		} else if err != nil {
+			return fmt.Errorf("could not load user: %w", err)
+		}
+		if !u.TOTPEnabled {
+			return errors.New("two factor authentication is not enabled")
+		}
+		now := time.Now()
+		if now.Before(u.TOTPLockedUntil) {
+			return ErrSecondFactorLocked
+		}
+
+		ok = checkTOTP(&u, code, now)
+		if !ok {
+			ok = useRecoveryCode(&u, code)
+			if ok {
+				log.Printf("recovery code used by %s, %d remaining", u.Username, len(u.RecoveryCodes))
+			}
+		}
+		if ok {
+			u.TOTPFailures = 0
+		} else {
+			u.TOTPFailures++
+			if u.TOTPFailures%secondFactorAttempts == 0 {
+				u.TOTPLockedUntil = now.Add(secondFactorLockout)
+				log.Printf("second factor locked for %s after %d incorrect codes", u.Username, u.TOTPFailures)
+			}
+		}
+		err = um.db.store.TxUpdate(tx, id, &u)
+		if err != nil {
+			return fmt.Errorf("could not save user: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+	return ok, nil
+}
+
+// checkTOTP checks code against the user's secret, allowing for one
+// period of clock skew either way. Codes at or before the last one used
+// are rejected, so a code cannot be replayed. On success the user's
+// TOTPLastCounter is updated, but not saved.
+func checkTOTP(u *entity.User, code string, t time.Time) bool {
+	if len(code) != 6 {
+		return false
+	}
+	counter := uint64(t.Unix()) / totpPeriod
+	for _, c := range []uint64{counter - 1, counter, counter + 1} {
+		if c <= u.TOTPLastCounter {
+			continue
+		}
+		ok, err := hotp.ValidateCustom(code, c, u.TOTPSecret, hotp.ValidateOpts{Digits: otp.DigitsSix, Algorithm: otp.AlgorithmSHA1})
+		if err == nil && ok {
+			u.TOTPLastCounter = c
+			return true
+		}
+	}
+	return false
+}
+
+func newRecoveryCode() (string, error) {
+	b := make([]byte, 10)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", fmt.Errorf("could not generate recovery code: %w", err)
+	}
+	code := strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(b))
+	return code[:8] + "-" + code[8:], nil
+}
+
+// hashRecoveryCode hashes a recovery code for storage. The codes are long
+// and random, so a plain hash is sufficient.
+func hashRecoveryCode(code string) []byte {
+	code = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+	sum := sha256.Sum256([]byte(code))
+	return sum[:]
+}
+
+// useRecoveryCode removes the matching recovery code from the user,
+// returning true if there was one.
+func useRecoveryCode(u *entity.User, code string) bool {
+	hash := hashRecoveryCode(code)
+	for i := range u.RecoveryCodes {
+		if subtle.ConstantTimeCompare(u.RecoveryCodes[i], hash) == 1 {
+			u.RecoveryCodes = append(u.RecoveryCodes[:i], u.RecoveryCodes[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,158 @@
+package db
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pquerna/otp/totp"
+	"github.com/tardisx/linkwallet/entity"
+)
+
+func TestTOTPEnrollment(t *testing.T) {
+	db := newTestDB(t)
+	um := NewUserManager(db)
+
+	alice := entity.User{Username: "alice"}
+	err := um.AddUser(&alice, "correct horse battery")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	alice, err = um.BeginTOTPEnrollment(alice.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if alice.TOTPSecret == "" {
+		t.Fatal("no secret generated")
+	}
+	key, err := TOTPKey(alice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key.AccountName() != "alice" || key.Issuer() != "linkwallet" {
+		t.Errorf("unexpected key %s", key)
+	}
+
+	_, err = um.ConfirmTOTPEnrollment(alice.ID, "000000")
+	if err == nil {
+		t.Error("wrong code should not confirm enrollment")
+	}
+
+	code, _ := totp.GenerateCode(alice.TOTPSecret, time.Now())
+	recovery, err := um.ConfirmTOTPEnrollment(alice.ID, code)
+	if err != nil {
+		t.Fatalf("could not confirm enrollment: %s", err)
+	}
+	if len(recovery) != recoveryCodeCount {
+		t.Errorf("expected %d recovery codes, got %d", recoveryCodeCount, len(recovery))
+	}
+
+	// the code used to confirm cannot be used again
+	ok, err := um.VerifySecondFactor(alice.ID, code)
+	if err != nil || ok {
+		t.Errorf("replayed code accepted (%v)", err)
+	}
+
+	// a code from the next period is fine
+	next, _ := totp.GenerateCode(alice.TOTPSecret, time.Now().Add(time.Second*totpPeriod))
+	ok, err = um.VerifySecondFactor(alice.ID, next)
+	if err != nil || !ok {
+		t.Errorf("valid code rejected (%v)", err)
+	}
+
+	// recovery codes work once each
+	ok, err = um.VerifySecondFactor(alice.ID, recovery[3])
+	if err != nil || !ok {
+		t.Errorf("recovery code rejected (%v)", err)
+	}
+	ok, _ = um.VerifySecondFactor(alice.ID, recovery[3])
+	if ok {
+		t.Error("recovery code accepted twice")
+	}
+
+	alice, _ = um.LoadUserByID(alice.ID)
+	for _, hash := range alice.RecoveryCodes {
+		for _, code := range recovery {
+			if string(hash) == code {
+				t.Error("recovery code stored in plain text")
+			}
+		}
+	}
+
+	err = um.ResetTOTP(alice.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	alice, _ = um.LoadUserByID(alice.ID)
+	if alice.TOTPEnabled || alice.TOTPSecret != "" || len(alice.RecoveryCodes) != 0 {
+		t.Error("two factor authentication was not reset")
+	}
+}
+
+func TestSecondFactorLockout(t *testing.T) {
+	db := newTestDB(t)
+	um := NewUserManager(db)
+
+	alice := entity.User{Username: "alice"}
+	err := um.AddUser(&alice, "correct horse battery")
+	if err != nil {
+		t.Fatal(err)
+	}
+	alice, _ = um.BeginTOTPEnrollment(alice.ID)
+	code, _ := totp.GenerateCode(alice.TOTPSecret, time.Now())
+	_, err = um.ConfirmTOTPEnrollment(alice.ID, code)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the same code is only accepted once, however the requests race
+	next, _ := totp.GenerateCode(alice.TOTPSecret, time.Now().Add(time.Second*totpPeriod))
+	accepted := make(chan bool, 10)
+	wg := sync.WaitGroup{}
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ok, _ := um.VerifySecondFactor(alice.ID, next)
+			accepted <- ok
+		}()
+	}
+	wg.Wait()
+	close(accepted)
+	count := 0
+	for ok := range accepted {
+		if ok {
+			count++
+		}
+	}
+	if count != 1 {
+		t.Errorf("code accepted %d times", count)
+	}
+
+	// the replays count as wrong codes too
+	alice, _ = um.LoadUserByID(alice.ID)
+	if alice.TOTPFailures != 9 {
+		t.Errorf("expected 9 failures, got %d", alice.TOTPFailures)
+	}
+	for i := alice.TOTPFailures; i < secondFactorAttempts; i++ {
+		ok, err := um.VerifySecondFactor(alice.ID, "000000")
+		if ok || err != nil {
+			t.Fatalf("attempt %d: got %v, %v", i, ok, err)
+		}
+	}
+	later, _ := totp.GenerateCode(alice.TOTPSecret, time.Now().Add(time.Second*totpPeriod*2))
+	_, err = um.VerifySecondFactor(alice.ID, later)
+	if err != ErrSecondFactorLocked {
+		t.Errorf("expected second factor to be locked, got %v", err)
+	}
+
+	err = um.ResetTOTP(alice.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	alice, _ = um.LoadUserByID(alice.ID)
+	if alice.TOTPFailures != 0 || !alice.TOTPLockedUntil.IsZero() {
+		t.Error("lockout was not reset")
+	}
+}
@@ -0,0 +1,431 @@
+package db
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tardisx/linkwallet/entity"
+	bolthold "github.com/timshannon/bolthold"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// MinPasswordLength is the shortest password we will accept.
+const MinPasswordLength = 8
+
+var ErrUserNotFound = errors.New("user does not exist")
+
+// ErrUserExists is returned when a new user would take the name of an
+// existing one.
+var ErrUserExists = errors.New("user already exists")
+
+type UserManager struct {
+	db *DB
+}
+
+func NewUserManager(db *DB) *UserManager {
+	return &UserManager{db: db}
+}
+
+func hashPassword(password string) ([]byte, error) {
+	if len(password) < MinPasswordLength {
+		return nil, fmt.Errorf("password must be at least %d characters", MinPasswordLength)
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, fmt.Errorf("could not hash password: %w", err)
+	}
+	return hash, nil
+}
+
+// HasUsers returns true if at least one user account exists.
+func (um *UserManager) HasUsers() (bool, error) {
+	count, err := um.db.store.Count(&entity.User{}, &bolthold.Query{})
+	if err != nil {
+		return false, fmt.Errorf("could not count users: %w", err)
+	}
+	return count > 0, nil
+}
+
+// AddUser adds a new user with the given password. The entity.User ID
+// field will be updated. The very first user is always an admin, and
+// takes ownership of any bookmarks created before user accounts existed.
+func (um *UserManager) AddUser(u *entity.User, password string) error {
+	u.Username = strings.TrimSpace(u.Username)
+	if u.Username == "" {
+		return errors.New("username must not be empty")
+	}
+	_, err := um.LoadUserByUsername(u.Username)
+	if err == nil {
+		return fmt.Errorf("user %s already exists", u.Username)
+	} else if err != ErrUserNotFound {
+		return err
+	}
+
+	hash, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+	u.PasswordHash = hash
+
+	return um.insertUser(u)
+}
+
+// ProvisionUser adds a new user without a password, for users who are
+// authenticated by some other means.
+func (um *UserManager) ProvisionUser(username string) (entity.User, error) {
+	u := entity.User{Username: strings.TrimSpace(username)}
+	if u.Username == "" {
+		return u, errors.New("username must not be empty")
+	}
+	err := um.insertUser(&u)
+	if err != nil {
+		return u, err
+	}
+	log.Printf("provisioned user %s", u.Username)
+	return u, nil
+}
+
+func (um *UserManager) insertUser(u *entity.User) error {
+	hasUsers, err := um.HasUsers()
+	if err != nil {
+		return err
+	}
+	first := !hasUsers
+	if first {
+		u.Admin = true
+	}
+	u.Created = time.Now()
+	err = um.db.store.Insert(bolthold.NextSequence(), u)
+	if err != nil {
+		return fmt.Errorf("could not add user: %w", err)
+	}
+	if first {
+		return um.db.adoptUnowned(u.ID)
+	}
+	return nil
+}
+
+func (um *UserManager) LoadUserByID(id uint64) (entity.User, error) {
+	u := entity.User{}
+	err := um.db.store.Get(id, &u)
+	if err == bolthold.ErrNotFound {
+		return u, ErrUserNotFound
+	} else if err != nil {
+		return u, fmt.Errorf("could not load user: %w", err)
+	}
+	return u, nil
+}
+
+func (um *UserManager) LoadUserByUsername(username string) (entity.User, error) {
+	u := entity.User{}
+	err := um.db.store.FindOne(&u, bolthold.Where("Username").Eq(username))
+	if err == bolthold.ErrNotFound {
+		return u, ErrUserNotFound
+	} else if err != nil {
+		return u, fmt.Errorf("could not load user: %w", err)
+	}
+	return u, nil
+}
+
+// LoadUserByOIDC returns the user with the identity at an OpenID Connect
+// provider.
+func (um *UserManager) LoadUserByOIDC(issuer, subject string) (entity.User, error) {
+	u := entity.User{}
+	if issuer == "" || subject == "" {
+		return u, ErrUserNotFound
+	}
+	err := um.db.store.FindOne(&u, bolthold.Where("OIDCIssuer").Eq(issuer).And("OIDCSubject").Eq(subject))
+	if err == bolthold.ErrNotFound {
+		return u, ErrUserNotFound
+	} else if err != nil {
+		return u, fmt.Errorf("could not load user: %w", err)
+	}
+	return u, nil
+}
+
+// ProvisionOIDCUser adds a new user without a password, who logs in with
+// the identity at an OpenID Connect provider. It fails with ErrUserExists
+// rather than hand over an existing account with the same name.
+func (um *UserManager) ProvisionOIDCUser(username, issuer, subject string) (entity.User, error) {
+	u := entity.User{Username: strings.TrimSpace(username), OIDCIssuer: issuer, OIDCSubject: subject}
+	if u.Username == "" {
+		return u, errors.New("username must not be empty")
+	}
+	if issuer == "" || subject == "" {
+		return u, errors.New("OIDC issuer and subject must not be empty")
+	}
+	_, err := um.LoadUserByUsername(u.Username)
+	if err == nil {
+		return u, fmt.Errorf("%w: %s", ErrUserExists, u.Username)
+	} else if err != ErrUserNotFound {
+		return u, err
+	}
+	err = um.insertUser(&u)
+	if err != nil {
+		return u, err
+	}
+	log.Printf("provisioned user %s for %s at %s", u.Username, subject, issuer)
+	return u, nil
+}
+
+// LinkOIDC lets an existing user log in with the identity at an OpenID
+// Connect provider, in place of any they could before. An empty subject
+// unlinks them.
+func (um *UserManager) LinkOIDC(id uint64, issuer, subject string) error {
+	u, err := um.LoadUserByID(id)
+	if err != nil {
+		return err
+	}
+	if subject != "" {
+		other, err := um.LoadUserByOIDC(issuer, subject)
+		if err == nil && other.ID != u.ID {
+			return fmt.Errorf("%s at %s is already linked to %s", subject, issuer, other.Username)
+		} else if err != nil && err != ErrUserNotFound {
+			return err
+		}
+	} else {
+		issuer = ""
+	}
+	u.OIDCIssuer = issuer
+	u.OIDCSubject = subject
+	return um.SaveUser(&u)
+}
+
+// AllUsers returns all users, ordered by username.
+func (um *UserManager) AllUsers() ([]entity.User, error) {
+	users := []entity.User{}
+	err := um.db.store.Find(&users, (&bolthold.Query{}).SortBy("Username"))
+	if err != nil {
+		return nil, fmt.Errorf("could not load users: %w", err)
+	}
+	return users, nil
+}
+
+// SaveUser saves changes to an existing user.
+func (um *UserManager) SaveUser(u *entity.User) error {
+	err := um.db.store.Update(u.ID, u)
+	if err != nil {
+		return fmt.Errorf("could not save user: %w", err)
+	}
+	return nil
+}
+
+// SetPassword sets (or replaces) the password for a user. Only the
+// bcrypt hash is stored.
+func (um *UserManager) SetPassword(id uint64, password string) error {
+	u, err := um.LoadUserByID(id)
+	if err != nil {
+		return err
+	}
+	hash, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+	u.PasswordHash = hash
+	return um.SaveUser(&u)
+}
+
+// CheckPassword returns the user if the username and password match. If
+// they do not, the returned bool is false, with no error.
+func (um *UserManager) CheckPassword(username, password string) (entity.User, bool, error) {
+	u, err := um.LoadUserByUsername(username)
+	if err == ErrUserNotFound {
+		// compare anyway, so the response time does not reveal if the
+		// user exists
+		bcrypt.CompareHashAndPassword(dummyHash(), []byte(password))
+		return entity.User{}, false, nil
+	} else if err != nil {
+		return entity.User{}, false, err
+	}
+	if !u.HasPassword() {
+		return entity.User{}, false, nil
+	}
+	err = bcrypt.CompareHashAndPassword(u.PasswordHash, []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return entity.User{}, false, nil
+	} else if err != nil {
+		return entity.User{}, false, fmt.Errorf("could not check password: %w", err)
+	}
+	return u, true, nil
+}
+
+var dummyHash = sync.OnceValue(func() []byte {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("not a real password"), bcrypt.DefaultCost)
+	return hash
+})
+
+// DeleteUser deletes a user, along with all of their bookmarks, config,
+// stats, shares and saved searches.
+func (um *UserManager) DeleteUser(id uint64) error {
+	u, err := um.LoadUserByID(id)
+	if err != nil {
+		return err
+	}
+
+	bookmarks := []entity.Bookmark{}
+	err = um.db.store.Find(&bookmarks, bolthold.Where("Owner").Eq(u.ID))
+	if err != nil {
+		return fmt.Errorf("could not find bookmarks for user: %w", err)
+	}
+	for _, bm := range bookmarks {
+		err = um.db.unindexBookmark(bm.ID)
+		if err != nil {
+			return fmt.Errorf("could not remove bookmark %d from index: %w", bm.ID, err)
+		}
+	}
+	err = um.db.store.DeleteMatching(&entity.Bookmark{}, bolthold.Where("Owner").Eq(u.ID))
+	if err != nil {
+		return fmt.Errorf("could not delete bookmarks for user: %w", err)
+	}
+	err = um.db.store.Delete(u.ID, &entity.Config{})
+	if err != nil && err != bolthold.ErrNotFound {
+		return fmt.Errorf("could not delete config for user: %w", err)
+	}
+	err = um.db.store.Delete(u.ID, &entity.DBStats{})
+	if err != nil && err != bolthold.ErrNotFound {
+		return fmt.Errorf("could not delete stats for user: %w", err)
+	}
+	err = um.db.store.DeleteMatching(&entity.Share{}, bolthold.Where("Owner").Eq(u.ID))
+	if err != nil {
+		return fmt.Errorf("could not delete shares for user: %w", err)
+	}
+	err = um.db.store.DeleteMatching(&entity.SavedSearch{}, bolthold.Where("Owner").Eq(u.ID))
+	if err != nil {
+		return fmt.Errorf("could not delete saved searches for user: %w", err)
+	}
+	err = um.db.store.DeleteMatching(&entity.SearchRecord{}, bolthold.Where("Owner").Eq(u.ID))
+	if err != nil {
+		return fmt.Errorf("could not delete search history for user: %w", err)
+	}
+	err = um.db.store.Delete(u.ID, &entity.User{})
+	if err != nil {
+		return fmt.Errorf("could not delete user: %w", err)
+	}
+	log.Printf("deleted user %s and %d bookmarks", u.Username, len(bookmarks))
+	return nil
+}
+
+// SessionKey returns the 64 byte key used for session cookies. The first
+// 32 bytes are used for signing, the last 32 for encryption. The key is
+// generated and stored the first time it is needed.
+func (um *UserManager) SessionKey() ([]byte, error) {
+	creds, err := um.db.loadCredentials()
+	if err != nil {
+		return nil, err
+	}
+	if len(creds.SessionKey) == 64 {
+		return creds.SessionKey, nil
+	}
+
+	creds.SessionKey = make([]byte, 64)
+	_, err = rand.Read(creds.SessionKey)
+	if err != nil {
+		return nil, fmt.Errorf("could not generate session key: %w", err)
+	}
+	err = um.db.saveCredentials(&creds)
+	if err != nil {
+		return nil, err
+	}
+	return creds.SessionKey, nil
+}
+
+func (db *DB) loadCredentials() (entity.Credentials, error) {
+	creds := entity.Credentials{}
+	err := db.store.Get("credentials", &creds)
+	if err != nil && err != bolthold.ErrNotFound {
+		return creds, fmt.Errorf("could not load credentials: %w", err)
+	}
+	return creds, nil
+}
+
+func (db *DB) saveCredentials(creds *entity.Credentials) error {
+	err := db.store.Upsert("credentials", creds)
+	if err != nil {
+		return fmt.Errorf("could not save credentials: %w", err)
+	}
+	return nil
+}
+
+// migrateAdminPassword converts the single admin password used before
+// user accounts existed into an admin user called "admin".
+func (db *DB) migrateAdminPassword() error {
+	creds, err := db.loadCredentials()
+	if err != nil {
+		return err
+	}
+	if len(creds.PasswordHash) == 0 {
+		return nil
+	}
+
+	um := NewUserManager(db)
+	hasUsers, err := um.HasUsers()
+	if err != nil {
+		return err
+	}
+	if !hasUsers {
+		admin := entity.User{Username: "admin", PasswordHash: creds.PasswordHash}
+		err = um.insertUser(&admin)
+		if err != nil {
+			return err
+		}
+		log.Printf("migrated admin password to user 'admin'")
+	}
+	creds.PasswordHash = nil
+	return db.saveCredentials(&creds)
+}
+
+// adoptUnowned gives ownership of all bookmarks without an owner to the
+// given user, along with the config and stats from before user accounts
+// existed.
+func (db *DB) adoptUnowned(owner uint64) error {
+	bookmarks := []entity.Bookmark{}
+	err := db.store.Find(&bookmarks, bolthold.Where("Owner").Eq(uint64(0)))
+	if err != nil {
+		return fmt.Errorf("could not find unowned bookmarks: %w", err)
+	}
+	for _, bm := range bookmarks {
+		bm.Owner = owner
+		err = db.store.Update(bm.ID, &bm)
+		if err != nil {
+			return fmt.Errorf("could not update owner of bookmark %d: %w", bm.ID, err)
+		}
+		err = db.indexBookmark(bm)
+		if err != nil {
+			return err
+		}
+	}
+	if len(bookmarks) > 0 {
+		log.Printf("user %d adopted %d bookmarks", owner, len(bookmarks))
+	}
+
+	config := entity.Config{}
+	err = db.store.Get("config", &config)
+	if err == nil {
+		err = db.store.Upsert(owner, &config)
+		if err == nil {
+			err = db.store.Delete("config", &entity.Config{})
+		}
+	}
+	if err != nil && err != bolthold.ErrNotFound {
+		return fmt.Errorf("could not adopt config: %w", err)
+	}
+
+	stats := entity.DBStats{}
+	err = db.store.Get("stats", &stats)
+	if err == nil {
+		err = db.store.Upsert(owner, &stats)
+		if err == nil {
+			err = db.store.Delete("stats", &entity.DBStats{})
+		}
+	}
+	if err != nil && err != bolthold.ErrNotFound {
+		return fmt.Errorf("could not adopt stats: %w", err)
+	}
+
+	return nil
+}
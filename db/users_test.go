@@ -0,0 +1,217 @@
+package db
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/tardisx/linkwallet/entity"
+)
+
+func newTestDB(t *testing.T) *DB {
+	db := &DB{}
+	f, _ := os.CreateTemp("", "test_boltdb_*")
+	f.Close()
+	t.Cleanup(func() {
+		db.Close()
+		os.Remove(f.Name())
+		os.RemoveAll(f.Name() + ".bleve")
+	})
+	_, err := db.Open(f.Name())
+	if err != nil {
+		t.Fatalf("could not open db: %s", err)
+	}
+	return db
+}
+
+func TestUsers(t *testing.T) {
+	db := newTestDB(t)
+	um := NewUserManager(db)
+
+	has, err := um.HasUsers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if has {
+		t.Error("new db should not have users")
+	}
+
+	alice := entity.User{Username: "alice"}
+	err = um.AddUser(&alice, "short")
+	if err == nil {
+		t.Error("short password should be rejected")
+	}
+	err = um.AddUser(&alice, "correct horse battery")
+	if err != nil {
+		t.Fatalf("could not add user: %s", err)
+	}
+	if alice.ID == 0 {
+		t.Error("user did not get an id")
+	}
+	if !alice.Admin {
+		t.Error("first user should be an admin")
+	}
+
+	bob := entity.User{Username: "bob"}
+	err = um.AddUser(&bob, "another good password")
+	if err != nil {
+		t.Fatalf("could not add user: %s", err)
+	}
+	if bob.Admin {
+		t.Error("second user should not be an admin")
+	}
+
+	dupe := entity.User{Username: "bob"}
+	err = um.AddUser(&dupe, "another good password")
+	if err == nil {
+		t.Error("duplicate username should be rejected")
+	}
+
+	u, ok, err := um.CheckPassword("alice", "correct horse battery")
+	if err != nil || !ok || u.ID != alice.ID {
+		t.Errorf("correct password not accepted (%v)", err)
+	}
+	_, ok, err = um.CheckPassword("alice", "another good password")
+	if err != nil || ok {
+		t.Errorf("wrong password accepted (%v)", err)
+	}
+	_, ok, err = um.CheckPassword("carol", "correct horse battery")
+	if err != nil || ok {
+		t.Errorf("unknown user accepted (%v)", err)
+	}
+
+	err = um.DeleteUser(bob.ID)
+	if err != nil {
+		t.Fatalf("could not delete user: %s", err)
+	}
+	_, err = um.LoadUserByID(bob.ID)
+	if err != ErrUserNotFound {
+		t.Errorf("expected user to be gone, got %v", err)
+	}
+}
+
+func TestSessionKeyPersists(t *testing.T) {
+	db := newTestDB(t)
+	um := NewUserManager(db)
+
+	key1, err := um.SessionKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(key1) != 64 {
+		t.Errorf("expected 64 byte key, got %d", len(key1))
+	}
+
+	key2, _ := um.SessionKey()
+	if !bytes.Equal(key1, key2) {
+		t.Error("session key changed")
+	}
+}
+
+func TestOwnerScoping(t *testing.T) {
+	ts := newTestServer()
+	defer ts.Close()
+	serverResponse = "<p>the quick brown fox</p>"
+
+	db := newTestDB(t)
+	bmm := NewBookmarkManager(db)
+
+	alicesBM := entity.Bookmark{URL: ts.URL, Owner: 1}
+	err := bmm.AddBookmark(&alicesBM)
+	if err != nil {
+		t.Fatalf("error adding: %s", err)
+	}
+	bmm.ScrapeAndIndex(&alicesBM)
+
+	// the same URL can be bookmarked by someone else, but not twice by
+	// the same person
+	bobsBM := entity.Bookmark{URL: ts.URL, Owner: 2}
+	err = bmm.AddBookmark(&bobsBM)
+	if err != nil {
+		t.Fatalf("error adding same url for second user: %s", err)
+	}
+	again := entity.Bookmark{URL: ts.URL, Owner: 2}
+	err = bmm.AddBookmark(&again)
+	if err == nil {
+		t.Error("duplicate url for the same user should be rejected")
+	}
+
+	res, _ := bmm.Search(SearchOptions{Owner: 1, Query: "fox"})
+	if len(res.Hits) != 1 {
+		t.Errorf("expected 1 result for owner 1, got %d", len(res.Hits))
+	}
+	res, _ = bmm.Search(SearchOptions{Owner: 2, Query: "fox"})
+	if len(res.Hits) != 0 {
+		t.Errorf("expected 0 results for unscraped owner 2, got %d", len(res.Hits))
+	}
+	res, _ = bmm.Search(SearchOptions{Owner: 3, All: true})
+	if len(res.Hits) != 0 {
+		t.Errorf("expected no results for owner 3, got %d", len(res.Hits))
+	}
+
+	_, err = bmm.LoadBookmarkForOwner(2, alicesBM.ID)
+	if err == nil {
+		t.Error("should not be able to load another user's bookmark")
+	}
+
+	buf := bytes.Buffer{}
+	bmm.ExportBookmarks(&buf, 2)
+	if buf.String() != ts.URL+"\n" {
+		t.Errorf("unexpected export %q", buf.String())
+	}
+}
+
+func TestFirstUserAdoptsBookmarks(t *testing.T) {
+	db := newTestDB(t)
+
+	// a bookmark from before user accounts existed
+	legacy := entity.Bookmark{URL: "https://example.org"}
+	err := db.store.Insert(uint64(1), &legacy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	um := NewUserManager(db)
+	admin := entity.User{Username: "admin"}
+	err = um.AddUser(&admin, "correct horse battery")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bmm := NewBookmarkManager(db)
+	bm, err := bmm.LoadBookmarkForOwner(admin.ID, 1)
+	if err != nil {
+		t.Errorf("first user did not adopt bookmark: %s", err)
+	}
+	if bm.URL != legacy.URL {
+		t.Errorf("wrong bookmark adopted: %s", bm.URL)
+	}
+}
+
+func TestMigrateAdminPassword(t *testing.T) {
+	db := newTestDB(t)
+
+	// an admin password from before user accounts existed
+	hash, _ := hashPassword("correct horse battery")
+	err := db.saveCredentials(&entity.Credentials{PasswordHash: hash})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.migrateAdminPassword()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	um := NewUserManager(db)
+	u, ok, err := um.CheckPassword("admin", "correct horse battery")
+	if err != nil || !ok {
+		t.Fatalf("could not log in as migrated admin (%v)", err)
+	}
+	if !u.Admin {
+		t.Error("migrated user should be an admin")
+	}
+	creds, _ := db.loadCredentials()
+	if len(creds.PasswordHash) != 0 {
+		t.Error("old password hash was not removed")
+	}
+}
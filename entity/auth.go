@@ -0,0 +1,9 @@
+package entity
+
+// Credentials holds the keys used to sign and encrypt session cookies.
+type Credentials struct {
+	// PasswordHash is the admin password from before user accounts
+	// existed. It is migrated to an admin user when the database is opened.
+	PasswordHash []byte
+	SessionKey   []byte
+}
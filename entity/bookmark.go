@@ -1,17 +1,30 @@
 package entity
 
 import (
+	"html"
 	"html/template"
+	"net"
+	"net/url"
+	"slices"
 	"strings"
 	"time"
+
+	"golang.org/x/net/publicsuffix"
 )
 
 type Bookmark struct {
-	ID                   uint64 `boltholdKey:"ID"`
-	URL                  string
-	Info                 PageInfo
-	Tags                 []string
-	PreserveTitle        bool
+	ID    uint64 `boltholdKey:"ID"`
+	Owner uint64
+	URL   string
+	// Host is the lower case host name from the URL, and Domain the
+	// registrable domain it is part of, see SetHost.
+	Host          string
+	Domain        string
+	Info          PageInfo
+	Tags          []string
+	PreserveTitle bool
+	// Public bookmarks are visible via the owner's share links.
+	Public               bool
 	TimestampCreated     time.Time
 	TimestampLastScraped time.Time
 }
@@ -27,20 +40,103 @@ func (bm Bookmark) DisplayTitle() string {
 	return bm.Info.Title
 }
 
+// SetHost sets Host and Domain from the URL. The domain is the part of
+// the host a person could register, according to the public suffix list,
+// so www.example.co.uk and blog.example.co.uk are both on example.co.uk.
+// Hosts without one, like IP addresses and localhost, are their own domain.
+func (bm *Bookmark) SetHost() {
+	u, err := url.Parse(bm.URL)
+	if err != nil {
+		bm.Host = ""
+		bm.Domain = ""
+		return
+	}
+	bm.Host = strings.ToLower(u.Hostname())
+	if net.ParseIP(bm.Host) != nil {
+		bm.Domain = bm.Host
+		return
+	}
+	bm.Domain, err = publicsuffix.EffectiveTLDPlusOne(bm.Host)
+	if err != nil {
+		bm.Domain = bm.Host
+	}
+}
+
+// HasTag returns true if the bookmark has the tag.
+func (bm Bookmark) HasTag(tag string) bool {
+	return slices.Contains(bm.Tags, tag)
+}
+
+// IsPublic returns true if the bookmark is visible via share links, either
+// because it is marked public itself, or has one of the owner's public tags.
+func (bm Bookmark) IsPublic(publicTags []string) bool {
+	if bm.Public {
+		return true
+	}
+	for _, tag := range publicTags {
+		if bm.HasTag(tag) {
+			return true
+		}
+	}
+	return false
+}
+
 type PageInfo struct {
 	Fetched    time.Time
 	Title      string
 	Size       int
 	StatusCode int
 	RawText    string
+	// Language is the ISO 639-1 code of the language of the page, or ""
+	// if it could not be told.
+	Language string
 }
 
 func (pi PageInfo) Type() string {
 	return "info"
 }
 
+// BookmarkSearchResult is a bookmark found by a search. Highlight is the
+// page text matching it, and Fragments the matching parts of every field
+// which matched, by field name, with the matches marked.
 type BookmarkSearchResult struct {
 	Bookmark  Bookmark
 	Score     float64
 	Highlight template.HTML
+	Fragments map[string][]template.HTML
+}
+
+// HighlightedTitle returns the display title, with any matches in it
+// marked.
+func (r BookmarkSearchResult) HighlightedTitle() template.HTML {
+	fields := []string{"Info.Title", "Info.TitleWords"}
+	if strings.TrimSpace(r.Bookmark.Info.Title) == "" {
+		fields = []string{"URL"}
+	}
+	for _, field := range fields {
+		if len(r.Fragments[field]) > 0 {
+			return r.Fragments[field][0]
+		}
+	}
+	return template.HTML(html.EscapeString(r.Bookmark.DisplayTitle()))
+}
+
+// TagMatch is a tag of a search result, and whether the search matched it.
+type TagMatch struct {
+	Tag     string
+	Matched bool
+}
+
+// TagMatches returns the bookmark's tags, noting the ones which matched.
+func (r BookmarkSearchResult) TagMatches() []TagMatch {
+	matched := map[string]bool{}
+	for _, f := range r.Fragments["Tags"] {
+		tag := strings.NewReplacer("<mark>", "", "</mark>", "").Replace(string(f))
+		matched[html.UnescapeString(tag)] = true
+	}
+	tags := []TagMatch{}
+	for _, tag := range r.Bookmark.Tags {
+		tags = append(tags, TagMatch{Tag: tag, Matched: matched[tag]})
+	}
+	return tags
 }
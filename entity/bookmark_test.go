@@ -1,6 +1,7 @@
 package entity
 
 import (
+	"html/template"
 	"testing"
 )
 
@@ -20,3 +21,56 @@ func TestTitle(t *testing.T) {
 	}
 
 }
+
+func TestIsPublic(t *testing.T) {
+	bm := Bookmark{Tags: []string{"go", "onboarding"}}
+	if bm.IsPublic(nil) {
+		t.Error("bookmark should not be public")
+	}
+	if !bm.IsPublic([]string{"onboarding"}) {
+		t.Error("bookmark with public tag should be public")
+	}
+	bm.Public = true
+	if !bm.IsPublic(nil) {
+		t.Error("bookmark marked public should be public")
+	}
+}
+
+func TestSetHost(t *testing.T) {
+	tcs := map[string][2]string{
+		"https://www.github.com/tardisx":    {"www.github.com", "github.com"},
+		"https://Blog.Example.co.uk/post/1": {"blog.example.co.uk", "example.co.uk"},
+		"https://someone.github.io/":        {"someone.github.io", "someone.github.io"},
+		"http://localhost:8080/":            {"localhost", "localhost"},
+		"http://192.168.1.1/admin":          {"192.168.1.1", "192.168.1.1"},
+	}
+	for url, want := range tcs {
+		bm := Bookmark{URL: url}
+		bm.SetHost()
+		if bm.Host != want[0] || bm.Domain != want[1] {
+			t.Errorf("%s: got host %q domain %q, want %q %q", url, bm.Host, bm.Domain, want[0], want[1])
+		}
+	}
+}
+
+func TestSearchResultHighlights(t *testing.T) {
+	r := BookmarkSearchResult{
+		Bookmark: Bookmark{URL: "https://example.org/a&b", Tags: []string{"go", "R&D"}},
+		Fragments: map[string][]template.HTML{
+			"Tags": {"<mark>R&amp;D</mark>"},
+			"URL":  {"https://<mark>example.org</mark>/a&amp;b"},
+		},
+	}
+	tags := r.TagMatches()
+	if len(tags) != 2 || tags[0] != (TagMatch{"go", false}) || tags[1] != (TagMatch{"R&D", true}) {
+		t.Errorf("wrong tag matches %v", tags)
+	}
+	// with no title, the URL is shown
+	if got := r.HighlightedTitle(); got != "https://<mark>example.org</mark>/a&amp;b" {
+		t.Errorf("wrong title %q", got)
+	}
+	r.Bookmark.Info.Title = "Fish & chips"
+	if got := r.HighlightedTitle(); got != "Fish &amp; chips" {
+		t.Errorf("title not escaped %q", got)
+	}
+}
@@ -1,6 +1,24 @@
 package entity
 
+// Config is the configuration for a single user.
 type Config struct {
 	BaseURL string
-	Version int
+	// PublicTags are the tags whose bookmarks are all visible via the
+	// user's share links.
+	PublicTags []string
+	// FuzzyDistance is the number of typos allowed in each word of a
+	// search which finds nothing as typed, from 0 (off) to 2.
+	FuzzyDistance int
+	Boosts        FieldBoosts
+	Version       int
+}
+
+// FieldBoosts weight matches in each field when ranking search results, so
+// that a word in the title can count for more than a passing mention in
+// the page text. 0 gives the field no extra weight.
+type FieldBoosts struct {
+	Title   float64
+	Tags    float64
+	URL     float64
+	RawText float64
 }
@@ -0,0 +1,22 @@
+package entity
+
+import "time"
+
+// SavedSearch is a named search a user wants to come back to. The fields
+// are the same as the filters and sort of the manage view. FeedToken is
+// the secret in the address of its feed, which needs no login so that feed
+// readers can fetch it, or empty if the feed is turned off. The feed only
+// has the public bookmarks the search finds, unless FeedPrivate is set.
+type SavedSearch struct {
+	ID          uint64 `boltholdKey:"ID"`
+	Owner       uint64
+	Name        string
+	Query       string
+	Tags        []string
+	Domain      string
+	Period      string
+	Sort        string
+	FeedToken   string
+	FeedPrivate bool
+	Created     time.Time
+}
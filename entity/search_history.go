@@ -0,0 +1,23 @@
+package entity
+
+import "time"
+
+// SearchRecord is a query a user searched for, with the number of
+// bookmarks it found and how long it took.
+type SearchRecord struct {
+	ID        uint64 `boltholdKey:"ID"`
+	Owner     uint64
+	Query     string
+	Hits      uint64
+	Latency   time.Duration
+	Timestamp time.Time
+}
+
+// QueryCount is a query searched for Count times, most recently at Last,
+// when it found Hits bookmarks.
+type QueryCount struct {
+	Query string
+	Count int
+	Hits  uint64
+	Last  time.Time
+}
@@ -0,0 +1,13 @@
+package entity
+
+import "time"
+
+// Share is a link giving anyone who has it read only access to a user's
+// public bookmarks. If Tag is set, only the public bookmarks with that tag
+// are shared.
+type Share struct {
+	Token   string `boltholdKey:"Token"`
+	Owner   uint64
+	Tag     string
+	Created time.Time
+}
@@ -0,0 +1,34 @@
+package entity
+
+import "time"
+
+type User struct {
+	ID           uint64 `boltholdKey:"ID"`
+	Username     string
+	PasswordHash []byte
+	Admin        bool
+	Created      time.Time
+
+	// OIDCIssuer and OIDCSubject identify the user at an OpenID Connect
+	// provider, if they log in with it.
+	OIDCIssuer  string
+	OIDCSubject string
+
+	// TOTPSecret is the base32 secret for two factor authentication. It
+	// is only used once TOTPEnabled is set, until then enrollment is
+	// still pending.
+	TOTPSecret      string
+	TOTPEnabled     bool
+	TOTPLastCounter uint64
+	// TOTPFailures counts the wrong second factors entered since the last
+	// right one, and TOTPLockedUntil is when the user can try again once
+	// there have been too many.
+	TOTPFailures    int
+	TOTPLockedUntil time.Time
+	// RecoveryCodes are the SHA-256 hashes of the unused recovery codes.
+	RecoveryCodes [][]byte
+}
+
+func (u User) HasPassword() bool {
+	return len(u.PasswordHash) > 0
+}
@@ -0,0 +1,288 @@
+package web
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-contrib/sessions/cookie"
+	"github.com/gin-gonic/gin"
+	"github.com/tardisx/linkwallet/db"
+	"github.com/tardisx/linkwallet/entity"
+)
+
+const sessionName = "linkwallet_session"
+
+// sessionMaxAge is how long a login lasts. The signed cookie carries its
+// own timestamp, so a cookie older than this is rejected even if the
+// browser hangs on to it.
+const sessionMaxAge = time.Hour * 24 * 30
+
+// newSessionStore creates the cookie store for sessions, using the key
+// persisted in the database so that logins survive a restart.
+func newSessionStore(um *db.UserManager) (sessions.Store, error) {
+	key, err := um.SessionKey()
+	if err != nil {
+		return nil, err
+	}
+	store := cookie.NewStore(key[:32], key[32:])
+	store.Options(sessions.Options{
+		Path:     "/",
+		MaxAge:   int(sessionMaxAge.Seconds()),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return store, nil
+}
+
+// publicPath returns true for paths which do not require a login.
+func publicPath(path string) bool {
+	return strings.HasPrefix(path, "/assets/") || path == "/login" || strings.HasPrefix(path, "/login/") ||
+		strings.HasPrefix(path, "/share/") || strings.HasPrefix(path, "/feed/")
+}
+
+// requireLogin rejects any request without an authenticated session,
+// other than those for public paths. Browsers are redirected to the
+// login page, htmx requests are told to do the same, and API requests get
+// a JSON error.
+// The logged in user is available to handlers via currentUser.
+func requireLogin(um *db.UserManager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if publicPath(c.Request.URL.Path) {
+			c.Next()
+			return
+		}
+		// already authenticated by the proxy
+		if _, exists := c.Get("user"); exists {
+			c.Next()
+			return
+		}
+		session := sessions.Default(c)
+		if userID, ok := session.Get("user_id").(uint64); ok {
+			user, err := um.LoadUserByID(userID)
+			if err == nil {
+				c.Set("user", user)
+				c.Next()
+				return
+			} else if err != db.ErrUserNotFound {
+				c.String(http.StatusInternalServerError, err.Error())
+				c.Abort()
+				return
+			}
+			// user has been deleted since they logged in
+		}
+
+		if strings.HasPrefix(c.Request.URL.Path, "/api/") {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "not logged in"})
+			return
+		}
+		if c.GetHeader("HX-Request") == "true" {
+			c.Header("HX-Redirect", "/login")
+			c.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+		c.Redirect(http.StatusFound, "/login")
+		c.Abort()
+	}
+}
+
+// proxyAuth authenticates requests using a header set by a trusted reverse
+// proxy. Users named in the header are created if they do not exist yet.
+// A request carrying the header which did not come from a trusted proxy is
+// rejected outright, since it is an attempt to impersonate someone. Requests
+// without the header fall through to the normal login.
+func proxyAuth(um *db.UserManager, header string, trusted []*net.IPNet) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		username := strings.TrimSpace(c.GetHeader(header))
+		if username == "" {
+			c.Next()
+			return
+		}
+		if !trustedSource(c.Request.RemoteAddr, trusted) {
+			log.Printf("rejecting request from untrusted %s with %s header", c.Request.RemoteAddr, header)
+			c.String(http.StatusForbidden, "untrusted source for %s header", header)
+			c.Abort()
+			return
+		}
+
+		user, err := um.LoadUserByUsername(username)
+		if err == db.ErrUserNotFound {
+			user, err = um.ProvisionUser(username)
+		}
+		if err != nil {
+			c.String(http.StatusInternalServerError, err.Error())
+			c.Abort()
+			return
+		}
+		c.Set("user", user)
+		c.Next()
+	}
+}
+
+// trustedSource returns true if remoteAddr (in host:port form) is within
+// one of the trusted networks. Note that X-Forwarded-For and friends are
+// deliberately ignored, it is the address of the connection itself which
+// must be trusted.
+func trustedSource(remoteAddr string, trusted []*net.IPNet) bool {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, n := range trusted {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseTrustedProxies parses a comma separated list of networks in CIDR
+// notation. Bare IP addresses are treated as a single host network.
+func ParseTrustedProxies(s string) ([]*net.IPNet, error) {
+	nets := []*net.IPNet{}
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		if !strings.Contains(part, "/") {
+			ip := net.ParseIP(part)
+			if ip == nil {
+				return nil, fmt.Errorf("bad trusted proxy address '%s'", part)
+			}
+			if ip.To4() != nil {
+				part = part + "/32"
+			} else {
+				part = part + "/128"
+			}
+		}
+		_, n, err := net.ParseCIDR(part)
+		if err != nil {
+			return nil, fmt.Errorf("bad trusted proxy network '%s': %w", part, err)
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+// requireAdmin rejects any request from a user who is not an admin.
+func requireAdmin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !currentUser(c).Admin {
+			c.String(http.StatusForbidden, "admin only")
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// currentUser returns the logged in user for this request.
+func currentUser(c *gin.Context) entity.User {
+	return c.MustGet("user").(entity.User)
+}
+
+// startSession logs the user in.
+func startSession(c *gin.Context, user entity.User) error {
+	session := sessions.Default(c)
+	session.Clear()
+	session.Set("user_id", user.ID)
+	return session.Save()
+}
+
+// addAuthRoutes adds the login and logout routes.
+func addAuthRoutes(r *gin.Engine, um *db.UserManager, opts Options) {
+
+	if opts.OIDC != nil {
+		addOIDCRoutes(r, um, *opts.OIDC)
+	}
+
+	r.GET("/login", func(c *gin.Context) {
+		hasUsers, err := um.HasUsers()
+		if err != nil {
+			c.String(http.StatusInternalServerError, err.Error())
+			return
+		}
+		meta := gin.H{"page": "login", "setup": !hasUsers, "oidc": opts.OIDC != nil}
+		c.HTML(http.StatusOK, "_layout.html", meta)
+	})
+
+	r.POST("/login", func(c *gin.Context) {
+		hasUsers, err := um.HasUsers()
+		if err != nil {
+			c.String(http.StatusInternalServerError, err.Error())
+			return
+		}
+		username := c.PostForm("username")
+		password := c.PostForm("password")
+
+		var user entity.User
+
+		// first run, create the admin user
+		if !hasUsers {
+			meta := gin.H{"page": "login", "setup": true, "oidc": opts.OIDC != nil, "username": username}
+			if password != c.PostForm("confirm") {
+				meta["error"] = "passwords do not match"
+				c.HTML(http.StatusBadRequest, "_layout.html", meta)
+				return
+			}
+			user = entity.User{Username: username}
+			err := um.AddUser(&user, password)
+			if err != nil {
+				meta["error"] = err.Error()
+				c.HTML(http.StatusBadRequest, "_layout.html", meta)
+				return
+			}
+			log.Printf("admin user %s created from %s", user.Username, c.ClientIP())
+		} else {
+			var ok bool
+			user, ok, err = um.CheckPassword(username, password)
+			if err != nil {
+				c.String(http.StatusInternalServerError, err.Error())
+				return
+			}
+			if !ok {
+				log.Printf("failed login for %s from %s", username, c.ClientIP())
+				meta := gin.H{"page": "login", "oidc": opts.OIDC != nil, "error": "incorrect username or password", "username": username}
+				c.HTML(http.StatusUnauthorized, "_layout.html", meta)
+				return
+			}
+			if user.TOTPEnabled {
+				err = startSecondFactor(c, user)
+				if err != nil {
+					c.String(http.StatusInternalServerError, err.Error())
+					return
+				}
+				c.Redirect(http.StatusSeeOther, "/login/2fa")
+				return
+			}
+		}
+
+		err = startSession(c, user)
+		if err != nil {
+			c.String(http.StatusInternalServerError, err.Error())
+			return
+		}
+		c.Redirect(http.StatusSeeOther, "/")
+	})
+
+	// a POST with the CSRF token, so other sites cannot log users out
+	r.POST("/logout", func(c *gin.Context) {
+		session := sessions.Default(c)
+		session.Clear()
+		session.Options(sessions.Options{Path: "/", MaxAge: -1})
+		err := session.Save()
+		if err != nil {
+			log.Printf("could not clear session: %s", err)
+		}
+		c.Redirect(http.StatusSeeOther, "/login")
+	})
+}
@@ -0,0 +1,118 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tardisx/linkwallet/db"
+)
+
+func newTestDB(t *testing.T) *db.DB {
+	dbh := &db.DB{}
+	f, _ := os.CreateTemp("", "test_boltdb_*")
+	f.Close()
+	t.Cleanup(func() {
+		dbh.Close()
+		os.Remove(f.Name())
+		os.RemoveAll(f.Name() + ".bleve")
+	})
+	_, err := dbh.Open(f.Name())
+	if err != nil {
+		t.Fatalf("could not open db: %s", err)
+	}
+	return dbh
+}
+
+func newTestUserManager(t *testing.T) *db.UserManager {
+	return db.NewUserManager(newTestDB(t))
+}
+
+func TestParseTrustedProxies(t *testing.T) {
+	nets, err := ParseTrustedProxies("10.0.0.0/8, 127.0.0.1,::1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nets) != 3 {
+		t.Fatalf("expected 3 networks, got %d", len(nets))
+	}
+
+	tcs := map[string]bool{
+		"10.1.2.3:1234":  true,
+		"127.0.0.1:80":   true,
+		"127.0.0.2:80":   false,
+		"[::1]:80":       true,
+		"192.168.1.1:80": false,
+		"garbage":        false,
+	}
+	for addr, exp := range tcs {
+		if trustedSource(addr, nets) != exp {
+			t.Errorf("expected %v for %s", exp, addr)
+		}
+	}
+
+	_, err = ParseTrustedProxies("10.0.0.0/33")
+	if err == nil {
+		t.Error("expected error for bad network")
+	}
+}
+
+func TestProxyAuth(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	um := newTestUserManager(t)
+	nets, _ := ParseTrustedProxies("10.0.0.1")
+
+	r := gin.New()
+	r.Use(proxyAuth(um, "Remote-User", nets))
+	r.GET("/", func(c *gin.Context) {
+		if _, exists := c.Get("user"); !exists {
+			c.String(http.StatusUnauthorized, "")
+			return
+		}
+		c.String(http.StatusOK, currentUser(c).Username)
+	})
+
+	type tc struct {
+		remoteAddr string
+		header     string
+		expStatus  int
+		expBody    string
+	}
+	tcs := []tc{
+		// trusted proxy, user is provisioned
+		{remoteAddr: "10.0.0.1:5000", header: "alice", expStatus: http.StatusOK, expBody: "alice"},
+		// untrusted source trying to spoof the header
+		{remoteAddr: "10.0.0.2:5000", header: "alice", expStatus: http.StatusForbidden},
+		// no header, falls through to normal login
+		{remoteAddr: "10.0.0.2:5000", header: "", expStatus: http.StatusUnauthorized},
+		{remoteAddr: "10.0.0.1:5000", header: "", expStatus: http.StatusUnauthorized},
+	}
+
+	for _, tc := range tcs {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = tc.remoteAddr
+		// a forwarded header must not make an untrusted source trusted
+		req.Header.Set("X-Forwarded-For", "10.0.0.1")
+		if tc.header != "" {
+			req.Header.Set("Remote-User", tc.header)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != tc.expStatus {
+			t.Errorf("%s %q: expected status %d got %d", tc.remoteAddr, tc.header, tc.expStatus, w.Code)
+		}
+		if tc.expBody != "" && w.Body.String() != tc.expBody {
+			t.Errorf("%s %q: expected body %q got %q", tc.remoteAddr, tc.header, tc.expBody, w.Body.String())
+		}
+	}
+
+	u, err := um.LoadUserByUsername("alice")
+	if err != nil {
+		t.Fatalf("alice was not provisioned: %s", err)
+	}
+	if u.HasPassword() {
+		t.Error("provisioned user should not have a password")
+	}
+}
@@ -0,0 +1,74 @@
+package web
+
+import (
+	"crypto/subtle"
+	"log"
+	"net/http"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+)
+
+// csrfHeader is the header htmx sends the token in, see the hx-headers
+// attribute in _layout.html.
+const csrfHeader = "X-CSRF-Token"
+
+// csrfProtect rejects state changing requests which do not carry the
+// token for the session, so that other sites cannot make them on behalf
+// of a logged in user. The token is issued on the first safe request of
+// the session, and handlers rendering the layout must pass it on via
+// csrfToken. Public paths are exempt: there is no session to protect until
+// the login forms succeed, and the shared pages and feeds change nothing.
+func csrfProtect() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if publicPath(c.Request.URL.Path) {
+			c.Next()
+			return
+		}
+
+		session := sessions.Default(c)
+		token, _ := session.Get("csrf_token").(string)
+
+		switch c.Request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			if token == "" {
+				var err error
+				token, err = randomString()
+				if err != nil {
+					c.String(http.StatusInternalServerError, err.Error())
+					c.Abort()
+					return
+				}
+				session.Set("csrf_token", token)
+				err = session.Save()
+				if err != nil {
+					c.String(http.StatusInternalServerError, err.Error())
+					c.Abort()
+					return
+				}
+			}
+			c.Set("csrf_token", token)
+			c.Next()
+			return
+		}
+
+		sent := c.GetHeader(csrfHeader)
+		if sent == "" {
+			sent = c.PostForm("csrf_token")
+		}
+		if token == "" || subtle.ConstantTimeCompare([]byte(sent), []byte(token)) != 1 {
+			log.Printf("rejecting %s %s from %s with bad CSRF token", c.Request.Method, c.Request.URL.Path, c.ClientIP())
+			c.String(http.StatusForbidden, "invalid CSRF token, please reload the page")
+			c.Abort()
+			return
+		}
+		c.Set("csrf_token", token)
+		c.Next()
+	}
+}
+
+// csrfToken returns the token for the session, to be included in the
+// page.
+func csrfToken(c *gin.Context) string {
+	return c.GetString("csrf_token")
+}
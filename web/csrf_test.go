@@ -0,0 +1,104 @@
+package web
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tardisx/linkwallet/db"
+)
+
+func TestCSRFProtect(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	dbh := newTestDB(t)
+	cmm := db.NewConfigManager(dbh)
+	ts := httptest.NewServer(Create(db.NewBookmarkManager(dbh), cmm, db.NewUserManager(dbh), db.NewShareManager(dbh), db.NewSavedSearchManager(dbh), Options{}).engine)
+	t.Cleanup(ts.Close)
+
+	// logging in needs no token
+	client := newCookieClient()
+	res, err := client.PostForm(ts.URL+"/login", url.Values{"username": {"admin"}, "password": {"correct horse battery"}, "confirm": {"correct horse battery"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(res.Body)
+	res.Body.Close()
+	m := regexp.MustCompile(`"X-CSRF-Token": "([^"]+)"`).FindSubmatch(body)
+	if m == nil {
+		t.Fatalf("no CSRF token in page at %s", res.Request.URL.Path)
+	}
+	token := string(m[1])
+
+	post := func(token string) int {
+		req, _ := http.NewRequest(http.MethodPost, ts.URL+"/config", strings.NewReader("baseurl=http://example.com"))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if token != "" {
+			req.Header.Set(csrfHeader, token)
+		}
+		res, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		return res.StatusCode
+	}
+
+	if status := post(""); status != http.StatusForbidden {
+		t.Errorf("expected request without token to be forbidden, got %d", status)
+	}
+	if status := post("forged"); status != http.StatusForbidden {
+		t.Errorf("expected request with wrong token to be forbidden, got %d", status)
+	}
+	config, _ := cmm.LoadConfig(1)
+	if config.BaseURL == "http://example.com" {
+		t.Error("config was changed without a token")
+	}
+	if status := post(token); status != http.StatusOK {
+		t.Errorf("expected request with token to succeed, got %d", status)
+	}
+	config, _ = cmm.LoadConfig(1)
+	if config.BaseURL != "http://example.com" {
+		t.Error("config was not changed")
+	}
+
+	// logging out needs it too, so other sites cannot do it
+	res, err = client.Get(ts.URL + "/logout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	res, err = client.Get(ts.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.Request.URL.Path != "/" {
+		t.Errorf("expected GET to leave the session alone, ended up at %s", res.Request.URL.Path)
+	}
+	res, err = client.PostForm(ts.URL+"/logout", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusForbidden {
+		t.Errorf("expected logout without token to be forbidden, got %d", res.StatusCode)
+	}
+	res, err = client.PostForm(ts.URL+"/logout", url.Values{"csrf_token": {token}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	res, err = client.Get(ts.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.Request.URL.Path != "/login" {
+		t.Errorf("expected to be logged out, ended up at %s", res.Request.URL.Path)
+	}
+}
@@ -0,0 +1,146 @@
+package web
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/tardisx/linkwallet/content"
+	"github.com/tardisx/linkwallet/db"
+)
+
+// facetLink is a term shown beside search results, which adds the term to
+// (or for a selected term, removes it from) the filters when clicked.
+type facetLink struct {
+	Term     string
+	Count    int
+	Selected bool
+	// Filter is the value of the filter field after clicking
+	Filter string
+}
+
+// facetGroup is a set of filters for a search form, such as its tags.
+// Clicking a link updates the hidden Field and sends a search event to
+// Input.
+type facetGroup struct {
+	Label string
+	Input string
+	Field string
+	Links []facetLink
+}
+
+// parseTagFilter parses the pipe separated tags from a filter field.
+func parseTagFilter(s string) []string {
+	tags := []string{}
+	for _, tag := range strings.Split(s, "|") {
+		if tag != "" && !slices.Contains(tags, tag) {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// newTagFacets creates the links for the tags of the search results, with
+// the currently selected tags first. Selecting more tags narrows the
+// results down to bookmarks with all of them.
+func newTagFacets(input, field string, selected []string, res db.SearchResults) facetGroup {
+	fg := facetGroup{Label: "Tags", Input: input, Field: field}
+	for _, tag := range selected {
+		without := slices.DeleteFunc(slices.Clone(selected), func(t string) bool { return t == tag })
+		fg.Links = append(fg.Links, facetLink{Term: tag, Count: int(res.Total), Selected: true, Filter: strings.Join(without, "|")})
+	}
+	for _, f := range res.Tags {
+		if slices.Contains(selected, f.Term) {
+			continue
+		}
+		with := append(slices.Clone(selected), f.Term)
+		fg.Links = append(fg.Links, facetLink{Term: f.Term, Count: f.Count, Filter: strings.Join(with, "|")})
+	}
+	return fg
+}
+
+// newDomainFacets creates the links for the domains of the search results.
+// Only one domain can be selected at a time, and when it is, it is the
+// only link.
+func newDomainFacets(input, field string, selected string, res db.SearchResults) facetGroup {
+	fg := facetGroup{Label: "Domains", Input: input, Field: field}
+	if selected != "" {
+		fg.Links = append(fg.Links, facetLink{Term: selected, Count: int(res.Total), Selected: true})
+		return fg
+	}
+	for _, f := range res.Domains {
+		fg.Links = append(fg.Links, facetLink{Term: f.Term, Count: f.Count, Filter: f.Term})
+	}
+	return fg
+}
+
+// newLanguageFacets creates the links for the languages of the search
+// results, named in full. Like domains, only one can be selected at a
+// time. They are left out if the results are all in one language, as
+// there would be nothing to choose between.
+func newLanguageFacets(input, field string, selected string, res db.SearchResults) facetGroup {
+	fg := facetGroup{Label: "Languages", Input: input, Field: field}
+	if selected != "" {
+		fg.Links = append(fg.Links, facetLink{Term: content.LanguageName(selected), Count: int(res.Total), Selected: true})
+		return fg
+	}
+	if len(res.Languages) < 2 {
+		return fg
+	}
+	for _, f := range res.Languages {
+		fg.Links = append(fg.Links, facetLink{Term: content.LanguageName(f.Term), Count: f.Count, Filter: f.Term})
+	}
+	return fg
+}
+
+// timelineBar is a bar in the histogram of when the results were
+// bookmarked. Clicking it filters the results to its period, or for the
+// selected month, zooms back out to the year.
+type timelineBar struct {
+	Label    string
+	Title    string
+	Count    int
+	Height   int
+	Selected bool
+	Filter   string
+}
+
+// timeline is the histogram for a search form, which works like a
+// facetGroup. Selected is the period being filtered on, if any.
+type timeline struct {
+	Input    string
+	Field    string
+	Selected string
+	Bars     []timelineBar
+}
+
+// newTimeline creates the histogram for the search results. The bars are
+// scaled so that the tallest is the full height.
+func newTimeline(input, field string, selected string, res db.SearchResults) timeline {
+	tl := timeline{Input: input, Field: field, Selected: selected}
+	max := 0
+	for _, pc := range res.Timeline {
+		if pc.Count > max {
+			max = pc.Count
+		}
+	}
+	if max == 0 {
+		return tl
+	}
+	for _, pc := range res.Timeline {
+		bar := timelineBar{Count: pc.Count, Height: pc.Count * 100 / max, Filter: pc.Period}
+		if len(pc.Period) == len("2006") {
+			bar.Label = pc.Period
+			bar.Title = fmt.Sprintf("%d bookmarked in %s", pc.Count, pc.Period)
+		} else {
+			bar.Label = pc.Start.Format("Jan")
+			bar.Title = fmt.Sprintf("%d bookmarked in %s", pc.Count, pc.Start.Format("January 2006"))
+		}
+		if pc.Period == selected {
+			bar.Selected = true
+			bar.Filter = pc.Start.Format("2006")
+		}
+		tl.Bars = append(tl.Bars, bar)
+	}
+	return tl
+}
@@ -0,0 +1,103 @@
+package web
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/tardisx/linkwallet/db"
+)
+
+func TestParseTagFilter(t *testing.T) {
+	tcs := map[string][]string{
+		"":                        {},
+		"golang":                  {"golang"},
+		"golang|machine learning": {"golang", "machine learning"},
+		"|golang||golang|":        {"golang"},
+	}
+	for in, want := range tcs {
+		if got := parseTagFilter(in); !slices.Equal(got, want) {
+			t.Errorf("%q: got %v, want %v", in, got, want)
+		}
+	}
+}
+
+func TestNewTagFacets(t *testing.T) {
+	res := db.SearchResults{Total: 3, Tags: []db.FacetCount{{Term: "golang", Count: 3}, {Term: "web", Count: 2}, {Term: "rust", Count: 1}}}
+	tf := newTagFacets("q", "f", []string{"golang"}, res)
+
+	want := []facetLink{
+		{Term: "golang", Count: 3, Selected: true, Filter: ""},
+		{Term: "web", Count: 2, Filter: "golang|web"},
+		{Term: "rust", Count: 1, Filter: "golang|rust"},
+	}
+	if !slices.Equal(tf.Links, want) {
+		t.Errorf("got %v, want %v", tf.Links, want)
+	}
+}
+
+func TestNewDomainFacets(t *testing.T) {
+	res := db.SearchResults{Total: 3, Domains: []db.FacetCount{{Term: "github.com", Count: 2}, {Term: "example.co.uk", Count: 1}}}
+
+	df := newDomainFacets("q", "f", "", res)
+	want := []facetLink{
+		{Term: "github.com", Count: 2, Filter: "github.com"},
+		{Term: "example.co.uk", Count: 1, Filter: "example.co.uk"},
+	}
+	if !slices.Equal(df.Links, want) {
+		t.Errorf("got %v, want %v", df.Links, want)
+	}
+
+	df = newDomainFacets("q", "f", "github.com", db.SearchResults{Total: 2, Domains: res.Domains[:1]})
+	want = []facetLink{{Term: "github.com", Count: 2, Selected: true}}
+	if !slices.Equal(df.Links, want) {
+		t.Errorf("got %v, want %v", df.Links, want)
+	}
+}
+
+func TestNewLanguageFacets(t *testing.T) {
+	res := db.SearchResults{Total: 3, Languages: []db.FacetCount{{Term: "de", Count: 2}, {Term: "ja", Count: 1}}}
+
+	lf := newLanguageFacets("q", "f", "", res)
+	want := []facetLink{
+		{Term: "German", Count: 2, Filter: "de"},
+		{Term: "Japanese", Count: 1, Filter: "ja"},
+	}
+	if !slices.Equal(lf.Links, want) {
+		t.Errorf("got %v, want %v", lf.Links, want)
+	}
+
+	// nothing to choose between
+	lf = newLanguageFacets("q", "f", "", db.SearchResults{Total: 2, Languages: res.Languages[:1]})
+	if len(lf.Links) != 0 {
+		t.Errorf("expected no links for one language, got %v", lf.Links)
+	}
+
+	lf = newLanguageFacets("q", "f", "de", db.SearchResults{Total: 2, Languages: res.Languages[:1]})
+	want = []facetLink{{Term: "German", Count: 2, Selected: true}}
+	if !slices.Equal(lf.Links, want) {
+		t.Errorf("got %v, want %v", lf.Links, want)
+	}
+}
+
+func TestNewTimeline(t *testing.T) {
+	march := time.Date(2024, time.March, 1, 0, 0, 0, 0, time.Local)
+	res := db.SearchResults{Timeline: []db.PeriodCount{
+		{Period: "2024-02", Start: march.AddDate(0, -1, 0), Count: 1},
+		{Period: "2024-03", Start: march, Count: 4},
+		{Period: "2024-04", Start: march.AddDate(0, 1, 0), Count: 0},
+	}}
+	tl := newTimeline("q", "f", "2024-03", res)
+	want := []timelineBar{
+		{Label: "Feb", Title: "1 bookmarked in February 2024", Count: 1, Height: 25, Filter: "2024-02"},
+		{Label: "Mar", Title: "4 bookmarked in March 2024", Count: 4, Height: 100, Selected: true, Filter: "2024"},
+		{Label: "Apr", Title: "0 bookmarked in April 2024", Count: 0, Height: 0, Filter: "2024-04"},
+	}
+	if !slices.Equal(tl.Bars, want) {
+		t.Errorf("got %v, want %v", tl.Bars, want)
+	}
+
+	if tl := newTimeline("q", "f", "", db.SearchResults{}); len(tl.Bars) != 0 {
+		t.Errorf("expected no bars without results, got %v", tl.Bars)
+	}
+}
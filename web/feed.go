@@ -0,0 +1,75 @@
+package web
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tardisx/linkwallet/entity"
+)
+
+// atomFeed is the minimal subset of an Atom (RFC 4287) feed needed to
+// publish a list of bookmarks.
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Link    []atomLink  `xml:"link"`
+	Author  atomAuthor  `xml:"author"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomEntry struct {
+	ID       string         `xml:"id"`
+	Title    string         `xml:"title"`
+	Updated  string         `xml:"updated"`
+	Link     atomLink       `xml:"link"`
+	Category []atomCategory `xml:"category"`
+}
+
+type atomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+// renderFeed writes bookmarks as an Atom feed. feedURL is the absolute URL
+// of the feed itself, and is also used as its ID.
+func renderFeed(c *gin.Context, title string, feedURL string, updated time.Time, bookmarks []entity.Bookmark) {
+	feed := atomFeed{
+		ID:      feedURL,
+		Title:   title,
+		Updated: updated.UTC().Format(time.RFC3339),
+		Link:    []atomLink{{Href: feedURL, Rel: "self"}},
+		Author:  atomAuthor{Name: "linkwallet"},
+	}
+	for _, bm := range bookmarks {
+		entry := atomEntry{
+			ID:      fmt.Sprintf("%s#%d", feedURL, bm.ID),
+			Title:   bm.DisplayTitle(),
+			Updated: bm.TimestampCreated.UTC().Format(time.RFC3339),
+			Link:    atomLink{Href: bm.URL},
+		}
+		for _, tag := range bm.Tags {
+			entry.Category = append(entry.Category, atomCategory{Term: tag})
+		}
+		feed.Entries = append(feed.Entries, entry)
+	}
+
+	out, err := xml.MarshalIndent(feed, "", "  ")
+	if err != nil {
+		c.String(http.StatusInternalServerError, err.Error())
+		return
+	}
+	c.Data(http.StatusOK, "application/atom+xml; charset=utf-8", append([]byte(xml.Header), out...))
+}
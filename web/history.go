@@ -0,0 +1,53 @@
+package web
+
+import (
+	"net/http"
+	"net/url"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tardisx/linkwallet/db"
+)
+
+// historySize is the number of searches shown in each list on the history
+// page.
+const historySize = 25
+
+// searchURL returns the address of the results of searching for the
+// query.
+func searchURL(query string) string {
+	return "/search?" + url.Values{"q": {query}}.Encode()
+}
+
+// addHistoryRoutes adds the routes to see and clear the user's search
+// history.
+func addHistoryRoutes(r *gin.Engine, bmm *db.BookmarkManager, cmm *db.ConfigManager) {
+
+	// history renders the history page, or just its lists if partial.
+	history := func(c *gin.Context, partial bool, err error) {
+		config, ok := loadConfig(c, cmm)
+		if !ok {
+			return
+		}
+		user := currentUser(c)
+		h, loadErr := bmm.SearchHistory(user.ID, historySize)
+		if loadErr != nil {
+			c.String(http.StatusInternalServerError, loadErr.Error())
+			return
+		}
+		meta := gin.H{"page": "history", "config": config, "user": user, "csrf_token": csrfToken(c), "history": h, "error": err}
+		if partial {
+			c.HTML(http.StatusOK, "history_lists.html", meta)
+			return
+		}
+		c.HTML(http.StatusOK, "_layout.html", meta)
+	}
+
+	r.GET("/history", func(c *gin.Context) {
+		history(c, false, nil)
+	})
+
+	r.DELETE("/history", func(c *gin.Context) {
+		err := bmm.ClearSearchHistory(currentUser(c).ID)
+		history(c, true, err)
+	})
+}
@@ -0,0 +1,83 @@
+package web
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tardisx/linkwallet/db"
+	"github.com/tardisx/linkwallet/entity"
+)
+
+func TestSearchHistoryPage(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	dbh := newTestDB(t)
+	bmm := db.NewBookmarkManager(dbh)
+	ts := httptest.NewServer(Create(bmm, db.NewConfigManager(dbh), db.NewUserManager(dbh), db.NewShareManager(dbh), db.NewSavedSearchManager(dbh), Options{}).engine)
+	t.Cleanup(ts.Close)
+
+	// the first login creates the admin user
+	client := newCookieClient()
+	res, err := client.PostForm(ts.URL+"/login", url.Values{"username": {"admin"}, "password": {"correct horse battery"}, "confirm": {"correct horse battery"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(res.Body)
+	res.Body.Close()
+	m := regexp.MustCompile(`"X-CSRF-Token": "([^"]+)"`).FindSubmatch(body)
+	if m == nil {
+		t.Fatalf("no CSRF token in page at %s", res.Request.URL.Path)
+	}
+	token := string(m[1])
+
+	bm := entity.Bookmark{URL: "https://example.com/operator", Owner: 1, Info: entity.PageInfo{Title: "Writing an operator"}}
+	err = bmm.AddBookmark(&bm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bmm.UpdateIndexForBookmark(&bm)
+
+	do := func(method string, path string, form url.Values) string {
+		req, _ := http.NewRequest(method, ts.URL+path, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set(csrfHeader, token)
+		res, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(res.Body)
+		res.Body.Close()
+		if res.StatusCode != http.StatusOK {
+			t.Fatalf("%s %s: status %d", method, path, res.StatusCode)
+		}
+		return string(body)
+	}
+
+	do(http.MethodPost, "/search", url.Values{"query": {"operator"}})
+	do(http.MethodPost, "/search", url.Values{"query": {"zebra crossing"}})
+
+	page := do(http.MethodGet, "/history", nil)
+	noResults := page[strings.Index(page, "Found nothing"):]
+	if !strings.Contains(page, `href="/search?q=operator"`) || strings.Contains(noResults, "operator") {
+		t.Errorf("operator search not listed as found: %s", page)
+	}
+	if !strings.Contains(noResults, `href="/search?q=zebra&#43;crossing"`) {
+		t.Errorf("zebra search not listed as finding nothing: %s", noResults)
+	}
+
+	// following a link runs the query again
+	results := do(http.MethodGet, "/search?q=operator", nil)
+	if !strings.Contains(results, `value="operator"`) || !strings.Contains(results, "https://example.com/operator") {
+		t.Errorf("query not run again: %s", results)
+	}
+
+	cleared := do(http.MethodDelete, "/history", nil)
+	if strings.Contains(cleared, "zebra") || !strings.Contains(cleared, "no searches yet") {
+		t.Errorf("history not cleared: %s", cleared)
+	}
+}
@@ -0,0 +1,201 @@
+package web
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tardisx/linkwallet/db"
+)
+
+// managePageSize is the number of bookmarks on each page of the manage
+// view.
+const managePageSize = 50
+
+// manageView is the state of the manage view, kept in the URL so that any
+// view can be bookmarked or reloaded.
+type manageView struct {
+	Query  string
+	Tags   []string
+	Domain string
+	Period string
+	// Sort is a key of db.SortFields, prefixed with - for descending order.
+	Sort string
+	Page int
+}
+
+// parseManageView reads the view from the request params, using get to
+// fetch each one. Anything invalid is replaced with the default.
+func parseManageView(get func(string) string) manageView {
+	v := manageView{
+		Query:  get("query"),
+		Tags:   parseTagFilter(get("filter_tags")),
+		Domain: get("filter_domain"),
+		Period: get("filter_period"),
+		Sort:   get("sort"),
+	}
+	if _, ok := db.SortFields[strings.TrimPrefix(v.Sort, "-")]; !ok {
+		v.Sort = db.DefaultSort
+	}
+	v.Page, _ = strconv.Atoi(get("page"))
+	if v.Page < 1 {
+		v.Page = 1
+	}
+	return v
+}
+
+// URL returns the address of the manage page showing this view.
+func (v manageView) URL() string {
+	params := url.Values{}
+	if v.Query != "" {
+		params.Set("query", v.Query)
+	}
+	if len(v.Tags) > 0 {
+		params.Set("filter_tags", strings.Join(v.Tags, "|"))
+	}
+	if v.Domain != "" {
+		params.Set("filter_domain", v.Domain)
+	}
+	if v.Period != "" {
+		params.Set("filter_period", v.Period)
+	}
+	if v.Sort != db.DefaultSort {
+		params.Set("sort", v.Sort)
+	}
+	if v.Page > 1 {
+		params.Set("page", strconv.Itoa(v.Page))
+	}
+	if len(params) == 0 {
+		return "/manage"
+	}
+	return "/manage?" + params.Encode()
+}
+
+// searchOptions returns the options to search for the bookmarks on the
+// page.
+func (v manageView) searchOptions(owner uint64) db.SearchOptions {
+	return db.SearchOptions{
+		Owner:   owner,
+		All:     v.Query == "",
+		Query:   v.Query,
+		Tags:    v.Tags,
+		Domain:  v.Domain,
+		Period:  v.Period,
+		Results: managePageSize,
+		From:    (v.Page - 1) * managePageSize,
+		Sort:    db.SortOrder(v.Sort),
+	}
+}
+
+// ColumnInfo is a sortable column heading in the manage view.
+type ColumnInfo struct {
+	Name  string
+	Param string
+	Class string
+	// Sort is the sort param when the heading is clicked, and URL the view
+	// it leads to. Sorted is the direction the column is currently sorted
+	// in, if it is.
+	Sort   string
+	URL    string
+	Sorted string
+}
+
+// manageColumns returns the column headings for the view. Clicking the
+// sorted column reverses it, any other sorts the most useful way first: A
+// to Z for titles, and newest, worst or biggest first for the others.
+func manageColumns(v manageView) []ColumnInfo {
+	cols := []ColumnInfo{
+		{Name: "title", Param: "title"},
+		{Name: "created", Param: "created", Class: "show-for-large"},
+		{Name: "scraped", Param: "scraped", Class: "show-for-large"},
+		{Name: "status", Param: "status", Class: "show-for-large"},
+		{Name: "size", Param: "size", Class: "show-for-large"},
+	}
+	for i, col := range cols {
+		switch v.Sort {
+		case col.Param:
+			cols[i].Sorted = "ascending"
+			cols[i].Sort = "-" + col.Param
+		case "-" + col.Param:
+			cols[i].Sorted = "descending"
+			cols[i].Sort = col.Param
+		default:
+			cols[i].Sort = "-" + col.Param
+			if col.Param == "title" {
+				cols[i].Sort = col.Param
+			}
+		}
+		sorted := v
+		sorted.Sort = cols[i].Sort
+		sorted.Page = 1
+		cols[i].URL = sorted.URL()
+	}
+	return cols
+}
+
+// managePage is a link to another page of the manage view.
+type managePage struct {
+	Number int
+	URL    string
+}
+
+// addManageRoutes adds the routes for the manage view.
+func addManageRoutes(r *gin.Engine, bmm *db.BookmarkManager, cmm *db.ConfigManager) {
+
+	// results searches for the bookmarks in the view, returning the data
+	// to render them with.
+	results := func(c *gin.Context, v manageView) gin.H {
+		res, err := bmm.Search(v.searchOptions(currentUser(c).ID))
+
+		pages := int((res.Total + managePageSize - 1) / managePageSize)
+		meta := gin.H{
+			"view":    v,
+			"results": res.Hits,
+			"total":   res.Total,
+			"first":   (v.Page-1)*managePageSize + 1,
+			"last":    (v.Page-1)*managePageSize + len(res.Hits),
+			"pages":   pages,
+			"error":   err,
+			"column":  manageColumns(v),
+			"facets": []facetGroup{
+				newTagFacets("manage-search", "manage-filter-tags", v.Tags, res),
+				newDomainFacets("manage-search", "manage-filter-domain", v.Domain, res),
+			},
+		}
+		if v.Page > 1 {
+			prev := v
+			prev.Page--
+			meta["prev"] = managePage{Number: prev.Page, URL: prev.URL()}
+		}
+		if v.Page < pages {
+			next := v
+			next.Page++
+			meta["next"] = managePage{Number: next.Page, URL: next.URL()}
+		}
+		return meta
+	}
+
+	r.GET("/manage", func(c *gin.Context) {
+		config, ok := loadConfig(c, cmm)
+		if !ok {
+			return
+		}
+		meta := results(c, parseManageView(c.Query))
+		meta["page"] = "manage"
+		meta["config"] = config
+		meta["user"] = currentUser(c)
+		meta["csrf_token"] = csrfToken(c)
+		c.HTML(http.StatusOK,
+			"_layout.html", meta,
+		)
+	})
+
+	r.POST("/manage/results", func(c *gin.Context) {
+		v := parseManageView(c.PostForm)
+		// keep the address bar in step, so the view can be bookmarked
+		c.Header("HX-Push", v.URL())
+		c.HTML(http.StatusOK, "manage_results.html", results(c, v))
+	})
+}
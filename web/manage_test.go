@@ -0,0 +1,53 @@
+package web
+
+import (
+	"net/url"
+	"slices"
+	"testing"
+)
+
+func TestManageView(t *testing.T) {
+	tcs := map[string]string{
+		"":                                    "/manage",
+		"sort=-created&page=1":                "/manage",
+		"sort=bogus&page=-3":                  "/manage",
+		"sort=title&page=2":                   "/manage?page=2&sort=title",
+		"query=go+tag:x&filter_tags=a|b":      "/manage?filter_tags=a%7Cb&query=go+tag%3Ax",
+		"filter_domain=github.com&sort=-size": "/manage?filter_domain=github.com&sort=-size",
+	}
+	for in, want := range tcs {
+		params, _ := url.ParseQuery(in)
+		v := parseManageView(params.Get)
+		if got := v.URL(); got != want {
+			t.Errorf("%q: got URL %q, want %q", in, got, want)
+		}
+		// the URL must lead back to the same view
+		u, _ := url.Parse(v.URL())
+		again := parseManageView(u.Query().Get)
+		if again.URL() != v.URL() {
+			t.Errorf("%q: view did not survive a round trip, got %q", in, again.URL())
+		}
+	}
+
+	v := parseManageView(url.Values{"sort": {"-size"}, "page": {"3"}}.Get)
+	opts := v.searchOptions(1)
+	if opts.From != 2*managePageSize || opts.Results != managePageSize || !slices.Equal(opts.Sort, []string{"-Info.Size", "_id"}) || !opts.All {
+		t.Errorf("wrong search options %+v", opts)
+	}
+}
+
+func TestManageColumns(t *testing.T) {
+	cols := manageColumns(manageView{Sort: "title", Page: 4})
+	for _, col := range cols {
+		switch col.Param {
+		case "title":
+			if col.Sorted != "ascending" || col.Sort != "-title" || col.URL != "/manage?sort=-title" {
+				t.Errorf("sorted column should reverse, got %+v", col)
+			}
+		case "created":
+			if col.Sorted != "" || col.Sort != "-created" || col.URL != "/manage" {
+				t.Errorf("created should sort newest first, got %+v", col)
+			}
+		}
+	}
+}
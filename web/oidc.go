@@ -0,0 +1,285 @@
+package web
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	"github.com/tardisx/linkwallet/db"
+	"golang.org/x/oauth2"
+)
+
+// OIDCOptions configures login via an OpenID Connect provider.
+type OIDCOptions struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	// RedirectURL is the full URL of /login/oidc/callback, as registered
+	// with the provider.
+	RedirectURL string
+	// UsernameClaim is the claim used to name users the first time they
+	// log in. If it is not present in the token, the verified email and
+	// then the subject are used. Users are known by their subject after
+	// that, so it does not matter if it changes.
+	UsernameClaim string
+	// GroupsClaim is the claim containing the list of groups the user
+	// belongs to.
+	GroupsClaim string
+	// AdminGroup, if set, is the group whose members are admins. Admin
+	// rights are updated on every login.
+	AdminGroup string
+}
+
+// oidcDiscoveryTimeout is how long to wait for the provider's discovery
+// document.
+const oidcDiscoveryTimeout = time.Second * 10
+
+// oidcLogin handles the authorization code flow. The provider is
+// discovered on first use rather than at startup, so linkwallet can still
+// start if the provider is temporarily unavailable.
+type oidcLogin struct {
+	opts OIDCOptions
+
+	mu       sync.Mutex
+	provider *oidc.Provider
+}
+
+func (o *oidcLogin) init(ctx context.Context) (*oidc.Provider, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.provider == nil {
+		// not the request context, as the first login to try waits for it
+		// on behalf of any others
+		ctx, cancel := context.WithTimeout(context.Background(), oidcDiscoveryTimeout)
+		defer cancel()
+		provider, err := oidc.NewProvider(ctx, o.opts.Issuer)
+		if err != nil {
+			return nil, fmt.Errorf("could not discover OIDC provider %s: %w", o.opts.Issuer, err)
+		}
+		o.provider = provider
+	}
+	return o.provider, nil
+}
+
+func (o *oidcLogin) oauth2Config(provider *oidc.Provider) *oauth2.Config {
+	return &oauth2.Config{
+		ClientID:     o.opts.ClientID,
+		ClientSecret: o.opts.ClientSecret,
+		RedirectURL:  o.opts.RedirectURL,
+		Endpoint:     provider.Endpoint(),
+		Scopes:       []string{oidc.ScopeOpenID, "profile", "email"},
+	}
+}
+
+// username returns the name for a new user from the token claims.
+func (o *oidcLogin) username(claims map[string]any) (string, error) {
+	for _, claim := range []string{o.opts.UsernameClaim, "email", "sub"} {
+		if claim == "email" && claims["email_verified"] != true {
+			continue
+		}
+		if s, ok := claims[claim].(string); ok && s != "" {
+			return s, nil
+		}
+	}
+	return "", errors.New("no username in token claims")
+}
+
+// groups returns the groups from the token claims, which may be a list of
+// strings or a single string.
+func (o *oidcLogin) groups(claims map[string]any) []string {
+	switch v := claims[o.opts.GroupsClaim].(type) {
+	case string:
+		return []string{v}
+	case []any:
+		groups := []string{}
+		for _, g := range v {
+			if s, ok := g.(string); ok {
+				groups = append(groups, s)
+			}
+		}
+		return groups
+	}
+	return nil
+}
+
+func randomString() (string, error) {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// addOIDCRoutes adds the routes to start an OIDC login, and handle the
+// callback from the provider.
+func addOIDCRoutes(r *gin.Engine, um *db.UserManager, opts OIDCOptions) {
+	if opts.UsernameClaim == "" {
+		opts.UsernameClaim = "preferred_username"
+	}
+	if opts.GroupsClaim == "" {
+		opts.GroupsClaim = "groups"
+	}
+	o := &oidcLogin{opts: opts}
+
+	loginError := func(c *gin.Context, status int, err error) {
+		log.Printf("OIDC login failed from %s: %s", c.ClientIP(), err)
+		message := "single sign-on failed, please try again"
+		if errors.Is(err, db.ErrUserExists) {
+			message = "there is already an account with your name, ask an admin to link it to your single sign-on login"
+		}
+		meta := gin.H{"page": "login", "oidc": true, "error": message}
+		c.HTML(status, "_layout.html", meta)
+	}
+
+	r.GET("/login/oidc", func(c *gin.Context) {
+		provider, err := o.init(c.Request.Context())
+		if err != nil {
+			loginError(c, http.StatusBadGateway, err)
+			return
+		}
+		state, err := randomString()
+		if err != nil {
+			loginError(c, http.StatusInternalServerError, err)
+			return
+		}
+		nonce, err := randomString()
+		if err != nil {
+			loginError(c, http.StatusInternalServerError, err)
+			return
+		}
+		verifier := oauth2.GenerateVerifier()
+
+		session := sessions.Default(c)
+		session.Set("oidc_state", state)
+		session.Set("oidc_nonce", nonce)
+		session.Set("oidc_verifier", verifier)
+		err = session.Save()
+		if err != nil {
+			loginError(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		url := o.oauth2Config(provider).AuthCodeURL(state, oauth2.S256ChallengeOption(verifier), oidc.Nonce(nonce))
+		c.Redirect(http.StatusFound, url)
+	})
+
+	r.GET("/login/oidc/callback", func(c *gin.Context) {
+		provider, err := o.init(c.Request.Context())
+		if err != nil {
+			loginError(c, http.StatusBadGateway, err)
+			return
+		}
+
+		session := sessions.Default(c)
+		state, _ := session.Get("oidc_state").(string)
+		nonce, _ := session.Get("oidc_nonce").(string)
+		verifier, _ := session.Get("oidc_verifier").(string)
+		session.Delete("oidc_state")
+		session.Delete("oidc_nonce")
+		session.Delete("oidc_verifier")
+		// saved now, so that a failed login cannot be retried with them
+		err = session.Save()
+		if err != nil {
+			loginError(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		if state == "" || c.Query("state") != state {
+			loginError(c, http.StatusBadRequest, errors.New("state mismatch"))
+			return
+		}
+		if errParam := c.Query("error"); errParam != "" {
+			loginError(c, http.StatusUnauthorized, fmt.Errorf("provider returned %s: %s", errParam, c.Query("error_description")))
+			return
+		}
+
+		token, err := o.oauth2Config(provider).Exchange(c.Request.Context(), c.Query("code"), oauth2.VerifierOption(verifier))
+		if err != nil {
+			loginError(c, http.StatusBadGateway, fmt.Errorf("could not exchange code: %w", err))
+			return
+		}
+		rawIDToken, ok := token.Extra("id_token").(string)
+		if !ok {
+			loginError(c, http.StatusBadGateway, errors.New("no id_token in token response"))
+			return
+		}
+		idToken, err := provider.Verifier(&oidc.Config{ClientID: opts.ClientID}).Verify(c.Request.Context(), rawIDToken)
+		if err != nil {
+			loginError(c, http.StatusUnauthorized, fmt.Errorf("could not verify id_token: %w", err))
+			return
+		}
+		if idToken.Nonce != nonce {
+			loginError(c, http.StatusUnauthorized, errors.New("nonce mismatch"))
+			return
+		}
+
+		claims := map[string]any{}
+		err = idToken.Claims(&claims)
+		if err != nil {
+			loginError(c, http.StatusBadGateway, err)
+			return
+		}
+
+		// users are known by their subject, which the provider never
+		// reassigns, and existing users are only ever linked to it by
+		// an admin
+		user, err := um.LoadUserByOIDC(idToken.Issuer, idToken.Subject)
+		if err == db.ErrUserNotFound {
+			username, nameErr := o.username(claims)
+			if nameErr != nil {
+				loginError(c, http.StatusUnauthorized, nameErr)
+				return
+			}
+			user, err = um.ProvisionOIDCUser(username, idToken.Issuer, idToken.Subject)
+			if errors.Is(err, db.ErrUserExists) {
+				loginError(c, http.StatusForbidden, fmt.Errorf("%w, link it with -link-oidc %s -oidc-subject %s", err, username, idToken.Subject))
+				return
+			}
+		}
+		if err != nil {
+			loginError(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		if opts.AdminGroup != "" {
+			admin := slices.Contains(o.groups(claims), opts.AdminGroup)
+			if admin != user.Admin {
+				user.Admin = admin
+				err = um.SaveUser(&user)
+				if err != nil {
+					loginError(c, http.StatusInternalServerError, err)
+					return
+				}
+				log.Printf("admin rights for %s set to %v from OIDC groups", user.Username, admin)
+			}
+		}
+
+		// a linked account with a second factor still needs it
+		if user.TOTPEnabled {
+			err = startSecondFactor(c, user)
+			if err != nil {
+				loginError(c, http.StatusInternalServerError, err)
+				return
+			}
+			c.Redirect(http.StatusSeeOther, "/login/2fa")
+			return
+		}
+		err = startSession(c, user)
+		if err != nil {
+			loginError(c, http.StatusInternalServerError, err)
+			return
+		}
+		c.Redirect(http.StatusSeeOther, "/")
+	})
+}
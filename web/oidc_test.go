@@ -0,0 +1,338 @@
+package web
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-jose/go-jose/v4"
+	"github.com/pquerna/otp/totp"
+	"github.com/tardisx/linkwallet/db"
+	"github.com/tardisx/linkwallet/entity"
+)
+
+// testIssuer is a minimal stand-in OpenID Connect provider. Every request
+// to the authorization endpoint is immediately approved for the user
+// described by claims.
+type testIssuer struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+	claims map[string]any
+
+	mu    sync.Mutex
+	codes map[string]issuedCode
+}
+
+type issuedCode struct {
+	challenge string
+	nonce     string
+}
+
+func newTestIssuer(t *testing.T, claims map[string]any) *testIssuer {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ti := &testIssuer{key: key, claims: claims, codes: map[string]issuedCode{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{
+			"issuer":                                ti.server.URL,
+			"authorization_endpoint":                ti.server.URL + "/authorize",
+			"token_endpoint":                        ti.server.URL + "/token",
+			"jwks_uri":                              ti.server.URL + "/jwks",
+			"response_types_supported":              []string{"code"},
+			"subject_types_supported":               []string{"public"},
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+			"code_challenge_methods_supported":      []string{"S256"},
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(jose.JSONWebKeySet{Keys: []jose.JSONWebKey{
+			{Key: &key.PublicKey, KeyID: "test", Algorithm: "RS256", Use: "sig"},
+		}})
+	})
+	mux.HandleFunc("/authorize", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") == "" {
+			http.Error(w, "PKCE required", http.StatusBadRequest)
+			return
+		}
+		code, _ := randomString()
+		ti.mu.Lock()
+		ti.codes[code] = issuedCode{challenge: q.Get("code_challenge"), nonce: q.Get("nonce")}
+		ti.mu.Unlock()
+
+		redirect, _ := url.Parse(q.Get("redirect_uri"))
+		rq := redirect.Query()
+		rq.Set("code", code)
+		rq.Set("state", q.Get("state"))
+		redirect.RawQuery = rq.Encode()
+		http.Redirect(w, r, redirect.String(), http.StatusFound)
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		ti.mu.Lock()
+		issued, ok := ti.codes[r.Form.Get("code")]
+		delete(ti.codes, r.Form.Get("code"))
+		ti.mu.Unlock()
+
+		sum := sha256.Sum256([]byte(r.Form.Get("code_verifier")))
+		if !ok || base64.RawURLEncoding.EncodeToString(sum[:]) != issued.challenge {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":"invalid_grant"}`))
+			return
+		}
+
+		claims := map[string]any{
+			"iss":   ti.server.URL,
+			"aud":   "linkwallet",
+			"exp":   time.Now().Add(time.Hour).Unix(),
+			"iat":   time.Now().Unix(),
+			"nonce": issued.nonce,
+		}
+		for k, v := range ti.claims {
+			claims[k] = v
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"access_token": "access",
+			"token_type":   "Bearer",
+			"expires_in":   3600,
+			"id_token":     ti.sign(t, claims),
+		})
+	})
+	ti.server = httptest.NewServer(mux)
+	t.Cleanup(ti.server.Close)
+	return ti
+}
+
+func (ti *testIssuer) sign(t *testing.T, claims map[string]any) string {
+	signer, err := jose.NewSigner(
+		jose.SigningKey{Algorithm: jose.RS256, Key: ti.key},
+		(&jose.SignerOptions{}).WithType("JWT").WithHeader("kid", "test"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, _ := json.Marshal(claims)
+	jws, err := signer.Sign(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := jws.CompactSerialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+// newOIDCTestServer starts linkwallet configured to use the issuer.
+func newOIDCTestServer(t *testing.T, issuer *testIssuer) (*httptest.Server, *db.UserManager) {
+	gin.SetMode(gin.TestMode)
+	dbh := newTestDB(t)
+	um := db.NewUserManager(dbh)
+
+	// the redirect URL needs the server address, so the handler is set
+	// after the server has started
+	var handler http.Handler
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(ts.Close)
+
+	server := Create(db.NewBookmarkManager(dbh), db.NewConfigManager(dbh), um, db.NewShareManager(dbh), db.NewSavedSearchManager(dbh), Options{
+		OIDC: &OIDCOptions{
+			Issuer:      issuer.server.URL,
+			ClientID:    "linkwallet",
+			RedirectURL: ts.URL + "/login/oidc/callback",
+			AdminGroup:  "linkwallet-admins",
+		},
+	})
+	handler = server.engine
+	return ts, um
+}
+
+func newCookieClient() *http.Client {
+	jar, _ := cookiejar.New(nil)
+	return &http.Client{Jar: jar}
+}
+
+func TestOIDCLogin(t *testing.T) {
+	issuer := newTestIssuer(t, map[string]any{
+		"sub":                "1234",
+		"preferred_username": "alice",
+		"groups":             []string{"staff", "linkwallet-admins"},
+	})
+	ts, um := newOIDCTestServer(t, issuer)
+
+	client := newCookieClient()
+	res, err := client.Get(ts.URL + "/login/oidc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(res.Body)
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("login did not succeed, got %d: %s", res.StatusCode, body)
+	}
+	if res.Request.URL.Path != "/" {
+		t.Errorf("expected to end up at /, got %s", res.Request.URL.Path)
+	}
+	if !strings.Contains(string(body), "Logout alice") {
+		t.Error("not logged in as alice")
+	}
+
+	alice, err := um.LoadUserByUsername("alice")
+	if err != nil {
+		t.Fatalf("alice was not provisioned: %s", err)
+	}
+	if !alice.Admin {
+		t.Error("alice should be an admin from her group membership")
+	}
+
+	// losing the group on the next login removes admin rights
+	issuer.claims["groups"] = []string{"staff"}
+	client = newCookieClient()
+	res, err = client.Get(ts.URL + "/login/oidc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	alice, _ = um.LoadUserByUsername("alice")
+	if alice.Admin {
+		t.Error("alice should no longer be an admin")
+	}
+}
+
+func TestOIDCCallbackRejectsBadState(t *testing.T) {
+	issuer := newTestIssuer(t, map[string]any{"sub": "1234"})
+	ts, um := newOIDCTestServer(t, issuer)
+
+	// start a login, but do not follow the redirect to the provider
+	client := newCookieClient()
+	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+	res, err := client.Get(ts.URL + "/login/oidc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusFound {
+		t.Fatalf("expected redirect to provider, got %d", res.StatusCode)
+	}
+	authorize := res.Header.Get("Location")
+
+	res, err = client.Get(ts.URL + "/login/oidc/callback?code=stolen&state=forged")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected bad request for forged state, got %d", res.StatusCode)
+	}
+
+	// the state was used up by the failed callback, so the real one is
+	// no good afterwards either
+	res, err = client.Get(authorize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	res, err = client.Get(res.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected bad request for a used state, got %d", res.StatusCode)
+	}
+
+	has, _ := um.HasUsers()
+	if has {
+		t.Error("no user should have been created")
+	}
+}
+
+// loginWithOIDC logs in with a new client, following the redirects.
+func loginWithOIDC(t *testing.T, ts *httptest.Server) (*http.Response, string) {
+	t.Helper()
+	res, err := newCookieClient().Get(ts.URL + "/login/oidc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(res.Body)
+	res.Body.Close()
+	return res, string(body)
+}
+
+func TestOIDCDoesNotTakeOverAccounts(t *testing.T) {
+	issuer := newTestIssuer(t, map[string]any{
+		"sub":                "1234",
+		"preferred_username": "admin",
+		"email":              "bob@example.com",
+	})
+	ts, um := newOIDCTestServer(t, issuer)
+
+	admin := entity.User{Username: "admin"}
+	err := um.AddUser(&admin, "secretpw1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, body := loginWithOIDC(t, ts)
+	if res.StatusCode != http.StatusForbidden || strings.Contains(body, "Logout") {
+		t.Fatalf("expected login to be refused, got %d", res.StatusCode)
+	}
+	users, _ := um.AllUsers()
+	if len(users) != 1 {
+		t.Errorf("expected no new user, got %d users", len(users))
+	}
+
+	// an unverified email is not used as the name either
+	issuer.claims["preferred_username"] = ""
+	res, body = loginWithOIDC(t, ts)
+	if res.StatusCode != http.StatusOK || !strings.Contains(body, "Logout 1234") {
+		t.Fatalf("expected to be logged in as 1234, got %d", res.StatusCode)
+	}
+
+	// once linked by an admin, the login is to the existing account, and
+	// still needs its second factor
+	err = um.LinkOIDC(admin.ID, issuer.server.URL, "5678")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = um.LinkOIDC(admin.ID, issuer.server.URL, "1234"); err == nil {
+		t.Error("linked an identity which is already someone else's")
+	}
+	admin, _ = um.BeginTOTPEnrollment(admin.ID)
+	code, _ := totp.GenerateCode(admin.TOTPSecret, time.Now())
+	_, err = um.ConfirmTOTPEnrollment(admin.ID, code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuer.claims["sub"] = "5678"
+	issuer.claims["preferred_username"] = "someone-else"
+	res, body = loginWithOIDC(t, ts)
+	if res.Request.URL.Path != "/login/2fa" || strings.Contains(body, "Logout") {
+		t.Errorf("expected to be asked for the second factor, ended up at %s", res.Request.URL.Path)
+	}
+	if _, err := um.LoadUserByUsername("someone-else"); err != db.ErrUserNotFound {
+		t.Error("a linked login should not provision a user")
+	}
+}
@@ -0,0 +1,96 @@
+package web
+
+import (
+	"encoding/xml"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tardisx/linkwallet/db"
+	"github.com/tardisx/linkwallet/entity"
+)
+
+// openSearchDescription is an OpenSearch 1.1 description document, which
+// lets browsers add linkwallet as a search engine.
+type openSearchDescription struct {
+	XMLName       xml.Name        `xml:"http://a9.com/-/spec/opensearch/1.1/ OpenSearchDescription"`
+	ShortName     string          `xml:"ShortName"`
+	Description   string          `xml:"Description"`
+	InputEncoding string          `xml:"InputEncoding"`
+	URLs          []openSearchURL `xml:"Url"`
+}
+
+type openSearchURL struct {
+	Type     string `xml:"type,attr"`
+	Rel      string `xml:"rel,attr,omitempty"`
+	Template string `xml:"template,attr"`
+}
+
+// baseURL returns the configured BaseURL, or else the address the request
+// was made to, so that there is always an absolute URL to give browsers.
+func baseURL(c *gin.Context, config entity.Config) string {
+	if config.BaseURL != "" {
+		return config.BaseURL
+	}
+	scheme := "http"
+	if c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + c.Request.Host
+}
+
+// addOpenSearchRoutes adds the OpenSearch description of the search page,
+// and the suggestions browsers show as the query is typed.
+func addOpenSearchRoutes(r *gin.Engine, bmm *db.BookmarkManager, cmm *db.ConfigManager) {
+
+	// the addresses in it must be absolute
+	r.GET("/opensearch.xml", func(c *gin.Context) {
+		config, ok := loadConfig(c, cmm)
+		if !ok {
+			return
+		}
+		base := baseURL(c, config)
+		desc := openSearchDescription{
+			ShortName:     "linkwallet",
+			Description:   "Search your linkwallet bookmarks",
+			InputEncoding: "UTF-8",
+			URLs: []openSearchURL{
+				{Type: "text/html", Template: base + "/search?q={searchTerms}"},
+				{Type: "application/x-suggestions+json", Template: base + "/search/opensearch?q={searchTerms}"},
+				{Type: "application/opensearchdescription+xml", Rel: "self", Template: base + "/opensearch.xml"},
+			},
+		}
+		out, err := xml.MarshalIndent(desc, "", "  ")
+		if err != nil {
+			c.String(http.StatusInternalServerError, err.Error())
+			return
+		}
+		c.Data(http.StatusOK, "application/opensearchdescription+xml", append([]byte(xml.Header), out...))
+	})
+
+	// suggestions are the titles of the bookmarks the query finds, as
+	// [query, [titles], [URLs], [URLs]]
+	r.GET("/search/opensearch", func(c *gin.Context) {
+		query := c.Query("q")
+		titles, urls := []string{}, []string{}
+		if query == "" {
+			c.JSON(http.StatusOK, []interface{}{query, titles, urls, urls})
+			return
+		}
+		config, ok := loadConfig(c, cmm)
+		if !ok {
+			return
+		}
+		sr, err := bmm.Search(db.SearchOptions{Owner: currentUser(c).ID, Query: query, Results: suggestSize,
+			Fuzziness: config.FuzzyDistance, Boosts: config.Boosts, Untracked: true})
+		if err != nil {
+			// a query typed part way, such as one with an open quote
+			c.JSON(http.StatusOK, []interface{}{query, titles, urls, urls})
+			return
+		}
+		for _, hit := range sr.Hits {
+			titles = append(titles, hit.Bookmark.DisplayTitle())
+			urls = append(urls, hit.Bookmark.URL)
+		}
+		c.JSON(http.StatusOK, []interface{}{query, titles, urls, urls})
+	})
+}
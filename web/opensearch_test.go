@@ -0,0 +1,124 @@
+package web
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tardisx/linkwallet/db"
+	"github.com/tardisx/linkwallet/entity"
+)
+
+func TestOpenSearch(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	dbh := newTestDB(t)
+	bmm := db.NewBookmarkManager(dbh)
+	cmm := db.NewConfigManager(dbh)
+	ts := httptest.NewServer(Create(bmm, cmm, db.NewUserManager(dbh), db.NewShareManager(dbh), db.NewSavedSearchManager(dbh), Options{}).engine)
+	t.Cleanup(ts.Close)
+
+	get := func(client *http.Client, path string) (*http.Response, string) {
+		res, err := client.Get(ts.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(res.Body)
+		res.Body.Close()
+		return res, string(body)
+	}
+
+	// the first login creates the admin user
+	client := newCookieClient()
+	res, err := client.PostForm(ts.URL+"/login", url.Values{"username": {"admin"}, "password": {"correct horse battery"}, "confirm": {"correct horse battery"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(res.Body)
+	res.Body.Close()
+	if !strings.Contains(string(body), `<link rel="search" type="application/opensearchdescription+xml"`) {
+		t.Errorf("no OpenSearch link on the home page")
+	}
+
+	// without a BaseURL, the addresses are still absolute
+	config, _ := cmm.LoadConfig(1)
+	config.BaseURL = ""
+	err = cmm.SaveConfig(1, &config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, page := get(client, "/opensearch.xml")
+	if !strings.Contains(page, `template="`+ts.URL+`/search?q={searchTerms}"`) {
+		t.Errorf("expected templates at %s, got %s", ts.URL, page)
+	}
+
+	config.BaseURL = "https://links.example.com"
+	err = cmm.SaveConfig(1, &config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, bm := range []entity.Bookmark{
+		{URL: "https://example.com/operator", Owner: 1, Info: entity.PageInfo{Title: "Writing an operator"}},
+		{URL: "https://example.com/helm", Owner: 1, Info: entity.PageInfo{Title: "Helm charts"}},
+	} {
+		err := bmm.AddBookmark(&bm)
+		if err != nil {
+			t.Fatal(err)
+		}
+		bmm.UpdateIndexForBookmark(&bm)
+	}
+
+	res, page = get(client, "/opensearch.xml")
+	if res.Header.Get("Content-Type") != "application/opensearchdescription+xml" {
+		t.Errorf("wrong content type %q", res.Header.Get("Content-Type"))
+	}
+	desc := openSearchDescription{}
+	err = xml.Unmarshal([]byte(page), &desc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	templates := map[string]string{}
+	for _, u := range desc.URLs {
+		templates[u.Type] = u.Template
+	}
+	if templates["text/html"] != "https://links.example.com/search?q={searchTerms}" ||
+		templates["application/x-suggestions+json"] != "https://links.example.com/search/opensearch?q={searchTerms}" {
+		t.Errorf("wrong templates %+v", desc.URLs)
+	}
+
+	_, page = get(client, "/search/opensearch?q=operator")
+	suggestions := []interface{}{}
+	err = json.Unmarshal([]byte(page), &suggestions)
+	if err != nil {
+		t.Fatalf("bad suggestions %s: %s", page, err)
+	}
+	if len(suggestions) != 4 || suggestions[0] != "operator" || len(suggestions[1].([]interface{})) != 1 ||
+		suggestions[1].([]interface{})[0] != "Writing an operator" || suggestions[3].([]interface{})[0] != "https://example.com/operator" {
+		t.Errorf("wrong suggestions %s", page)
+	}
+	_, page = get(client, `/search/opensearch?q="unterminated`)
+	if page != `["\"unterminated",[],[],[]]` {
+		t.Errorf("expected no suggestions for a partly typed query, got %s", page)
+	}
+	history, _ := bmm.SearchHistory(1, 10)
+	if len(history.Recent) != 0 {
+		t.Errorf("suggestions recorded as searches %+v", history.Recent)
+	}
+
+	res, page = get(client, "/search?q=helm")
+	if res.StatusCode != http.StatusOK || !strings.Contains(page, "https://example.com/helm") || strings.Contains(page, "https://example.com/operator") {
+		t.Errorf("wrong search results page %d: %s", res.StatusCode, page)
+	}
+
+	// browsers not logged in are sent to log in
+	res, _ = get(newCookieClient(), "/search?q=helm")
+	if res.Request.URL.Path != "/login" {
+		t.Errorf("expected redirect to login, got %s", res.Request.URL.Path)
+	}
+}
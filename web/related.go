@@ -0,0 +1,83 @@
+package web
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tardisx/linkwallet/db"
+	"github.com/tardisx/linkwallet/entity"
+)
+
+// relatedSize is the number of related bookmarks shown, and the default
+// number returned by the API.
+const relatedSize = 10
+
+// maxRelatedSize is the most related bookmarks the API returns.
+const maxRelatedSize = 50
+
+// relatedBookmark is a related bookmark as returned by the API.
+type relatedBookmark struct {
+	ID    uint64   `json:"id"`
+	URL   string   `json:"url"`
+	Title string   `json:"title"`
+	Tags  []string `json:"tags"`
+	Score float64  `json:"score"`
+}
+
+// addRelatedRoutes adds the routes listing bookmarks related to one, for
+// the edit page and as JSON.
+func addRelatedRoutes(r *gin.Engine, bmm *db.BookmarkManager) {
+
+	// related finds the bookmarks related to the user's bookmark given by
+	// the id param, or returns the status to respond with if it cannot.
+	related := func(c *gin.Context, size int) ([]entity.BookmarkSearchResult, int, error) {
+		id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+		if err != nil {
+			return nil, http.StatusBadRequest, errors.New("bad id")
+		}
+		bm, err := bmm.LoadBookmarkForOwner(currentUser(c).ID, id)
+		if err != nil {
+			return nil, http.StatusNotFound, err
+		}
+		results, err := bmm.Related(bm, size)
+		if err != nil {
+			return nil, http.StatusInternalServerError, err
+		}
+		return results, http.StatusOK, nil
+	}
+
+	r.GET("/edit/:id/related", func(c *gin.Context) {
+		results, status, err := related(c, relatedSize)
+		if err != nil {
+			c.String(status, err.Error())
+			return
+		}
+		c.HTML(http.StatusOK, "related.html", gin.H{"related": results})
+	})
+
+	r.GET("/api/bookmarks/:id/related", func(c *gin.Context) {
+		size, err := strconv.Atoi(c.DefaultQuery("size", strconv.Itoa(relatedSize)))
+		if err != nil || size < 1 || size > maxRelatedSize {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "size must be from 1 to " + strconv.Itoa(maxRelatedSize)})
+			return
+		}
+		results, status, err := related(c, size)
+		if err != nil {
+			c.JSON(status, gin.H{"error": err.Error()})
+			return
+		}
+		bookmarks := []relatedBookmark{}
+		for _, r := range results {
+			bookmarks = append(bookmarks, relatedBookmark{
+				ID:    r.Bookmark.ID,
+				URL:   r.Bookmark.URL,
+				Title: r.Bookmark.DisplayTitle(),
+				Tags:  r.Bookmark.Tags,
+				Score: r.Score,
+			})
+		}
+		c.JSON(http.StatusOK, bookmarks)
+	})
+}
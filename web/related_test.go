@@ -0,0 +1,84 @@
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tardisx/linkwallet/db"
+	"github.com/tardisx/linkwallet/entity"
+)
+
+func TestRelatedBookmarks(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	dbh := newTestDB(t)
+	bmm := db.NewBookmarkManager(dbh)
+	ts := httptest.NewServer(Create(bmm, db.NewConfigManager(dbh), db.NewUserManager(dbh), db.NewShareManager(dbh), db.NewSavedSearchManager(dbh), Options{}).engine)
+	t.Cleanup(ts.Close)
+
+	bookmarks := []entity.Bookmark{
+		{URL: "https://example.com/operators", Owner: 1, Tags: []string{"kubernetes"}, Info: entity.PageInfo{Title: "Writing Kubernetes operators"}},
+		{URL: "https://example.com/controllers", Owner: 1, Tags: []string{"kubernetes"}, Info: entity.PageInfo{Title: "Kubernetes controllers"}},
+		{URL: "https://example.com/sourdough", Owner: 1, Tags: []string{"baking"}, Info: entity.PageInfo{Title: "Sourdough starter"}},
+	}
+	for i := range bookmarks {
+		err := bmm.AddBookmark(&bookmarks[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		bmm.UpdateIndexForBookmark(&bookmarks[i])
+	}
+
+	get := func(client *http.Client, path string) (*http.Response, string) {
+		res, err := client.Get(ts.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(res.Body)
+		res.Body.Close()
+		return res, string(body)
+	}
+	apiPath := fmt.Sprintf("/api/bookmarks/%d/related", bookmarks[0].ID)
+
+	// the API does not redirect to the login page
+	res, body := get(newCookieClient(), apiPath)
+	if res.StatusCode != http.StatusUnauthorized || !strings.Contains(body, "not logged in") {
+		t.Errorf("expected a JSON error when not logged in, got %d %s", res.StatusCode, body)
+	}
+
+	client := newCookieClient()
+	_, err := client.PostForm(ts.URL+"/login", url.Values{"username": {"admin"}, "password": {"correct horse battery"}, "confirm": {"correct horse battery"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, body = get(client, apiPath)
+	related := []relatedBookmark{}
+	err = json.Unmarshal([]byte(body), &related)
+	if res.StatusCode != http.StatusOK || err != nil {
+		t.Fatalf("bad response %d %s", res.StatusCode, body)
+	}
+	if len(related) != 1 || related[0].URL != "https://example.com/controllers" || related[0].Tags[0] != "kubernetes" {
+		t.Errorf("expected the other kubernetes bookmark, got %+v", related)
+	}
+
+	res, body = get(client, apiPath+"?size=500")
+	if res.StatusCode != http.StatusBadRequest || !strings.Contains(body, `"error"`) {
+		t.Errorf("expected a bad request for a huge size, got %d %s", res.StatusCode, body)
+	}
+	res, _ = get(client, "/api/bookmarks/999/related")
+	if res.StatusCode != http.StatusNotFound {
+		t.Errorf("expected not found, got %d", res.StatusCode)
+	}
+
+	_, body = get(client, fmt.Sprintf("/edit/%d/related", bookmarks[0].ID))
+	if !strings.Contains(body, "Kubernetes controllers") || strings.Contains(body, "Sourdough") {
+		t.Errorf("wrong related bookmarks on the edit page: %s", body)
+	}
+}
@@ -0,0 +1,251 @@
+package web
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tardisx/linkwallet/db"
+	"github.com/tardisx/linkwallet/entity"
+)
+
+// savedSearchRow is a saved search with the number of bookmarks it
+// currently finds, and the address of the manage view showing them.
+type savedSearchRow struct {
+	Search entity.SavedSearch
+	Count  uint64
+	Error  error
+	URL    string
+}
+
+// sortOption is a choice of sort for a saved search.
+type sortOption struct {
+	Value string
+	Label string
+}
+
+var savedSortOptions = []sortOption{
+	{"-created", "newest first"},
+	{"created", "oldest first"},
+	{"title", "title, A to Z"},
+	{"-title", "title, Z to A"},
+	{"-scraped", "most recently scraped"},
+	{"scraped", "least recently scraped"},
+	{"-status", "HTTP status, highest first"},
+	{"-size", "largest first"},
+	{"size", "smallest first"},
+}
+
+// savedView returns the manage view for a saved search.
+func savedView(ss entity.SavedSearch) manageView {
+	v := manageView{Query: ss.Query, Tags: ss.Tags, Domain: ss.Domain, Period: ss.Period, Sort: ss.Sort, Page: 1}
+	if _, ok := db.SortFields[strings.TrimPrefix(v.Sort, "-")]; !ok {
+		v.Sort = db.DefaultSort
+	}
+	return v
+}
+
+// savedSearchRows counts the bookmarks each saved search finds.
+func savedSearchRows(bmm *db.BookmarkManager, searches []entity.SavedSearch) []savedSearchRow {
+	rows := []savedSearchRow{}
+	for _, ss := range searches {
+		count, err := bmm.Count(db.SavedSearchOptions(ss))
+		rows = append(rows, savedSearchRow{Search: ss, Count: count, Error: err, URL: savedView(ss).URL()})
+	}
+	return rows
+}
+
+// savedSearchFromForm reads the fields of a saved search from the request,
+// named as in the manage view.
+func savedSearchFromForm(c *gin.Context, ss *entity.SavedSearch) {
+	v := parseManageView(c.PostForm)
+	ss.Name = c.PostForm("name")
+	ss.Query = v.Query
+	ss.Tags = v.Tags
+	ss.Domain = strings.TrimSpace(v.Domain)
+	ss.Period = strings.TrimSpace(v.Period)
+	ss.Sort = v.Sort
+	ss.FeedPrivate = c.PostForm("feed_private") != ""
+}
+
+// addSavedSearchRoutes adds the routes to save, edit and run searches, and
+// the public feeds of them.
+func addSavedSearchRoutes(r *gin.Engine, bmm *db.BookmarkManager, cmm *db.ConfigManager, ssm *db.SavedSearchManager) {
+
+	// savedList renders the user's saved searches, with an optional error
+	// from the action just taken.
+	savedList := func(c *gin.Context, err error) {
+		config, ok := loadConfig(c, cmm)
+		if !ok {
+			return
+		}
+		searches, loadErr := ssm.SavedSearches(currentUser(c).ID)
+		if loadErr != nil {
+			c.String(http.StatusInternalServerError, loadErr.Error())
+			return
+		}
+		meta := gin.H{"config": config, "searches": savedSearchRows(bmm, searches), "error": err}
+		c.HTML(http.StatusOK, "saved_list.html", meta)
+	}
+
+	// loadSaved loads the user's saved search given by the id param.
+	loadSaved := func(c *gin.Context) (entity.SavedSearch, bool) {
+		id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+		if err != nil {
+			c.String(http.StatusBadRequest, "bad id")
+			return entity.SavedSearch{}, false
+		}
+		ss, err := ssm.LoadSavedSearch(currentUser(c).ID, id)
+		if err == db.ErrSavedSearchNotFound {
+			c.String(http.StatusNotFound, err.Error())
+			return ss, false
+		} else if err != nil {
+			c.String(http.StatusInternalServerError, err.Error())
+			return ss, false
+		}
+		return ss, true
+	}
+
+	r.GET("/saved", func(c *gin.Context) {
+		config, ok := loadConfig(c, cmm)
+		if !ok {
+			return
+		}
+		user := currentUser(c)
+		searches, err := ssm.SavedSearches(user.ID)
+		if err != nil {
+			c.String(http.StatusInternalServerError, err.Error())
+			return
+		}
+		meta := gin.H{"page": "saved", "config": config, "user": user, "csrf_token": csrfToken(c), "searches": savedSearchRows(bmm, searches)}
+		c.HTML(http.StatusOK, "_layout.html", meta)
+	})
+
+	// save the current manage view
+	r.POST("/saved", func(c *gin.Context) {
+		ss := entity.SavedSearch{Owner: currentUser(c).ID}
+		savedSearchFromForm(c, &ss)
+		err := ssm.AddSavedSearch(&ss)
+		c.HTML(http.StatusOK, "saved_status.html", gin.H{"search": ss, "error": err})
+	})
+
+	r.GET("/saved/:id", func(c *gin.Context) {
+		ss, ok := loadSaved(c)
+		if !ok {
+			return
+		}
+		config, ok := loadConfig(c, cmm)
+		if !ok {
+			return
+		}
+		meta := gin.H{"page": "saved_edit", "config": config, "user": currentUser(c), "csrf_token": csrfToken(c),
+			"search": ss, "sorts": savedSortOptions}
+		c.HTML(http.StatusOK, "_layout.html", meta)
+	})
+
+	r.POST("/saved/:id", func(c *gin.Context) {
+		ss, ok := loadSaved(c)
+		if !ok {
+			return
+		}
+		config, ok := loadConfig(c, cmm)
+		if !ok {
+			return
+		}
+		savedSearchFromForm(c, &ss)
+		err := ssm.UpdateSavedSearch(&ss)
+		meta := gin.H{"config": config, "search": ss, "sorts": savedSortOptions, "saved": err == nil, "error": err}
+		c.HTML(http.StatusOK, "saved_form.html", meta)
+	})
+
+	// savedFeed changes the feed of the user's saved search given by the
+	// id param, and shows the edit form again.
+	savedFeed := func(c *gin.Context, change func(owner uint64, id uint64) (entity.SavedSearch, error)) {
+		ss, ok := loadSaved(c)
+		if !ok {
+			return
+		}
+		config, ok := loadConfig(c, cmm)
+		if !ok {
+			return
+		}
+		ss, err := change(ss.Owner, ss.ID)
+		meta := gin.H{"config": config, "search": ss, "sorts": savedSortOptions, "error": err}
+		c.HTML(http.StatusOK, "saved_form.html", meta)
+	}
+
+	// a new feed address, so the old one stops working
+	r.POST("/saved/:id/feed", func(c *gin.Context) {
+		savedFeed(c, ssm.RegenerateFeedToken)
+	})
+
+	r.DELETE("/saved/:id/feed", func(c *gin.Context) {
+		savedFeed(c, ssm.DisableFeed)
+	})
+
+	r.DELETE("/saved/:id", func(c *gin.Context) {
+		ss, ok := loadSaved(c)
+		if !ok {
+			return
+		}
+		err := ssm.DeleteSavedSearch(ss.Owner, ss.ID)
+		savedList(c, err)
+	})
+
+	// the URLs found by the search, in its sort order
+	r.GET("/saved/:id/export", func(c *gin.Context) {
+		ss, ok := loadSaved(c)
+		if !ok {
+			return
+		}
+		bookmarks, err := bmm.MatchingBookmarks(db.SavedSearchOptions(ss))
+		if err != nil {
+			c.String(http.StatusInternalServerError, err.Error())
+			return
+		}
+		c.Writer.Header().Set("Content-Type", "text/plain")
+		c.Writer.Header().Set("Content-Disposition", "attachment; filename=\"bookmarks.txt\"")
+		for _, bm := range bookmarks {
+			_, err = c.Writer.Write([]byte(bm.URL + "\n"))
+			if err != nil {
+				log.Printf("got error when exporting: %s", err)
+				return
+			}
+		}
+	})
+
+	r.GET("/feed/:token", func(c *gin.Context) {
+		ss, err := ssm.LoadSavedSearchByFeedToken(c.Param("token"))
+		if err == db.ErrSavedSearchNotFound {
+			c.String(http.StatusNotFound, "this feed does not exist")
+			return
+		} else if err != nil {
+			c.String(http.StatusInternalServerError, err.Error())
+			return
+		}
+		config, err := cmm.LoadConfig(ss.Owner)
+		if err != nil {
+			c.String(http.StatusInternalServerError, err.Error())
+			return
+		}
+		opts := db.SavedSearchOptions(ss)
+		opts.Results = feedSize
+		opts.PublicOnly = !ss.FeedPrivate
+		opts.PublicTags = config.PublicTags
+		bookmarks, err := bmm.MatchingBookmarks(opts)
+		if err != nil {
+			c.String(http.StatusInternalServerError, err.Error())
+			return
+		}
+		// the newest need not be first, in the search's own order
+		updated := ss.Created
+		for _, bm := range bookmarks {
+			if bm.TimestampCreated.After(updated) {
+				updated = bm.TimestampCreated
+			}
+		}
+		renderFeed(c, ss.Name, config.BaseURL+"/feed/"+ss.FeedToken, updated, bookmarks)
+	})
+}
@@ -0,0 +1,149 @@
+package web
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tardisx/linkwallet/db"
+	"github.com/tardisx/linkwallet/entity"
+)
+
+func TestSavedSearches(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	dbh := newTestDB(t)
+	bmm := db.NewBookmarkManager(dbh)
+	ssm := db.NewSavedSearchManager(dbh)
+	ts := httptest.NewServer(Create(bmm, db.NewConfigManager(dbh), db.NewUserManager(dbh), db.NewShareManager(dbh), ssm, Options{}).engine)
+	t.Cleanup(ts.Close)
+
+	// the first login creates the admin user
+	client := newCookieClient()
+	res, err := client.PostForm(ts.URL+"/login", url.Values{"username": {"admin"}, "password": {"correct horse battery"}, "confirm": {"correct horse battery"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(res.Body)
+	res.Body.Close()
+	m := regexp.MustCompile(`"X-CSRF-Token": "([^"]+)"`).FindSubmatch(body)
+	if m == nil {
+		t.Fatalf("no CSRF token in page at %s", res.Request.URL.Path)
+	}
+	token := string(m[1])
+
+	for _, bm := range []entity.Bookmark{
+		{URL: "https://example.com/operator", Owner: 1, Tags: []string{"kubernetes"}, Public: true, Info: entity.PageInfo{Title: "Writing an operator"}},
+		{URL: "https://example.com/operator-secrets", Owner: 1, Tags: []string{"kubernetes"}, Info: entity.PageInfo{Title: "Operator secrets"}},
+		{URL: "https://example.com/helm", Owner: 1, Tags: []string{"kubernetes"}, Public: true, Info: entity.PageInfo{Title: "Helm charts"}},
+	} {
+		err := bmm.AddBookmark(&bm)
+		if err != nil {
+			t.Fatal(err)
+		}
+		bmm.UpdateIndexForBookmark(&bm)
+	}
+
+	get := func(client *http.Client, path string) (*http.Response, string) {
+		res, err := client.Get(ts.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(res.Body)
+		res.Body.Close()
+		return res, string(body)
+	}
+
+	// save the view from the manage page
+	form := url.Values{"name": {"Operators"}, "query": {"operator"}, "filter_tags": {"kubernetes"}, "sort": {"title"}}
+	req, _ := http.NewRequest(http.MethodPost, ts.URL+"/saved", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set(csrfHeader, token)
+	res, err = client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ = io.ReadAll(res.Body)
+	res.Body.Close()
+	if !strings.Contains(string(body), "Saved as") {
+		t.Fatalf("search not saved: %s", body)
+	}
+	searches, _ := ssm.SavedSearches(1)
+	if len(searches) != 1 || searches[0].Query != "operator" || searches[0].Sort != "title" || searches[0].Tags[0] != "kubernetes" {
+		t.Fatalf("wrong saved search %+v", searches)
+	}
+	ss := searches[0]
+
+	_, page := get(client, "/")
+	if !strings.Contains(page, `href="/manage?filter_tags=kubernetes&amp;query=operator&amp;sort=title">Operators</a> (2)`) {
+		t.Errorf("saved search with count missing from front page")
+	}
+
+	_, export := get(client, "/saved/"+fmt.Sprint(ss.ID)+"/export")
+	if export != "https://example.com/operator-secrets\nhttps://example.com/operator\n" {
+		t.Errorf("wrong export %q", export)
+	}
+
+	// feeds need no login, exports do, and feeds only have the public
+	// bookmarks unless asked for the others
+	anon := newCookieClient()
+	res, feed := get(anon, "/feed/"+ss.FeedToken)
+	if res.StatusCode != http.StatusOK || !strings.Contains(feed, `"https://example.com/operator"`) ||
+		strings.Contains(feed, "https://example.com/operator-secrets") || strings.Contains(feed, "https://example.com/helm") {
+		t.Errorf("wrong feed %d %s", res.StatusCode, feed)
+	}
+	res, _ = get(anon, "/saved/"+fmt.Sprint(ss.ID)+"/export")
+	if res.Request.URL.Path != "/login" {
+		t.Errorf("expected export to need a login, ended up at %s", res.Request.URL.Path)
+	}
+	res, _ = get(anon, "/feed/guessed")
+	if res.StatusCode != http.StatusNotFound {
+		t.Errorf("expected 404 for unknown feed, got %d", res.StatusCode)
+	}
+
+	send := func(method string, path string, form url.Values) string {
+		req, _ := http.NewRequest(method, ts.URL+path, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set(csrfHeader, token)
+		res, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(res.Body)
+		res.Body.Close()
+		return string(body)
+	}
+	form.Set("feed_private", "on")
+	send(http.MethodPost, "/saved/"+fmt.Sprint(ss.ID), form)
+	_, feed = get(anon, "/feed/"+ss.FeedToken)
+	if !strings.Contains(feed, "https://example.com/operator-secrets") {
+		t.Errorf("expected the private bookmark in the feed once asked for, got %s", feed)
+	}
+
+	// a new address replaces the old one
+	send(http.MethodPost, "/saved/"+fmt.Sprint(ss.ID)+"/feed", nil)
+	renewed, _ := ssm.LoadSavedSearch(1, ss.ID)
+	if renewed.FeedToken == "" || renewed.FeedToken == ss.FeedToken {
+		t.Fatalf("expected a new feed token, got %q", renewed.FeedToken)
+	}
+	if res, _ := get(anon, "/feed/"+ss.FeedToken); res.StatusCode != http.StatusNotFound {
+		t.Errorf("expected the old feed address to stop working, got %d", res.StatusCode)
+	}
+	if res, _ := get(anon, "/feed/"+renewed.FeedToken); res.StatusCode != http.StatusOK {
+		t.Errorf("expected the new feed address to work, got %d", res.StatusCode)
+	}
+
+	// and turning it off stops it altogether
+	page = send(http.MethodDelete, "/saved/"+fmt.Sprint(ss.ID)+"/feed", nil)
+	if !strings.Contains(page, "turn on") {
+		t.Errorf("expected the feed to be shown as off: %s", page)
+	}
+	if res, _ := get(anon, "/feed/"+renewed.FeedToken); res.StatusCode != http.StatusNotFound {
+		t.Errorf("expected the turned off feed to be gone, got %d", res.StatusCode)
+	}
+}
@@ -0,0 +1,94 @@
+package web
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tardisx/linkwallet/db"
+	"github.com/tardisx/linkwallet/entity"
+)
+
+// searchPageSize is the number of results shown at a time by the search
+// box.
+const searchPageSize = 20
+
+// searchForm is a search from the search box, with the filters chosen from
+// its facets. From is the number of results already shown.
+type searchForm struct {
+	Query    string
+	Tags     []string
+	Domain   string
+	Period   string
+	Language string
+	From     int
+}
+
+// parseSearchForm reads a search from the fields of the search box form.
+func parseSearchForm(c *gin.Context) searchForm {
+	from, _ := strconv.Atoi(c.PostForm("from"))
+	return searchForm{
+		Query:    c.PostForm("query"),
+		Tags:     parseTagFilter(c.PostForm("filter_tags")),
+		Domain:   c.PostForm("filter_domain"),
+		Period:   c.PostForm("filter_period"),
+		Language: c.PostForm("filter_language"),
+		From:     max(from, 0),
+	}
+}
+
+// empty reports whether there is nothing to search for.
+func (f searchForm) empty() bool {
+	return f.Query == "" && len(f.Tags) == 0 && f.Domain == "" && f.Period == "" && f.Language == ""
+}
+
+// more returns the fields to post for the results after the first from,
+// as JSON for hx-vals. They are those of the search as it was run, not as
+// the search box now is.
+func (f searchForm) more(from int) string {
+	vals, _ := json.Marshal(map[string]string{
+		"query":           f.Query,
+		"filter_tags":     strings.Join(f.Tags, "|"),
+		"filter_domain":   f.Domain,
+		"filter_period":   f.Period,
+		"filter_language": f.Language,
+		"from":            strconv.Itoa(from),
+	})
+	return string(vals)
+}
+
+// searchResults runs a search from the search box and returns what
+// search_results.html shows of it, or search_hits.html of a later page.
+//
+// Results with the same score are ordered by ID, so that they stay in the
+// same order from one page to the next.
+func searchResults(bmm *db.BookmarkManager, config entity.Config, owner uint64, form searchForm) gin.H {
+	// filtering alone shows everything which matches the filters
+	sr, err := bmm.Search(db.SearchOptions{Owner: owner, Query: form.Query, All: form.Query == "", Tags: form.Tags,
+		Domain: form.Domain, Period: form.Period, Language: form.Language, Results: searchPageSize, From: form.From,
+		Sort: []string{"-_score", "_id"}, Fuzziness: config.FuzzyDistance, Boosts: config.Boosts,
+		// only the first page is a new search
+		Untracked: form.From > 0})
+	data := gin.H{
+		"results":      sr.Hits,
+		"total":        sr.Total,
+		"error":        err,
+		"fuzzy":        sr.Fuzzy,
+		"did_you_mean": sr.DidYouMean,
+		"skipped":      sr.Skipped,
+		"facets": []facetGroup{
+			newTagFacets("search-query", "search-filter-tags", form.Tags, sr),
+			newDomainFacets("search-query", "search-filter-domain", form.Domain, sr),
+			newLanguageFacets("search-query", "search-filter-language", form.Language, sr),
+		},
+		"timeline": newTimeline("search-query", "search-filter-period", form.Period, sr),
+	}
+	// skipped hits are counted, or the next page would start with some of
+	// this one again
+	if next := form.From + len(sr.Hits) + sr.Skipped; err == nil && uint64(next) < sr.Total {
+		data["more"] = form.more(next)
+		data["remaining"] = sr.Total - uint64(next)
+	}
+	return data
+}
@@ -0,0 +1,128 @@
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tardisx/linkwallet/db"
+	"github.com/tardisx/linkwallet/entity"
+)
+
+func TestSearchPaging(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	dbh := newTestDB(t)
+	bmm := db.NewBookmarkManager(dbh)
+	ts := httptest.NewServer(Create(bmm, db.NewConfigManager(dbh), db.NewUserManager(dbh), db.NewShareManager(dbh), db.NewSavedSearchManager(dbh), Options{}).engine)
+	t.Cleanup(ts.Close)
+
+	// the first login creates the admin user
+	client := newCookieClient()
+	res, err := client.PostForm(ts.URL+"/login", url.Values{"username": {"admin"}, "password": {"correct horse battery"}, "confirm": {"correct horse battery"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(res.Body)
+	res.Body.Close()
+	m := regexp.MustCompile(`"X-CSRF-Token": "([^"]+)"`).FindSubmatch(body)
+	if m == nil {
+		t.Fatalf("no CSRF token in page at %s", res.Request.URL.Path)
+	}
+	token := string(m[1])
+
+	// equally good matches, which must not change places between pages
+	for i := 0; i < 45; i++ {
+		bm := entity.Bookmark{URL: fmt.Sprintf("https://example.com/%d", i), Owner: 1, Info: entity.PageInfo{Title: "Kubernetes operators"}}
+		err := bmm.AddBookmark(&bm)
+		if err != nil {
+			t.Fatal(err)
+		}
+		bmm.UpdateIndexForBookmark(&bm)
+	}
+	// and some the index has but the database has lost, which are
+	// skipped without throwing the pages out
+	for i := 0; i < 5; i++ {
+		bm := entity.Bookmark{ID: uint64(1000 + i), URL: fmt.Sprintf("https://example.com/lost/%d", i), Owner: 1, Info: entity.PageInfo{Title: "Kubernetes operators"}}
+		bmm.UpdateIndexForBookmark(&bm)
+	}
+
+	search := func(form url.Values) string {
+		req, _ := http.NewRequest(http.MethodPost, ts.URL+"/search", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set(csrfHeader, token)
+		res, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(res.Body)
+		res.Body.Close()
+		return string(body)
+	}
+	hitRE := regexp.MustCompile(`<a href="(https://example.com/\d+)">`)
+	moreRE := regexp.MustCompile(`hx-vals="([^"]+)"`)
+	skippedRE := regexp.MustCompile(`(\d+) results? (is|are) left out`)
+
+	page := search(url.Values{"query": {"operators"}})
+	if !strings.Contains(page, "50 bookmarks found") {
+		t.Errorf("no total in first page: %s", page)
+	}
+	seen := map[string]bool{}
+	skipped := 0
+	for pages := 1; ; pages++ {
+		hits := hitRE.FindAllStringSubmatch(page, -1)
+		for _, hit := range hits {
+			if seen[hit[1]] {
+				t.Errorf("%s shown twice", hit[1])
+			}
+			seen[hit[1]] = true
+		}
+		pageSkipped := 0
+		if m := skippedRE.FindStringSubmatch(page); m != nil {
+			fmt.Sscan(m[1], &pageSkipped)
+		}
+		skipped += pageSkipped
+		more := moreRE.FindStringSubmatch(page)
+		if more == nil {
+			if pages != 3 || len(hits)+pageSkipped != 10 {
+				t.Errorf("expected 3 pages, the last of 10 hits, got %d of %d", pages, len(hits)+pageSkipped)
+			}
+			break
+		}
+		if len(hits)+pageSkipped != searchPageSize {
+			t.Errorf("expected %d hits on page %d, got %d", searchPageSize, pages, len(hits)+pageSkipped)
+		}
+		if pages > 1 && strings.Contains(page, "bookmarks found") {
+			t.Errorf("later page %d repeats the heading", pages)
+		}
+		// the button posts the search as it was run, from where it got to
+		vals := map[string]string{}
+		err := json.Unmarshal([]byte(html.UnescapeString(more[1])), &vals)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if vals["query"] != "operators" || vals["from"] != fmt.Sprint(len(seen)+skipped) {
+			t.Errorf("wrong values for more results %v", vals)
+		}
+		form := url.Values{}
+		for k, v := range vals {
+			form.Set(k, v)
+		}
+		page = search(form)
+	}
+	if len(seen) != 45 || skipped != 5 {
+		t.Errorf("expected all 45 bookmarks over the pages and 5 skipped, got %d and %d", len(seen), skipped)
+	}
+
+	history, _ := bmm.SearchHistory(1, 10)
+	if len(history.Recent) != 1 {
+		t.Errorf("expected later pages not to be recorded as searches, got %+v", history.Recent)
+	}
+}
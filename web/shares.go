@@ -0,0 +1,166 @@
+package web
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tardisx/linkwallet/db"
+	"github.com/tardisx/linkwallet/entity"
+)
+
+// feedSize is the maximum number of bookmarks in a feed.
+const feedSize = 50
+
+// addShareRoutes adds the routes for users to manage what they share, and
+// the public read only views of the shared bookmarks.
+func addShareRoutes(r *gin.Engine, bmm *db.BookmarkManager, cmm *db.ConfigManager, sm *db.ShareManager) {
+
+	// sharesList renders the user's public tags and share links, with an
+	// optional error from the action just taken.
+	sharesList := func(c *gin.Context, err error) {
+		user := currentUser(c)
+		config, ok := loadConfig(c, cmm)
+		if !ok {
+			return
+		}
+		shares, loadErr := sm.Shares(user.ID)
+		if loadErr != nil {
+			c.String(http.StatusInternalServerError, loadErr.Error())
+			return
+		}
+		meta := gin.H{"config": config, "shares": shares, "error": err}
+		c.HTML(http.StatusOK, "shares_list.html", meta)
+	}
+
+	r.GET("/shares", func(c *gin.Context) {
+		user := currentUser(c)
+		config, ok := loadConfig(c, cmm)
+		if !ok {
+			return
+		}
+		shares, err := sm.Shares(user.ID)
+		if err != nil {
+			c.String(http.StatusInternalServerError, err.Error())
+			return
+		}
+		meta := gin.H{"page": "shares", "config": config, "user": user, "csrf_token": csrfToken(c), "shares": shares}
+		c.HTML(http.StatusOK, "_layout.html", meta)
+	})
+
+	r.POST("/shares", func(c *gin.Context) {
+		_, err := sm.CreateShare(currentUser(c).ID, c.PostForm("tag"))
+		sharesList(c, err)
+	})
+
+	r.DELETE("/shares/:token", func(c *gin.Context) {
+		err := sm.RevokeShare(currentUser(c).ID, c.Param("token"))
+		sharesList(c, err)
+	})
+
+	// add or remove a public tag
+	r.POST("/shares/tags", func(c *gin.Context) {
+		user := currentUser(c)
+		config, ok := loadConfig(c, cmm)
+		if !ok {
+			return
+		}
+		if remove := c.Query("remove"); remove != "" {
+			config.PublicTags = slices.DeleteFunc(config.PublicTags, func(t string) bool { return t == remove })
+		} else if tag := strings.ToLower(strings.TrimSpace(c.PostForm("tag"))); tag != "" && !slices.Contains(config.PublicTags, tag) {
+			config.PublicTags = append(config.PublicTags, tag)
+			slices.Sort(config.PublicTags)
+		}
+		err := cmm.SaveConfig(user.ID, &config)
+		sharesList(c, err)
+	})
+
+	// shared loads the share given by the token param, and the config of
+	// the user who owns it.
+	shared := func(c *gin.Context) (entity.Share, entity.Config, bool) {
+		share, err := sm.LoadShare(c.Param("token"))
+		if err == db.ErrShareNotFound {
+			c.String(http.StatusNotFound, "this link does not exist, or is no longer shared")
+			return share, entity.Config{}, false
+		} else if err != nil {
+			c.String(http.StatusInternalServerError, err.Error())
+			return share, entity.Config{}, false
+		}
+		config, err := cmm.LoadConfig(share.Owner)
+		if err != nil {
+			c.String(http.StatusInternalServerError, err.Error())
+			return share, entity.Config{}, false
+		}
+		return share, config, true
+	}
+
+	shareTitle := func(share entity.Share) string {
+		if share.Tag != "" {
+			return "Bookmarks tagged " + share.Tag
+		}
+		return "Shared bookmarks"
+	}
+
+	r.GET("/share/:token", func(c *gin.Context) {
+		share, config, ok := shared(c)
+		if !ok {
+			return
+		}
+		bookmarks, err := sm.SharedBookmarks(share, config.PublicTags)
+		if err != nil {
+			c.String(http.StatusInternalServerError, err.Error())
+			return
+		}
+		meta := gin.H{"page": "share", "share": share, "title": shareTitle(share), "bookmarks": bookmarks, "feed": "/share/" + share.Token + "/feed"}
+		c.HTML(http.StatusOK, "_layout.html", meta)
+	})
+
+	r.GET("/share/:token/search", func(c *gin.Context) {
+		share, config, ok := shared(c)
+		if !ok {
+			return
+		}
+		var bookmarks []entity.Bookmark
+		var err error
+		if query := strings.TrimSpace(c.Query("query")); query == "" {
+			bookmarks, err = sm.SharedBookmarks(share, config.PublicTags)
+		} else {
+			opts := db.SearchOptions{
+				Owner:      share.Owner,
+				Query:      query,
+				PublicOnly: true,
+				PublicTags: config.PublicTags,
+			}
+			if share.Tag != "" {
+				opts.Tags = []string{share.Tag}
+			}
+			var results db.SearchResults
+			results, err = bmm.Search(opts)
+			for _, res := range results.Hits {
+				bookmarks = append(bookmarks, res.Bookmark)
+			}
+		}
+		c.HTML(http.StatusOK, "share_results.html", gin.H{"bookmarks": bookmarks, "error": err})
+	})
+
+	r.GET("/share/:token/feed", func(c *gin.Context) {
+		share, config, ok := shared(c)
+		if !ok {
+			return
+		}
+		bookmarks, err := sm.SharedBookmarks(share, config.PublicTags)
+		if err != nil {
+			c.String(http.StatusInternalServerError, err.Error())
+			return
+		}
+		if len(bookmarks) > feedSize {
+			bookmarks = bookmarks[:feedSize]
+		}
+		updated := share.Created
+		if len(bookmarks) > 0 && bookmarks[0].TimestampCreated.After(updated) {
+			updated = bookmarks[0].TimestampCreated
+		}
+		renderFeed(c, shareTitle(share), config.BaseURL+"/share/"+share.Token+"/feed", updated, bookmarks)
+	})
+}
@@ -0,0 +1,76 @@
+package web
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tardisx/linkwallet/db"
+	"github.com/tardisx/linkwallet/entity"
+)
+
+func TestPublicShare(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	dbh := newTestDB(t)
+	bmm := db.NewBookmarkManager(dbh)
+	um := db.NewUserManager(dbh)
+	sm := db.NewShareManager(dbh)
+	ts := httptest.NewServer(Create(bmm, db.NewConfigManager(dbh), um, sm, db.NewSavedSearchManager(dbh), Options{}).engine)
+	t.Cleanup(ts.Close)
+
+	alice := entity.User{Username: "alice"}
+	err := um.AddUser(&alice, "correct horse battery")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, bm := range []entity.Bookmark{
+		{URL: "http://example.com/public", Owner: alice.ID, Public: true},
+		{URL: "http://example.com/private", Owner: alice.ID},
+	} {
+		err = bmm.AddBookmark(&bm)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	share, err := sm.CreateShare(alice.ID, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	get := func(path string) (int, string) {
+		res, err := http.Get(ts.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(res.Body)
+		res.Body.Close()
+		return res.StatusCode, string(body)
+	}
+
+	for _, path := range []string{"/share/" + share.Token, "/share/" + share.Token + "/feed"} {
+		status, body := get(path)
+		if status != http.StatusOK {
+			t.Fatalf("%s: expected anonymous access, got %d", path, status)
+		}
+		if !strings.Contains(body, "http://example.com/public") {
+			t.Errorf("%s: public bookmark missing", path)
+		}
+		if strings.Contains(body, "http://example.com/private") {
+			t.Errorf("%s: private bookmark shown", path)
+		}
+	}
+
+	status, _ := get("/share/guessed")
+	if status != http.StatusNotFound {
+		t.Errorf("expected 404 for unknown share, got %d", status)
+	}
+
+	sm.RevokeShare(alice.ID, share.Token)
+	status, _ = get("/share/" + share.Token)
+	if status != http.StatusNotFound {
+		t.Errorf("expected 404 for revoked share, got %d", status)
+	}
+}
@@ -0,0 +1,86 @@
+// Client side search for pages exported by linkwallet's static site
+// export. The index is built by buildStaticIndex in web/static_export.go,
+// words in the query must be split the same way as searchTerms there.
+(function () {
+    var input = document.getElementById('static-search');
+    if (!input) {
+        return;
+    }
+    var list = document.getElementById('static-list');
+    var results = document.getElementById('static-results');
+    var index = null;
+
+    fetch(input.dataset.index)
+        .then(function (res) { return res.json(); })
+        .then(function (i) { index = i; search(); });
+
+    // docsMatching returns the set of documents with a word starting
+    // with term.
+    function docsMatching(term) {
+        var docs = {};
+        Object.keys(index.terms).forEach(function (word) {
+            if (word.indexOf(term) === 0) {
+                index.terms[word].forEach(function (d) { docs[d] = true; });
+            }
+        });
+        return docs;
+    }
+
+    function search() {
+        if (!index) {
+            return;
+        }
+        var terms = input.value.toLowerCase().split(/[^\p{L}\p{N}]+/u).filter(function (t) { return t !== ''; });
+        if (terms.length === 0) {
+            results.hidden = true;
+            list.hidden = false;
+            return;
+        }
+
+        // every term must match
+        var matched = docsMatching(terms[0]);
+        terms.slice(1).forEach(function (term) {
+            var docs = docsMatching(term);
+            Object.keys(matched).forEach(function (d) {
+                if (!docs[d]) {
+                    delete matched[d];
+                }
+            });
+        });
+
+        results.replaceChildren();
+        Object.keys(matched).map(Number).sort(function (a, b) { return a - b; }).forEach(function (d) {
+            var doc = index.docs[d];
+            if (input.dataset.tag && (doc.tags || []).indexOf(input.dataset.tag) === -1) {
+                return;
+            }
+            var li = document.createElement('li');
+            var a = document.createElement('a');
+            a.href = doc.url;
+            a.rel = 'noopener';
+            a.textContent = doc.title;
+            li.appendChild(a);
+            li.appendChild(document.createElement('br'));
+            var small = document.createElement('small');
+            small.textContent = doc.url;
+            li.appendChild(small);
+            (doc.tags || []).forEach(function (tag) {
+                var label = document.createElement('span');
+                label.className = 'label primary';
+                label.textContent = tag;
+                li.appendChild(document.createTextNode(' '));
+                li.appendChild(label);
+            });
+            results.appendChild(li);
+        });
+        if (!results.firstChild) {
+            var none = document.createElement('li');
+            none.textContent = 'no bookmarks';
+            results.appendChild(none);
+        }
+        results.hidden = false;
+        list.hidden = true;
+    }
+
+    input.addEventListener('input', search);
+})();
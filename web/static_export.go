@@ -0,0 +1,218 @@
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/tardisx/linkwallet/entity"
+)
+
+// maxTextTerms is the maximum number of distinct words from the page text
+// of each bookmark that go into the static search index, to keep the index
+// a reasonable size to download.
+const maxTextTerms = 200
+
+// staticTag is a tag with its own page in a static export.
+type staticTag struct {
+	Name  string
+	File  string
+	Count int
+}
+
+// staticIndex is the search index for a static export. Terms maps each
+// word to the positions in Docs of the bookmarks containing it.
+type staticIndex struct {
+	Docs  []staticDoc      `json:"docs"`
+	Terms map[string][]int `json:"terms"`
+}
+
+type staticDoc struct {
+	Title string   `json:"title"`
+	URL   string   `json:"url"`
+	Tags  []string `json:"tags"`
+}
+
+// ExportStatic renders bookmarks into dir as a static site, which can be
+// served by any plain web server. It contains an index page of all the
+// bookmarks, a page for each tag, the search index used by the client side
+// search, and the assets needed to display them. All links are relative,
+// so the site works from any path.
+func ExportStatic(dir string, title string, bookmarks []entity.Bookmark) error {
+	templ := parseTemplates()
+
+	err := os.MkdirAll(filepath.Join(dir, "tags"), 0755)
+	if err != nil {
+		return fmt.Errorf("could not create %s: %w", dir, err)
+	}
+	// remove pages for tags which no longer exist
+	old, err := filepath.Glob(filepath.Join(dir, "tags", "*.html"))
+	if err != nil {
+		return err
+	}
+	for _, f := range old {
+		err = os.Remove(f)
+		if err != nil {
+			return fmt.Errorf("could not remove old tag page: %w", err)
+		}
+	}
+
+	err = copyAssets(filepath.Join(dir, "assets"))
+	if err != nil {
+		return err
+	}
+
+	tags := staticTags(bookmarks)
+
+	render := func(path string, meta map[string]any) error {
+		f, err := os.Create(path)
+		if err != nil {
+			return fmt.Errorf("could not create %s: %w", path, err)
+		}
+		defer f.Close()
+		meta["page"] = "static"
+		meta["static"] = true
+		meta["title"] = title
+		meta["tags"] = tags
+		err = templ.ExecuteTemplate(f, "_layout.html", meta)
+		if err != nil {
+			return fmt.Errorf("could not render %s: %w", path, err)
+		}
+		return f.Close()
+	}
+
+	err = render(filepath.Join(dir, "index.html"), map[string]any{"root": ".", "bookmarks": bookmarks})
+	if err != nil {
+		return err
+	}
+	for _, tag := range tags {
+		tagged := []entity.Bookmark{}
+		for _, bm := range bookmarks {
+			if bm.HasTag(tag.Name) {
+				tagged = append(tagged, bm)
+			}
+		}
+		err = render(filepath.Join(dir, "tags", tag.File), map[string]any{"root": "..", "tag": tag.Name, "bookmarks": tagged})
+		if err != nil {
+			return err
+		}
+	}
+
+	index, err := json.Marshal(buildStaticIndex(bookmarks))
+	if err != nil {
+		return fmt.Errorf("could not create search index: %w", err)
+	}
+	err = os.WriteFile(filepath.Join(dir, "search.json"), index, 0644)
+	if err != nil {
+		return fmt.Errorf("could not write search index: %w", err)
+	}
+	return nil
+}
+
+// copyAssets copies the embedded static assets to dir.
+func copyAssets(dir string) error {
+	return fs.WalkDir(staticFiles, "static", func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		dest := filepath.Join(dir, strings.TrimPrefix(path, "static"))
+		if d.IsDir() {
+			return os.MkdirAll(dest, 0755)
+		}
+		b, err := staticFiles.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		err = os.WriteFile(dest, b, 0644)
+		if err != nil {
+			return fmt.Errorf("could not copy asset: %w", err)
+		}
+		return nil
+	})
+}
+
+// staticTags returns the tags used by the bookmarks, sorted by name, with
+// a unique file name for each.
+func staticTags(bookmarks []entity.Bookmark) []staticTag {
+	counts := map[string]int{}
+	for _, bm := range bookmarks {
+		for _, tag := range bm.Tags {
+			counts[tag]++
+		}
+	}
+	names := []string{}
+	for name := range counts {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	tags := []staticTag{}
+	used := map[string]bool{}
+	for _, name := range names {
+		slug := tagSlug(name)
+		file := slug + ".html"
+		for i := 2; used[file]; i++ {
+			file = fmt.Sprintf("%s-%d.html", slug, i)
+		}
+		used[file] = true
+		tags = append(tags, staticTag{Name: name, File: file, Count: counts[name]})
+	}
+	return tags
+}
+
+// tagSlug converts a tag into something safe to use as a file name on any
+// web server.
+func tagSlug(tag string) string {
+	slug := strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '-'
+	}, strings.ToLower(tag))
+	slug = strings.Trim(slug, "-")
+	if slug == "" {
+		slug = "tag"
+	}
+	return slug
+}
+
+// buildStaticIndex builds the search index for the bookmarks, from their
+// titles, URLs, tags and page text.
+func buildStaticIndex(bookmarks []entity.Bookmark) staticIndex {
+	index := staticIndex{Docs: []staticDoc{}, Terms: map[string][]int{}}
+	for i, bm := range bookmarks {
+		index.Docs = append(index.Docs, staticDoc{Title: bm.DisplayTitle(), URL: bm.URL, Tags: bm.Tags})
+
+		terms := map[string]bool{}
+		for _, t := range searchTerms(bm.Info.Title + " " + bm.URL + " " + strings.Join(bm.Tags, " ")) {
+			terms[t] = true
+		}
+		textTerms := 0
+		for _, t := range searchTerms(bm.Info.RawText) {
+			if textTerms >= maxTextTerms {
+				break
+			}
+			if !terms[t] {
+				terms[t] = true
+				textTerms++
+			}
+		}
+		for t := range terms {
+			index.Terms[t] = append(index.Terms[t], i)
+		}
+	}
+	return index
+}
+
+// searchTerms splits s into lower case words. This must match the way
+// queries are split in static_search.js.
+func searchTerms(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
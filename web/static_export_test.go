@@ -0,0 +1,73 @@
+package web
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/tardisx/linkwallet/entity"
+)
+
+func TestExportStatic(t *testing.T) {
+	dir := t.TempDir()
+	bookmarks := []entity.Bookmark{
+		{ID: 1, URL: "http://example.com/go", Tags: []string{"Go", "onboarding"}, Info: entity.PageInfo{Title: "Go tour", RawText: "a tour of the language"}},
+		{ID: 2, URL: "http://example.com/git", Tags: []string{"go!", "onboarding"}, Info: entity.PageInfo{Title: "Git basics"}},
+	}
+
+	// a stale page from a previous export is removed
+	os.MkdirAll(filepath.Join(dir, "tags"), 0755)
+	os.WriteFile(filepath.Join(dir, "tags", "gone.html"), []byte{}, 0644)
+
+	err := ExportStatic(dir, "Team links", bookmarks)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	index, err := os.ReadFile(filepath.Join(dir, "index.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, exp := range []string{"Team links", "http://example.com/go", "http://example.com/git", `href="./assets/css/app.css"`, `href="./tags/onboarding.html"`} {
+		if !strings.Contains(string(index), exp) {
+			t.Errorf("index.html does not contain %s", exp)
+		}
+	}
+
+	// both tags slug to "go", so they need different files
+	for file, exp := range map[string]string{"go.html": "Go tour", "go-2.html": "Git basics", "onboarding.html": "Git basics"} {
+		page, err := os.ReadFile(filepath.Join(dir, "tags", file))
+		if err != nil {
+			t.Fatalf("missing tag page: %s", err)
+		}
+		if !strings.Contains(string(page), exp) || !strings.Contains(string(page), `href="../assets/css/app.css"`) {
+			t.Errorf("unexpected content in %s", file)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "tags", "gone.html")); err == nil {
+		t.Error("stale tag page was not removed")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "assets", "js", "static_search.js")); err != nil {
+		t.Errorf("assets not copied: %s", err)
+	}
+
+	b, err := os.ReadFile(filepath.Join(dir, "search.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	si := staticIndex{}
+	err = json.Unmarshal(b, &si)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(si.Docs) != 2 {
+		t.Fatalf("expected 2 docs in index, got %d", len(si.Docs))
+	}
+	for term, exp := range map[string][]int{"tour": {0}, "language": {0}, "basics": {1}, "onboarding": {0, 1}} {
+		if len(si.Terms[term]) != len(exp) {
+			t.Errorf("term %s: expected docs %v, got %v", term, exp, si.Terms[term])
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package web
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/tardisx/linkwallet/db"
+)
+
+// suggestSize is the number of suggestions shown under the search box.
+const suggestSize = 8
+
+// suggestion is a completion shown under the search box. Query is what
+// the search box holds after choosing it.
+type suggestion struct {
+	Label string
+	Kind  string
+	Count int
+	Query string
+}
+
+// suggestOptions works out what to complete in a partly typed query: the
+// last word, which may be a tag: term or negated, and the whole query as
+// the start of a title if it is plain text. ok is false if there is
+// nothing worth completing, or the last word is in an open phrase.
+func suggestOptions(owner uint64, query string) (opts db.SuggestOptions, head string, prefix string, ok bool) {
+	opts = db.SuggestOptions{Owner: owner, Size: suggestSize}
+	if last, _ := utf8.DecodeLastRuneInString(query); query == "" || unicode.IsSpace(last) {
+		return opts, "", "", false
+	}
+	// inside a quoted phrase, words are not completed one at a time
+	if strings.Count(query, `"`)%2 == 1 {
+		return opts, "", "", false
+	}
+
+	i := strings.LastIndexFunc(query, unicode.IsSpace)
+	head, word := query[:i+1], query[i+1:]
+	if strings.HasPrefix(word, "-") {
+		prefix, word = "-", word[1:]
+	}
+	if field, value, found := strings.Cut(word, ":"); found {
+		if !strings.EqualFold(field, "tag") {
+			return opts, "", "", false
+		}
+		opts.TagsOnly = true
+		prefix += field + ":"
+		word = value
+	}
+	if len(word) >= 2 || (opts.TagsOnly && word != "") {
+		if !strings.ContainsAny(word, `"()`) {
+			opts.Word = word
+		}
+	}
+	if len(query) >= 3 && !strings.ContainsAny(query, `":-()`) {
+		opts.Title = query
+	}
+	return opts, head, prefix, opts.Word != "" || opts.Title != ""
+}
+
+// suggestionLinks turns completions into the queries they lead to. Words
+// replace the word being typed, titles the whole query.
+func suggestionLinks(suggestions []db.Suggestion, head string, prefix string) []suggestion {
+	links := []suggestion{}
+	for _, s := range suggestions {
+		link := suggestion{Label: s.Term, Kind: s.Field, Count: s.Count}
+		switch s.Field {
+		case "tag":
+			term := db.QuoteTerm(s.Term)
+			tagPrefix := prefix
+			if !strings.HasSuffix(strings.ToLower(tagPrefix), "tag:") {
+				tagPrefix += "tag:"
+			}
+			link.Query = head + tagPrefix + term
+		case "title":
+			link.Query = "title:" + db.QuoteTerm(s.Term)
+		default:
+			link.Query = head + prefix + s.Term
+		}
+		links = append(links, link)
+	}
+	return links
+}
@@ -0,0 +1,60 @@
+package web
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/tardisx/linkwallet/db"
+)
+
+func TestSuggestOptions(t *testing.T) {
+	tcs := []struct {
+		query    string
+		word     string
+		title    string
+		tagsOnly bool
+		head     string
+		prefix   string
+		ok       bool
+	}{
+		{query: ""},
+		{query: "golang "},
+		{query: "g", ok: false},
+		{query: "go", word: "go", ok: true},
+		{query: "golang gen", word: "gen", title: "golang gen", head: "golang ", ok: true},
+		{query: "golang -gen", word: "gen", head: "golang ", prefix: "-", ok: true},
+		{query: "tag:k", word: "k", tagsOnly: true, prefix: "tag:", ok: true},
+		{query: "site:git"},
+		{query: `"exact phr`},
+		{query: "café à", word: "à", title: "café à", head: "café ", ok: true},
+		{query: "Å", word: "Å", ok: true},
+	}
+	for _, tc := range tcs {
+		opts, head, prefix, ok := suggestOptions(1, tc.query)
+		if ok != tc.ok || opts.Word != tc.word || opts.Title != tc.title || opts.TagsOnly != tc.tagsOnly {
+			t.Errorf("%q: got %+v %v", tc.query, opts, ok)
+		}
+		if ok && (head != tc.head || prefix != tc.prefix) {
+			t.Errorf("%q: got head %q prefix %q", tc.query, head, prefix)
+		}
+	}
+}
+
+func TestSuggestionLinks(t *testing.T) {
+	suggestions := []db.Suggestion{
+		{Term: "generics", Field: "word", Count: 3},
+		{Term: "machine learning", Field: "tag", Count: 2},
+		{Term: "generics in go", Field: "title", Count: 1},
+		{Term: `Go's "any" \ generics`, Field: "title", Count: 1},
+	}
+	got := suggestionLinks(suggestions, "golang ", "-")
+	want := []suggestion{
+		{Label: "generics", Kind: "word", Count: 3, Query: "golang -generics"},
+		{Label: "machine learning", Kind: "tag", Count: 2, Query: `golang -tag:"machine learning"`},
+		{Label: "generics in go", Kind: "title", Count: 1, Query: `title:"generics in go"`},
+		{Label: `Go's "any" \ generics`, Kind: "title", Count: 1, Query: `title:"Go's  any  \ generics"`},
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
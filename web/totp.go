@@ -0,0 +1,174 @@
+package web
+
+import (
+	"errors"
+	"image/png"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	"github.com/tardisx/linkwallet/db"
+	"github.com/tardisx/linkwallet/entity"
+)
+
+// secondFactorTimeout is how long after entering their password a user
+// has to enter their second factor.
+const secondFactorTimeout = time.Minute * 5
+
+// startSecondFactor records that the user has passed the password check,
+// and now needs to provide their second factor.
+func startSecondFactor(c *gin.Context, user entity.User) error {
+	session := sessions.Default(c)
+	session.Clear()
+	session.Set("2fa_user_id", user.ID)
+	session.Set("2fa_started", time.Now().Unix())
+	return session.Save()
+}
+
+// pendingSecondFactor returns the ID of the user who has passed the
+// password check and is yet to provide their second factor.
+func pendingSecondFactor(c *gin.Context) (uint64, bool) {
+	session := sessions.Default(c)
+	userID, ok := session.Get("2fa_user_id").(uint64)
+	if !ok {
+		return 0, false
+	}
+	started, _ := session.Get("2fa_started").(int64)
+	if time.Since(time.Unix(started, 0)) > secondFactorTimeout {
+		return 0, false
+	}
+	return userID, true
+}
+
+// addTOTPRoutes adds the routes for the second step of the login, and for
+// users to set up two factor authentication for their account.
+func addTOTPRoutes(r *gin.Engine, um *db.UserManager, cmm *db.ConfigManager) {
+
+	r.GET("/login/2fa", func(c *gin.Context) {
+		if _, ok := pendingSecondFactor(c); !ok {
+			c.Redirect(http.StatusFound, "/login")
+			return
+		}
+		c.HTML(http.StatusOK, "_layout.html", gin.H{"page": "login_2fa"})
+	})
+
+	r.POST("/login/2fa", func(c *gin.Context) {
+		userID, ok := pendingSecondFactor(c)
+		if !ok {
+			c.Redirect(http.StatusSeeOther, "/login")
+			return
+		}
+		session := sessions.Default(c)
+		ok, err := um.VerifySecondFactor(userID, c.PostForm("code"))
+		if err == db.ErrSecondFactorLocked {
+			log.Printf("locked second factor for user %d tried from %s", userID, c.ClientIP())
+			session.Clear()
+			session.Save()
+			c.HTML(http.StatusTooManyRequests, "_layout.html", gin.H{"page": "login", "error": err.Error()})
+			return
+		} else if err != nil {
+			c.String(http.StatusInternalServerError, err.Error())
+			return
+		}
+		if !ok {
+			log.Printf("failed second factor for user %d from %s", userID, c.ClientIP())
+			c.HTML(http.StatusUnauthorized, "_layout.html", gin.H{"page": "login_2fa", "error": "incorrect code"})
+			return
+		}
+		user, err := um.LoadUserByID(userID)
+		if err != nil {
+			c.String(http.StatusInternalServerError, err.Error())
+			return
+		}
+		err = startSession(c, user)
+		if err != nil {
+			c.String(http.StatusInternalServerError, err.Error())
+			return
+		}
+		c.Redirect(http.StatusSeeOther, "/")
+	})
+
+	// totpForm renders the two factor settings for the current user.
+	totpForm := func(c *gin.Context, meta gin.H) {
+		user, err := um.LoadUserByID(currentUser(c).ID)
+		if err != nil {
+			c.String(http.StatusInternalServerError, err.Error())
+			return
+		}
+		meta["user"] = user
+		c.HTML(http.StatusOK, "totp_form.html", meta)
+	}
+
+	// localUser rejects users without a password, since they log in via
+	// a proxy or OIDC, and their second factor is not our concern.
+	localUser := func(c *gin.Context) {
+		if !currentUser(c).HasPassword() {
+			c.String(http.StatusForbidden, "two factor authentication is only for local accounts")
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+
+	account := r.Group("/account/2fa", localUser)
+
+	account.GET("", func(c *gin.Context) {
+		config, ok := loadConfig(c, cmm)
+		if !ok {
+			return
+		}
+		meta := gin.H{"page": "totp", "config": config, "user": currentUser(c), "csrf_token": csrfToken(c)}
+		c.HTML(http.StatusOK, "_layout.html", meta)
+	})
+
+	account.POST("/begin", func(c *gin.Context) {
+		_, err := um.BeginTOTPEnrollment(currentUser(c).ID)
+		totpForm(c, gin.H{"enrolling": err == nil, "error": err, "nonce": time.Now().UnixNano()})
+	})
+
+	account.GET("/qr.png", func(c *gin.Context) {
+		user := currentUser(c)
+		if user.TOTPEnabled {
+			c.String(http.StatusNotFound, "already enabled")
+			return
+		}
+		key, err := db.TOTPKey(user)
+		if err != nil {
+			c.String(http.StatusNotFound, err.Error())
+			return
+		}
+		img, err := key.Image(200, 200)
+		if err != nil {
+			c.String(http.StatusInternalServerError, err.Error())
+			return
+		}
+		c.Header("Content-Type", "image/png")
+		c.Header("Cache-Control", "no-store")
+		png.Encode(c.Writer, img)
+	})
+
+	account.POST("/confirm", func(c *gin.Context) {
+		codes, err := um.ConfirmTOTPEnrollment(currentUser(c).ID, c.PostForm("code"))
+		if err != nil {
+			totpForm(c, gin.H{"enrolling": true, "error": err, "nonce": time.Now().UnixNano()})
+			return
+		}
+		totpForm(c, gin.H{"recovery_codes": codes})
+	})
+
+	account.POST("/disable", func(c *gin.Context) {
+		user := currentUser(c)
+		ok, err := um.VerifySecondFactor(user.ID, c.PostForm("code"))
+		if err == nil && !ok {
+			err = errors.New("incorrect code")
+		}
+		if err != nil {
+			totpForm(c, gin.H{"error": err})
+			return
+		}
+		err = um.ResetTOTP(user.ID)
+		totpForm(c, gin.H{"error": err})
+	})
+}
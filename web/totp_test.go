@@ -0,0 +1,135 @@
+package web
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pquerna/otp/totp"
+	"github.com/tardisx/linkwallet/db"
+	"github.com/tardisx/linkwallet/entity"
+)
+
+func TestSecondFactorLogin(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	dbh := newTestDB(t)
+	um := db.NewUserManager(dbh)
+	ts := httptest.NewServer(Create(db.NewBookmarkManager(dbh), db.NewConfigManager(dbh), um, db.NewShareManager(dbh), db.NewSavedSearchManager(dbh), Options{}).engine)
+	t.Cleanup(ts.Close)
+
+	alice := entity.User{Username: "alice"}
+	err := um.AddUser(&alice, "correct horse battery")
+	if err != nil {
+		t.Fatal(err)
+	}
+	alice, _ = um.BeginTOTPEnrollment(alice.ID)
+	code, _ := totp.GenerateCode(alice.TOTPSecret, time.Now())
+	_, err = um.ConfirmTOTPEnrollment(alice.ID, code)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := newCookieClient()
+	res, err := client.PostForm(ts.URL+"/login", url.Values{"username": {"alice"}, "password": {"correct horse battery"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.Request.URL.Path != "/login/2fa" {
+		t.Fatalf("expected to be asked for a code, ended up at %s", res.Request.URL.Path)
+	}
+
+	// the password alone must not give access
+	res, err = client.Get(ts.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.Request.URL.Path != "/login" {
+		t.Errorf("expected to be sent to login, ended up at %s", res.Request.URL.Path)
+	}
+
+	res, err = client.PostForm(ts.URL+"/login/2fa", url.Values{"code": {"000000"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected wrong code to be rejected, got %d", res.StatusCode)
+	}
+
+	next, _ := totp.GenerateCode(alice.TOTPSecret, time.Now().Add(time.Second*30))
+	res, err = client.PostForm(ts.URL+"/login/2fa", url.Values{"code": {next}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(res.Body)
+	res.Body.Close()
+	if !strings.Contains(string(body), "Logout alice") {
+		t.Errorf("not logged in after second factor, at %s", res.Request.URL.Path)
+	}
+}
+
+func TestSecondFactorAttempts(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	dbh := newTestDB(t)
+	um := db.NewUserManager(dbh)
+	ts := httptest.NewServer(Create(db.NewBookmarkManager(dbh), db.NewConfigManager(dbh), um, db.NewShareManager(dbh), db.NewSavedSearchManager(dbh), Options{}).engine)
+	t.Cleanup(ts.Close)
+
+	alice := entity.User{Username: "alice"}
+	err := um.AddUser(&alice, "correct horse battery")
+	if err != nil {
+		t.Fatal(err)
+	}
+	alice, _ = um.BeginTOTPEnrollment(alice.ID)
+	code, _ := totp.GenerateCode(alice.TOTPSecret, time.Now())
+	_, err = um.ConfirmTOTPEnrollment(alice.ID, code)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// wrong codes are counted against the account rather than the
+	// session, so starting over with the password does not reset them
+	login := func() *http.Client {
+		client := newCookieClient()
+		res, err := client.PostForm(ts.URL+"/login", url.Values{"username": {"alice"}, "password": {"correct horse battery"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		return client
+	}
+	client := login()
+	for i := range 10 {
+		if i == 5 {
+			client = login()
+		}
+		res, err := client.PostForm(ts.URL+"/login/2fa", url.Values{"code": {"000000"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		if res.StatusCode != http.StatusUnauthorized {
+			t.Errorf("expected wrong code %d to be refused, got %d", i+1, res.StatusCode)
+		}
+	}
+
+	// the account is locked now, so even the right code is no use
+	client = login()
+	next, _ := totp.GenerateCode(alice.TOTPSecret, time.Now().Add(time.Second*30))
+	res, err := client.PostForm(ts.URL+"/login/2fa", url.Values{"code": {next}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(res.Body)
+	res.Body.Close()
+	if res.StatusCode != http.StatusTooManyRequests || strings.Contains(string(body), "Logout alice") {
+		t.Errorf("expected the locked account to be refused, got %d", res.StatusCode)
+	}
+}
@@ -0,0 +1,121 @@
+package web
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tardisx/linkwallet/db"
+	"github.com/tardisx/linkwallet/entity"
+)
+
+// addUserRoutes adds the admin routes for managing user accounts.
+func addUserRoutes(r *gin.Engine, um *db.UserManager, cmm *db.ConfigManager) {
+
+	admin := r.Group("/admin", requireAdmin())
+
+	// usersList renders the list of users, with an optional message or
+	// error from the action just taken.
+	usersList := func(c *gin.Context, message string, err error) {
+		users, loadErr := um.AllUsers()
+		if loadErr != nil {
+			c.String(http.StatusInternalServerError, loadErr.Error())
+			return
+		}
+		meta := gin.H{"users": users, "user": currentUser(c), "message": message, "error": err}
+		c.HTML(http.StatusOK, "users_list.html", meta)
+	}
+
+	// userFromParam loads the user given by the id param.
+	userFromParam := func(c *gin.Context) (entity.User, bool) {
+		id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+		if err != nil {
+			c.String(http.StatusBadRequest, "bad id")
+			return entity.User{}, false
+		}
+		u, err := um.LoadUserByID(id)
+		if err != nil {
+			c.String(http.StatusNotFound, err.Error())
+			return entity.User{}, false
+		}
+		return u, true
+	}
+
+	admin.GET("/users", func(c *gin.Context) {
+		user := currentUser(c)
+		config, err := cmm.LoadConfig(user.ID)
+		if err != nil {
+			c.String(http.StatusInternalServerError, err.Error())
+			return
+		}
+		users, err := um.AllUsers()
+		if err != nil {
+			c.String(http.StatusInternalServerError, err.Error())
+			return
+		}
+		meta := gin.H{"page": "users", "config": config, "user": user, "csrf_token": csrfToken(c), "users": users}
+		c.HTML(http.StatusOK, "_layout.html", meta)
+	})
+
+	admin.POST("/users", func(c *gin.Context) {
+		u := entity.User{
+			Username: c.PostForm("username"),
+			Admin:    c.PostForm("admin") != "",
+		}
+		err := um.AddUser(&u, c.PostForm("password"))
+		if err != nil {
+			usersList(c, "", err)
+			return
+		}
+		usersList(c, fmt.Sprintf("added user %s", u.Username), nil)
+	})
+
+	admin.POST("/users/:id/password", func(c *gin.Context) {
+		u, ok := userFromParam(c)
+		if !ok {
+			return
+		}
+		err := um.SetPassword(u.ID, c.PostForm("password"))
+		if err != nil {
+			usersList(c, "", err)
+			return
+		}
+		usersList(c, fmt.Sprintf("password changed for %s", u.Username), nil)
+	})
+
+	admin.POST("/users/:id/admin", func(c *gin.Context) {
+		u, ok := userFromParam(c)
+		if !ok {
+			return
+		}
+		if u.ID == currentUser(c).ID {
+			usersList(c, "", fmt.Errorf("you cannot remove your own admin rights"))
+			return
+		}
+		u.Admin = !u.Admin
+		err := um.SaveUser(&u)
+		if err != nil {
+			usersList(c, "", err)
+			return
+		}
+		usersList(c, fmt.Sprintf("updated %s", u.Username), nil)
+	})
+
+	admin.DELETE("/users/:id", func(c *gin.Context) {
+		u, ok := userFromParam(c)
+		if !ok {
+			return
+		}
+		if u.ID == currentUser(c).ID {
+			usersList(c, "", fmt.Errorf("you cannot delete yourself"))
+			return
+		}
+		err := um.DeleteUser(u.ID)
+		if err != nil {
+			usersList(c, "", err)
+			return
+		}
+		usersList(c, fmt.Sprintf("deleted user %s", u.Username), nil)
+	})
+}
@@ -6,6 +6,7 @@ import (
 	"html/template"
 	"io/fs"
 	"log"
+	"net"
 	"net/http"
 	"sort"
 	"strconv"
@@ -21,6 +22,7 @@ import (
 	"github.com/hako/durafmt"
 
 	"github.com/gin-contrib/gzip"
+	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
 
 	"gonum.org/v1/plot"
@@ -49,14 +51,36 @@ type Server struct {
 	bmm    *db.BookmarkManager
 }
 
-type ColumnInfo struct {
-	Name  string
-	Param string
-	Class string
+// Options configures the web server.
+type Options struct {
+	// AuthHeader, if set, is a request header containing the username of
+	// a user already authenticated by a reverse proxy. It is only trusted
+	// for requests arriving directly from one of TrustedProxies.
+	AuthHeader     string
+	TrustedProxies []*net.IPNet
+	// OIDC, if set, enables login via an OpenID Connect provider.
+	OIDC *OIDCOptions
+}
+
+// parseTemplates parses the embedded templates.
+func parseTemplates() *template.Template {
+	// templ := template.Must(template.New("").Funcs(template.FuncMap{"dict": dictHelper}).ParseFS(templateFiles, "templates/*.html"))
+	return template.Must(template.New("").Funcs(
+		template.FuncMap{
+			"nicetime":   niceTime,
+			"niceURL":    niceURL,
+			"niceSizeMB": func(s int) string { return fmt.Sprintf("%.1f", float32(s)/1024/1024) },
+			"niceSizeKB": func(s int) string { return fmt.Sprintf("%.1f", float32(s)/1024) },
+			"join":       strings.Join,
+			"searchURL":  searchURL,
+			"version":    func() *version.Info { return &version.VersionInfo },
+			"meminfo":    meta.MemInfo,
+			"markdown":   func(s string) template.HTML { return template.HTML(string(markdown.ToHTML([]byte(s), nil, nil))) },
+		}).ParseFS(templateFiles, "templates/*.html"))
 }
 
 // Create creates a new web server instance and sets up routing.
-func Create(bmm *db.BookmarkManager, cmm *db.ConfigManager) *Server {
+func Create(bmm *db.BookmarkManager, cmm *db.ConfigManager, um *db.UserManager, sm *db.ShareManager, ssm *db.SavedSearchManager, opts Options) *Server {
 
 	// Set the default font for graphs
 	plot.DefaultFont = font.Font{
@@ -70,21 +94,11 @@ func Create(bmm *db.BookmarkManager, cmm *db.ConfigManager) *Server {
 		log.Fatalf("problem with assetFS: %s", err)
 	}
 
-	// templ := template.Must(template.New("").Funcs(template.FuncMap{"dict": dictHelper}).ParseFS(templateFiles, "templates/*.html"))
-	templ := template.Must(template.New("").Funcs(
-		template.FuncMap{
-			"nicetime":   niceTime,
-			"niceURL":    niceURL,
-			"niceSizeMB": func(s int) string { return fmt.Sprintf("%.1f", float32(s)/1024/1024) },
-			"join":       strings.Join,
-			"version":    func() *version.Info { return &version.VersionInfo },
-			"meminfo":    meta.MemInfo,
-			"markdown":   func(s string) template.HTML { return template.HTML(string(markdown.ToHTML([]byte(s), nil, nil))) },
-		}).ParseFS(templateFiles, "templates/*.html"))
+	templ := parseTemplates()
 
-	config, err := cmm.LoadConfig()
+	sessionStore, err := newSessionStore(um)
 	if err != nil {
-		log.Fatalf("could not start server - failed to load config: %s", err)
+		log.Fatalf("could not start server - failed to create session store: %s", err)
 	}
 
 	r := gin.Default()
@@ -97,83 +111,143 @@ func Create(bmm *db.BookmarkManager, cmm *db.ConfigManager) *Server {
 
 	r.Use(headersByURI())
 	r.Use(gzip.Gzip(gzip.DefaultCompression, gzip.WithExcludedExtensions([]string{".pdf", ".mp4"})))
+	r.Use(sessions.Sessions(sessionName, sessionStore))
+	if opts.AuthHeader != "" {
+		r.Use(proxyAuth(um, opts.AuthHeader, opts.TrustedProxies))
+	}
+	r.Use(requireLogin(um))
+	r.Use(csrfProtect())
 
 	r.SetHTMLTemplate(templ)
 	r.StaticFS("/assets", http.FS(staticFS))
 
-	r.GET("/", func(c *gin.Context) {
-		meta := gin.H{"page": "root", "config": config}
+	addAuthRoutes(r, um, opts)
+	addUserRoutes(r, um, cmm)
+	addTOTPRoutes(r, um, cmm)
+	addShareRoutes(r, bmm, cmm, sm)
+	addManageRoutes(r, bmm, cmm)
+	addSavedSearchRoutes(r, bmm, cmm, ssm)
+	addRelatedRoutes(r, bmm)
+	addHistoryRoutes(r, bmm, cmm)
+	addOpenSearchRoutes(r, bmm, cmm)
+
+	// the home page, which the domains page links to with a domain to
+	// search within, and which runs the q param as a search for browsers
+	// and the history page
+	home := func(c *gin.Context) {
+		config, ok := loadConfig(c, cmm)
+		if !ok {
+			return
+		}
+		user := currentUser(c)
+		searches, err := ssm.SavedSearches(user.ID)
+		if err != nil {
+			c.String(http.StatusInternalServerError, err.Error())
+			return
+		}
+		meta := gin.H{"page": "root", "config": config, "user": user, "csrf_token": csrfToken(c), "filter_domain": c.Query("domain"),
+			"query": c.Query("q"), "saved": savedSearchRows(bmm, searches)}
+		if q := c.Query("q"); q != "" {
+			meta["search_results"] = searchResults(bmm, config, user.ID, searchForm{Query: q, Domain: c.Query("domain")})
+		}
 		c.HTML(http.StatusOK,
 			"_layout.html", meta,
 		)
-	})
+	}
+	r.GET("/", home)
+	r.GET("/search", home)
 
-	r.GET("/manage", func(c *gin.Context) {
-		results, _ := bmm.Search(db.SearchOptions{All: true})
-		meta := gin.H{"page": "manage", "config": config, "results": results}
+	r.GET("/domains", func(c *gin.Context) {
+		config, ok := loadConfig(c, cmm)
+		if !ok {
+			return
+		}
+		user := currentUser(c)
+		domains, err := bmm.Domains(user.ID)
+		if err != nil {
+			c.String(http.StatusInternalServerError, err.Error())
+			return
+		}
+		meta := gin.H{"page": "domains", "config": config, "user": user, "csrf_token": csrfToken(c), "domains": domains}
 		c.HTML(http.StatusOK,
 			"_layout.html", meta,
 		)
 	})
 
-	r.POST("/manage/results", func(c *gin.Context) {
-		query := c.PostForm("query")
-
-		results := make([]entity.BookmarkSearchResult, 0)
-		if query == "" {
-			results, _ = bmm.Search(db.SearchOptions{All: true, Results: 100})
-		} else {
-			results, _ = bmm.Search(db.SearchOptions{Query: query})
-		}
-		meta := gin.H{"config": config, "results": results}
-
-		colTitle := &ColumnInfo{Name: "Title/URL", Param: "title"}
-		colCreated := &ColumnInfo{Name: "Created", Param: "created", Class: "show-for-large"}
-		colScraped := &ColumnInfo{Name: "Scraped", Param: "scraped", Class: "show-for-large"}
-
-		cols := gin.H{
-			"title":   colTitle,
-			"created": colCreated,
-			"scraped": colScraped,
-		}
-		meta["column"] = cols
-
-		c.HTML(http.StatusOK, "manage_results.html", meta)
-
-	})
-
 	r.GET("/config", func(c *gin.Context) {
-		meta := gin.H{"page": "config", "config": config}
+		config, ok := loadConfig(c, cmm)
+		if !ok {
+			return
+		}
+		meta := gin.H{"page": "config", "config": config, "user": currentUser(c), "csrf_token": csrfToken(c)}
 		c.HTML(http.StatusOK,
 			"_layout.html", meta,
 		)
 	})
 
 	r.POST("/config", func(c *gin.Context) {
+		config, ok := loadConfig(c, cmm)
+		if !ok {
+			return
+		}
 		config.BaseURL = c.PostForm("baseurl")
 		config.BaseURL = strings.TrimRight(config.BaseURL, "/")
-		cmm.SaveConfig(&config)
+		distance, err := strconv.Atoi(c.PostForm("fuzzy_distance"))
+		if err == nil && distance >= 0 && distance <= 2 {
+			config.FuzzyDistance = distance
+		}
+		for param, boost := range map[string]*float64{
+			"boost_title":   &config.Boosts.Title,
+			"boost_tags":    &config.Boosts.Tags,
+			"boost_url":     &config.Boosts.URL,
+			"boost_rawtext": &config.Boosts.RawText,
+		} {
+			value, err := strconv.ParseFloat(c.PostForm(param), 64)
+			if err == nil && value >= 0 && value <= 10 {
+				*boost = value
+			}
+		}
+		cmm.SaveConfig(currentUser(c).ID, &config)
 		meta := gin.H{"config": config}
 
 		c.HTML(http.StatusOK, "config_form.html", meta)
 	})
 
+	r.GET("/search/suggest", func(c *gin.Context) {
+		opts, head, prefix, ok := suggestOptions(currentUser(c).ID, c.Query("query"))
+		if !ok {
+			c.HTML(http.StatusOK, "suggestions.html", gin.H{})
+			return
+		}
+		suggestions, err := bmm.Suggest(opts)
+		if err != nil {
+			c.String(http.StatusInternalServerError, err.Error())
+			return
+		}
+		c.HTML(http.StatusOK, "suggestions.html", gin.H{"suggestions": suggestionLinks(suggestions, head, prefix)})
+	})
+
 	r.POST("/search", func(c *gin.Context) {
-		query := c.PostForm("query")
+		form := parseSearchForm(c)
 
-		// no query, return an empty response
-		if len(query) == 0 {
+		// no query or filters, return an empty response
+		if form.empty() {
 			c.Status(http.StatusNoContent)
 			c.Writer.Write([]byte{})
 			return
 		}
 
-		sr, err := bmm.Search(db.SearchOptions{Query: query})
-		data := gin.H{
-			"results": sr,
-			"error":   err,
+		config, ok := loadConfig(c, cmm)
+		if !ok {
+			return
 		}
 
+		data := searchResults(bmm, config, currentUser(c).ID, form)
+		// later pages are added to the end of the first
+		if form.From > 0 {
+			c.HTML(http.StatusOK, "search_hits.html", data)
+			return
+		}
 		c.HTML(http.StatusOK,
 			"search_results.html", data,
 		)
@@ -186,9 +260,10 @@ func Create(bmm *db.BookmarkManager, cmm *db.ConfigManager) *Server {
 			tags = strings.Split(c.PostForm("tags_hidden"), "|")
 		}
 		bm := entity.Bookmark{
-			ID:   0,
-			URL:  url,
-			Tags: tags,
+			ID:    0,
+			Owner: currentUser(c).ID,
+			URL:   url,
+			Tags:  tags,
 		}
 		err := bmm.AddBookmark(&bm)
 
@@ -219,8 +294,9 @@ func Create(bmm *db.BookmarkManager, cmm *db.ConfigManager) *Server {
 		for _, url := range urlsTrimmed {
 			if url != "" {
 				bm := entity.Bookmark{
-					ID:  0,
-					URL: url,
+					ID:    0,
+					Owner: currentUser(c).ID,
+					URL:   url,
 				}
 
 				err := bmm.AddBookmark(&bm)
@@ -276,7 +352,11 @@ func Create(bmm *db.BookmarkManager, cmm *db.ConfigManager) *Server {
 	r.POST("/scrape/:id", func(c *gin.Context) {
 		id := c.Params.ByName("id")
 		idNum, _ := strconv.ParseInt(id, 10, 32)
-		bm := bmm.LoadBookmarkByID(uint64(idNum))
+		bm, err := bmm.LoadBookmarkForOwner(currentUser(c).ID, uint64(idNum))
+		if err != nil {
+			c.String(http.StatusNotFound, err.Error())
+			return
+		}
 		bmm.QueueScrape(&bm)
 		c.String(http.StatusOK, "<p>scrape queued</p>")
 	})
@@ -284,7 +364,7 @@ func Create(bmm *db.BookmarkManager, cmm *db.ConfigManager) *Server {
 	r.GET("/export", func(c *gin.Context) {
 		c.Writer.Header().Set("Content-Type", "text/plain")
 		c.Writer.Header().Set("Content-Disposition", "attachment; filename=\"bookmarks.txt\"")
-		err := bmm.ExportBookmarks(c.Writer)
+		err := bmm.ExportBookmarks(c.Writer, currentUser(c).ID)
 		// this is a bit late, but we already added headers, so at least log it.
 		if err != nil {
 			log.Printf("got error when exporting: %s", err)
@@ -294,7 +374,11 @@ func Create(bmm *db.BookmarkManager, cmm *db.ConfigManager) *Server {
 	r.GET("/bookmarklet", func(c *gin.Context) {
 		url := c.Query("url")
 
-		meta := gin.H{"page": "bookmarklet_click", "config": config, "url": url}
+		config, ok := loadConfig(c, cmm)
+		if !ok {
+			return
+		}
+		meta := gin.H{"page": "bookmarklet_click", "config": config, "user": currentUser(c), "csrf_token": csrfToken(c), "url": url}
 
 		// check if they just clicked it from the actual app
 		if strings.Index(url, config.BaseURL) == 0 {
@@ -314,8 +398,16 @@ func Create(bmm *db.BookmarkManager, cmm *db.ConfigManager) *Server {
 			return
 		}
 
-		bookmark := bmm.LoadBookmarkByID(bookmarkID)
-		meta := gin.H{"page": "edit", "bookmark": bookmark, "tw": gin.H{"tags": bookmark.Tags, "tags_hidden": strings.Join(bookmark.Tags, "|")}}
+		bookmark, err := bmm.LoadBookmarkForOwner(currentUser(c).ID, bookmarkID)
+		if err != nil {
+			c.String(http.StatusNotFound, err.Error())
+			return
+		}
+		config, configOK := loadConfig(c, cmm)
+		if !configOK {
+			return
+		}
+		meta := gin.H{"page": "edit", "config": config, "user": currentUser(c), "csrf_token": csrfToken(c), "bookmark": bookmark, "tw": gin.H{"tags": bookmark.Tags, "tags_hidden": strings.Join(bookmark.Tags, "|")}}
 
 		c.HTML(http.StatusOK,
 			"_layout.html", meta,
@@ -330,7 +422,11 @@ func Create(bmm *db.BookmarkManager, cmm *db.ConfigManager) *Server {
 			return
 		}
 
-		bookmark := bmm.LoadBookmarkByID(bookmarkID)
+		bookmark, err := bmm.LoadBookmarkForOwner(currentUser(c).ID, bookmarkID)
+		if err != nil {
+			c.String(http.StatusNotFound, err.Error())
+			return
+		}
 
 		// update title and override title
 		overrideTitle := c.PostForm("override_title")
@@ -342,6 +438,8 @@ func Create(bmm *db.BookmarkManager, cmm *db.ConfigManager) *Server {
 			bookmark.PreserveTitle = false
 		}
 
+		bookmark.Public = c.PostForm("public") != ""
+
 		// freshen tags
 		if c.PostForm("tags_hidden") == "" {
 			// empty
@@ -368,8 +466,12 @@ func Create(bmm *db.BookmarkManager, cmm *db.ConfigManager) *Server {
 			return
 		}
 
-		bookmark := bmm.LoadBookmarkByID(bookmarkID)
-		err := bmm.DeleteBookmark(&bookmark)
+		bookmark, err := bmm.LoadBookmarkForOwner(currentUser(c).ID, bookmarkID)
+		if err != nil {
+			c.String(http.StatusNotFound, err.Error())
+			return
+		}
+		err = bmm.DeleteBookmark(&bookmark)
 		if err != nil {
 			panic(err)
 		}
@@ -379,11 +481,15 @@ func Create(bmm *db.BookmarkManager, cmm *db.ConfigManager) *Server {
 	})
 
 	r.GET("/info", func(c *gin.Context) {
-		dbStats, err := bmm.Stats()
+		dbStats, err := bmm.Stats(currentUser(c).ID)
 		if err != nil {
 			panic("could not load stats for info page")
 		}
-		meta := gin.H{"page": "info", "stats": dbStats, "config": config}
+		config, ok := loadConfig(c, cmm)
+		if !ok {
+			return
+		}
+		meta := gin.H{"page": "info", "stats": dbStats, "config": config, "user": currentUser(c), "csrf_token": csrfToken(c)}
 		c.HTML(http.StatusOK,
 			"_layout.html", meta,
 		)
@@ -394,7 +500,7 @@ func Create(bmm *db.BookmarkManager, cmm *db.ConfigManager) *Server {
 		graphType := c.Param("type")
 		p := plot.New()
 
-		dbStats, err := bmm.Stats()
+		dbStats, err := bmm.Stats(currentUser(c).ID)
 		if err != nil {
 			panic("could not load stats for graph page")
 		}
@@ -452,6 +558,17 @@ func plotPoints(sortedKeys []time.Time, dbStats entity.DBStats, p *plot.Plot, k
 	p.Add(l)
 }
 
+// loadConfig loads the config for the logged in user. If it cannot be
+// loaded an error response is sent, and false is returned.
+func loadConfig(c *gin.Context, cmm *db.ConfigManager) (entity.Config, bool) {
+	config, err := cmm.LoadConfig(currentUser(c).ID)
+	if err != nil {
+		c.String(http.StatusInternalServerError, err.Error())
+		return entity.Config{}, false
+	}
+	return config, true
+}
+
 // headersByURI sets the headers for some special cases, set a custom long cache time for
 // static resources.
 func headersByURI() gin.HandlerFunc {